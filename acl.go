@@ -0,0 +1,300 @@
+package s3protocol
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// xsiNamespace is the XML namespace of the xsi:type attribute of the grantees.
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// accessControlPolicy is the ACL of the object or the bucket exchanged in JSON or XML.
+//
+// JSON:
+//
+//	{
+//	  "Owner": {"ID": "owner-id"},
+//	  "Grants": [{"Grantee": {"Type": "CanonicalUser", "ID": "owner-id"}, "Permission": "FULL_CONTROL"}]
+//	}
+//
+// XML:
+//
+//	<AccessControlPolicy>
+//	  <Owner><ID>owner-id</ID></Owner>
+//	  <AccessControlList>
+//	    <Grant>
+//	      <Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>owner-id</ID></Grantee>
+//	      <Permission>FULL_CONTROL</Permission>
+//	    </Grant>
+//	  </AccessControlList>
+//	</AccessControlPolicy>
+type accessControlPolicy struct {
+	XMLName xml.Name `xml:"AccessControlPolicy" json:"-"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty" json:"-"`
+	Owner   *owner   `xml:"Owner,omitempty" json:"Owner,omitempty"`
+	Grants  []grant  `xml:"AccessControlList>Grant" json:"Grants"`
+}
+
+type owner struct {
+	ID          string `xml:"ID,omitempty" json:"ID,omitempty"`
+	DisplayName string `xml:"DisplayName,omitempty" json:"DisplayName,omitempty"`
+}
+
+type grant struct {
+	Grantee    grantee `xml:"Grantee" json:"Grantee"`
+	Permission string  `xml:"Permission" json:"Permission"`
+}
+
+type grantee struct {
+	Type         string `xml:"-" json:"Type"`
+	ID           string `xml:"ID,omitempty" json:"ID,omitempty"`
+	DisplayName  string `xml:"DisplayName,omitempty" json:"DisplayName,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty" json:"EmailAddress,omitempty"`
+	URI          string `xml:"URI,omitempty" json:"URI,omitempty"`
+}
+
+// MarshalXML implements xml.Marshaler.
+// The type of the grantee is encoded as the xsi:type attribute.
+func (g grantee) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain grantee
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+		xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: g.Type},
+	)
+	return e.EncodeElement(plain(g), start)
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (g *grantee) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain grantee
+	if err := d.DecodeElement((*plain)(g), &start); err != nil {
+		return err
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			g.Type = attr.Value
+		}
+	}
+	return nil
+}
+
+func makeAccessControlPolicy(o *s3.Owner, grants []*s3.Grant) *accessControlPolicy {
+	acp := &accessControlPolicy{
+		Xmlns:  s3Namespace,
+		Grants: make([]grant, 0, len(grants)),
+	}
+	if o != nil {
+		acp.Owner = &owner{
+			ID:          aws.StringValue(o.ID),
+			DisplayName: aws.StringValue(o.DisplayName),
+		}
+	}
+	for _, g := range grants {
+		var v grant
+		if g.Grantee != nil {
+			v.Grantee = grantee{
+				Type:         aws.StringValue(g.Grantee.Type),
+				ID:           aws.StringValue(g.Grantee.ID),
+				DisplayName:  aws.StringValue(g.Grantee.DisplayName),
+				EmailAddress: aws.StringValue(g.Grantee.EmailAddress),
+				URI:          aws.StringValue(g.Grantee.URI),
+			}
+		}
+		v.Permission = aws.StringValue(g.Permission)
+		acp.Grants = append(acp.Grants, v)
+	}
+	return acp
+}
+
+func (acp *accessControlPolicy) s3AccessControlPolicy() *s3.AccessControlPolicy {
+	ret := &s3.AccessControlPolicy{
+		Grants: make([]*s3.Grant, 0, len(acp.Grants)),
+	}
+	if acp.Owner != nil {
+		ret.Owner = &s3.Owner{
+			ID:          nilIfEmpty(acp.Owner.ID),
+			DisplayName: nilIfEmpty(acp.Owner.DisplayName),
+		}
+	}
+	for _, g := range acp.Grants {
+		ret.Grants = append(ret.Grants, &s3.Grant{
+			Grantee: &s3.Grantee{
+				Type:         nilIfEmpty(g.Grantee.Type),
+				ID:           nilIfEmpty(g.Grantee.ID),
+				DisplayName:  nilIfEmpty(g.Grantee.DisplayName),
+				EmailAddress: nilIfEmpty(g.Grantee.EmailAddress),
+				URI:          nilIfEmpty(g.Grantee.URI),
+			},
+			Permission: nilIfEmpty(g.Permission),
+		})
+	}
+	return ret
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// decodeAccessControlPolicy decodes the ACL in the request body.
+// It returns nil if the body is empty, because the ACL may be given by the x-amz-acl and x-amz-grant-* headers.
+func decodeAccessControlPolicy(req *http.Request) (*s3.AccessControlPolicy, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 {
+		return nil, nil
+	}
+	var body accessControlPolicy
+	if err := decodeRequest(req, &body); err != nil {
+		return nil, err
+	}
+	return body.s3AccessControlPolicy(), nil
+}
+
+// aclHandler returns the handler for ?acl.
+// The request with no object key is for the ACL of the bucket.
+func (t *Transport) aclHandler(req *http.Request) func(req *http.Request) (*http.Response, error) {
+	bucket := strings.TrimPrefix(req.URL.Path, "/") == ""
+	switch req.Method {
+	case http.MethodGet:
+		if bucket {
+			return t.getBucketAcl
+		}
+		return t.getObjectAcl
+	case http.MethodPut:
+		if bucket {
+			return t.putBucketAcl
+		}
+		return t.putObjectAcl
+	}
+	return nil
+}
+
+func (t *Transport) getObjectAcl(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetObjectAclInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	out, err := svc.GetObjectAclWithContext(ctx, in)
+	header := makeHeaderFromGetObjectAclOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	return encodeResponse(req, http.StatusOK, header, makeAccessControlPolicy(out.Owner, out.Grants))
+}
+
+func (t *Transport) putObjectAcl(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	acp, err := decodeAccessControlPolicy(req)
+	if err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newPutObjectAclInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	in.AccessControlPolicy = acp
+	out, err := svc.PutObjectAclWithContext(ctx, in)
+	header := makeHeaderFromPutObjectAclOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
+
+func (t *Transport) getBucketAcl(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketAclInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketAclWithContext(ctx, in)
+	header := makeHeaderFromGetBucketAclOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	return encodeResponse(req, http.StatusOK, header, makeAccessControlPolicy(out.Owner, out.Grants))
+}
+
+func (t *Transport) putBucketAcl(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	acp, err := decodeAccessControlPolicy(req)
+	if err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newPutBucketAclInput(req)
+	in.Bucket = &host
+	in.AccessControlPolicy = acp
+	out, err := svc.PutBucketAclWithContext(ctx, in)
+	header := makeHeaderFromPutBucketAclOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
@@ -0,0 +1,188 @@
+package s3protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRoundTrip_ObjectACL(t *testing.T) {
+	var put *s3.PutObjectAclInput
+	mock := &s3mock{
+		getObjectAclWithContext: func(ctx context.Context, in *s3.GetObjectAclInput, _ ...request.Option) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Owner: &s3.Owner{ID: aws.String("owner-id")},
+				Grants: []*s3.Grant{
+					{
+						Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("owner-id")},
+						Permission: aws.String(s3.PermissionFullControl),
+					},
+					{
+						Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+						Permission: aws.String(s3.PermissionRead),
+					},
+				},
+			}, nil
+		},
+		putObjectAclWithContext: func(ctx context.Context, in *s3.PutObjectAclInput, _ ...request.Option) (*s3.PutObjectAclOutput, error) {
+			put = in
+			return &s3.PutObjectAclOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	// get the grants in JSON
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?acl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Owner":{"ID":"owner-id"},"Grants":[` +
+		`{"Grantee":{"Type":"CanonicalUser","ID":"owner-id"},"Permission":"FULL_CONTROL"},` +
+		`{"Grantee":{"Type":"Group","URI":"http://acs.amazonaws.com/groups/global/AllUsers"},"Permission":"READ"}]}`
+	if string(data) != want {
+		t.Errorf("want %s, got %s", want, data)
+	}
+
+	// get the grants in XML
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?acl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `<Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee>`) {
+		t.Errorf("unexpected body: %s", data)
+	}
+
+	// canned ACL
+	req, err = http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?acl&versionId=foobar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Acl", "private")
+	req.Header.Set("X-Amz-Grant-Read", `id="reader-id"`)
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if aws.StringValue(put.ACL) != "private" || aws.StringValue(put.GrantRead) != `id="reader-id"` || aws.StringValue(put.VersionId) != "foobar" {
+		t.Errorf("unexpected input: %v", put)
+	}
+	if put.AccessControlPolicy != nil {
+		t.Errorf("unexpected access control policy: %v", put.AccessControlPolicy)
+	}
+
+	// the grants in XML
+	body := `<AccessControlPolicy><Owner><ID>owner-id</ID></Owner><AccessControlList><Grant>` +
+		`<Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>reader-id</ID></Grantee>` +
+		`<Permission>READ</Permission></Grant></AccessControlList></AccessControlPolicy>`
+	req, err = http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?acl", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	acp := put.AccessControlPolicy
+	if acp == nil || aws.StringValue(acp.Owner.ID) != "owner-id" || len(acp.Grants) != 1 {
+		t.Fatalf("unexpected access control policy: %v", acp)
+	}
+	if g := acp.Grants[0]; aws.StringValue(g.Grantee.Type) != "CanonicalUser" || aws.StringValue(g.Grantee.ID) != "reader-id" || aws.StringValue(g.Permission) != "READ" {
+		t.Errorf("unexpected grant: %v", g)
+	}
+}
+
+func TestRoundTrip_BucketACL(t *testing.T) {
+	var put *s3.PutBucketAclInput
+	mock := &s3mock{
+		getBucketAclWithContext: func(ctx context.Context, in *s3.GetBucketAclInput, _ ...request.Option) (*s3.GetBucketAclOutput, error) {
+			return &s3.GetBucketAclOutput{
+				Owner: &s3.Owner{ID: aws.String("owner-id")},
+			}, nil
+		},
+		putBucketAclWithContext: func(ctx context.Context, in *s3.PutBucketAclInput, _ ...request.Option) (*s3.PutBucketAclOutput, error) {
+			put = in
+			return &s3.PutBucketAclOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/?acl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Owner":{"ID":"owner-id"},"Grants":[]}`; string(data) != want {
+		t.Errorf("want %s, got %s", want, data)
+	}
+
+	body := `{"Owner":{"ID":"owner-id"},"Grants":[{"Grantee":{"Type":"Group","URI":"http://acs.amazonaws.com/groups/s3/LogDelivery"},"Permission":"WRITE"}]}`
+	req, err = http.NewRequest(http.MethodPut, "s3://bucket-name?acl", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if aws.StringValue(put.Bucket) != "bucket-name" || put.AccessControlPolicy == nil || len(put.AccessControlPolicy.Grants) != 1 {
+		t.Fatalf("unexpected input: %v", put)
+	}
+	if g := put.AccessControlPolicy.Grants[0]; aws.StringValue(g.Grantee.URI) != "http://acs.amazonaws.com/groups/s3/LogDelivery" || aws.StringValue(g.Permission) != "WRITE" {
+		t.Errorf("unexpected grant: %v", g)
+	}
+
+	// DELETE is not supported
+	req, err = http.NewRequest(http.MethodDelete, "s3://bucket-name/?acl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
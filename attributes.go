@@ -0,0 +1,130 @@
+package s3protocol
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// objectAttributes is the result of GetObjectAttributes exchanged in JSON or XML.
+type objectAttributes struct {
+	XMLName      xml.Name          `xml:"GetObjectAttributesResponse" json:"-"`
+	Xmlns        string            `xml:"xmlns,attr,omitempty" json:"-"`
+	ETag         *string           `xml:"ETag,omitempty" json:"ETag,omitempty"`
+	Checksum     *objectChecksum   `xml:"Checksum,omitempty" json:"Checksum,omitempty"`
+	ObjectParts  *objectAttrsParts `xml:"ObjectParts,omitempty" json:"ObjectParts,omitempty"`
+	StorageClass *string           `xml:"StorageClass,omitempty" json:"StorageClass,omitempty"`
+	ObjectSize   *int64            `xml:"ObjectSize,omitempty" json:"ObjectSize,omitempty"`
+}
+
+type objectChecksum struct {
+	ChecksumCRC32  *string `xml:"ChecksumCRC32,omitempty" json:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C *string `xml:"ChecksumCRC32C,omitempty" json:"ChecksumCRC32C,omitempty"`
+	ChecksumSHA1   *string `xml:"ChecksumSHA1,omitempty" json:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256 *string `xml:"ChecksumSHA256,omitempty" json:"ChecksumSHA256,omitempty"`
+}
+
+type objectAttrsParts struct {
+	IsTruncated          *bool        `xml:"IsTruncated,omitempty" json:"IsTruncated,omitempty"`
+	MaxParts             *int64       `xml:"MaxParts,omitempty" json:"MaxParts,omitempty"`
+	NextPartNumberMarker *int64       `xml:"NextPartNumberMarker,omitempty" json:"NextPartNumberMarker,omitempty"`
+	PartNumberMarker     *int64       `xml:"PartNumberMarker,omitempty" json:"PartNumberMarker,omitempty"`
+	Parts                []objectPart `xml:"Part" json:"Parts,omitempty"`
+	TotalPartsCount      *int64       `xml:"PartsCount,omitempty" json:"PartsCount,omitempty"`
+}
+
+type objectPart struct {
+	objectChecksum
+	PartNumber *int64 `xml:"PartNumber,omitempty" json:"PartNumber,omitempty"`
+	Size       *int64 `xml:"Size,omitempty" json:"Size,omitempty"`
+}
+
+// the attributes returned if x-amz-object-attributes is missing.
+var allObjectAttributes = []string{
+	s3.ObjectAttributesEtag,
+	s3.ObjectAttributesChecksum,
+	s3.ObjectAttributesObjectParts,
+	s3.ObjectAttributesStorageClass,
+	s3.ObjectAttributesObjectSize,
+}
+
+func (t *Transport) getObjectAttributes(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetObjectAttributesInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	if len(in.ObjectAttributes) == 0 {
+		in.ObjectAttributes = aws.StringSlice(allObjectAttributes)
+	}
+
+	// the query parameters are handy for paginating the parts.
+	query := req.URL.Query()
+	if v := query.Get("part-number-marker"); v != "" {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			in.PartNumberMarker = aws.Int64(i)
+		}
+	}
+	if v := query.Get("max-parts"); v != "" {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			in.MaxParts = aws.Int64(i)
+		}
+	}
+
+	out, err := svc.GetObjectAttributesWithContext(ctx, in)
+	header := makeHeaderFromGetObjectAttributesOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	body := objectAttributes{
+		Xmlns:        s3Namespace,
+		ETag:         out.ETag,
+		StorageClass: out.StorageClass,
+		ObjectSize:   out.ObjectSize,
+	}
+	if c := out.Checksum; c != nil {
+		body.Checksum = &objectChecksum{
+			ChecksumCRC32:  c.ChecksumCRC32,
+			ChecksumCRC32C: c.ChecksumCRC32C,
+			ChecksumSHA1:   c.ChecksumSHA1,
+			ChecksumSHA256: c.ChecksumSHA256,
+		}
+	}
+	if p := out.ObjectParts; p != nil {
+		body.ObjectParts = &objectAttrsParts{
+			IsTruncated:          p.IsTruncated,
+			MaxParts:             p.MaxParts,
+			NextPartNumberMarker: p.NextPartNumberMarker,
+			PartNumberMarker:     p.PartNumberMarker,
+			TotalPartsCount:      p.TotalPartsCount,
+		}
+		for _, part := range p.Parts {
+			body.ObjectParts.Parts = append(body.ObjectParts.Parts, objectPart{
+				objectChecksum: objectChecksum{
+					ChecksumCRC32:  part.ChecksumCRC32,
+					ChecksumCRC32C: part.ChecksumCRC32C,
+					ChecksumSHA1:   part.ChecksumSHA1,
+					ChecksumSHA256: part.ChecksumSHA256,
+				},
+				PartNumber: part.PartNumber,
+				Size:       part.Size,
+			})
+		}
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
@@ -0,0 +1,106 @@
+package s3protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRoundTrip_Attributes(t *testing.T) {
+	var got *s3.GetObjectAttributesInput
+	mock := &s3mock{
+		getObjectAttributesWithContext: func(ctx context.Context, in *s3.GetObjectAttributesInput, _ ...request.Option) (*s3.GetObjectAttributesOutput, error) {
+			got = in
+			return &s3.GetObjectAttributesOutput{
+				ETag:         aws.String("0123456789abcdef"),
+				ObjectSize:   aws.Int64(1234),
+				StorageClass: aws.String(s3.StorageClassStandard),
+				VersionId:    in.VersionId,
+				ObjectParts: &s3.GetObjectAttributesParts{
+					IsTruncated:          aws.Bool(true),
+					MaxParts:             in.MaxParts,
+					PartNumberMarker:     in.PartNumberMarker,
+					NextPartNumberMarker: aws.Int64(3),
+					TotalPartsCount:      aws.Int64(5),
+					Parts: []*s3.ObjectPart{
+						{PartNumber: aws.Int64(3), Size: aws.Int64(100), ChecksumCRC32: aws.String("AAAAAA==")},
+					},
+				},
+			}, nil
+		},
+	}
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", newTestTransport(mock, "bucket-name"))
+	c := &http.Client{Transport: tr}
+
+	// XML with pagination
+	resp, err := c.Get("s3://bucket-name/object-key?attributes&part-number-marker=2&max-parts=1&versionId=foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<GetObjectAttributesResponse xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` +
+		`<ETag>0123456789abcdef</ETag>` +
+		`<ObjectParts><IsTruncated>true</IsTruncated><MaxParts>1</MaxParts><NextPartNumberMarker>3</NextPartNumberMarker><PartNumberMarker>2</PartNumberMarker>` +
+		`<Part><ChecksumCRC32>AAAAAA==</ChecksumCRC32><PartNumber>3</PartNumber><Size>100</Size></Part><PartsCount>5</PartsCount></ObjectParts>` +
+		`<StorageClass>STANDARD</StorageClass><ObjectSize>1234</ObjectSize></GetObjectAttributesResponse>`
+	if string(body) != want {
+		t.Errorf("want %s, got %s", want, body)
+	}
+	if aws.Int64Value(got.PartNumberMarker) != 2 || aws.Int64Value(got.MaxParts) != 1 {
+		t.Errorf("unexpected pagination: marker %v, max %v", got.PartNumberMarker, got.MaxParts)
+	}
+	if aws.StringValue(got.VersionId) != "foobar" {
+		t.Errorf("unexpected version id: want %q, got %q", "foobar", aws.StringValue(got.VersionId))
+	}
+	if got := resp.Header.Get("X-Amz-Version-Id"); got != "foobar" {
+		t.Errorf("unexpected x-amz-version-id: want %q, got %q", "foobar", got)
+	}
+	if len(got.ObjectAttributes) != len(allObjectAttributes) {
+		t.Errorf("unexpected attributes: %v", aws.StringValueSlice(got.ObjectAttributes))
+	}
+
+	// JSON with the selected attributes
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?attributes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Amz-Object-Attributes", "ETag,ObjectSize")
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("unexpected Content-Type: %q", got)
+	}
+	if attrs := aws.StringValueSlice(got.ObjectAttributes); len(attrs) != 2 || attrs[0] != "ETag" || attrs[1] != "ObjectSize" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+	if aws.StringValue(got.SSECustomerAlgorithm) != "AES256" {
+		t.Errorf("unexpected SSE-C algorithm: %q", aws.StringValue(got.SSECustomerAlgorithm))
+	}
+	if got.PartNumberMarker != nil || got.MaxParts != nil {
+		t.Errorf("unexpected pagination: marker %v, max %v", got.PartNumberMarker, got.MaxParts)
+	}
+	want = `{"ETag":"0123456789abcdef","ObjectParts":{"IsTruncated":true,"NextPartNumberMarker":3,"Parts":[{"ChecksumCRC32":"AAAAAA==","PartNumber":3,"Size":100}],"PartsCount":5},"StorageClass":"STANDARD","ObjectSize":1234}`
+	if string(body) != want {
+		t.Errorf("want %s, got %s", want, body)
+	}
+}
@@ -0,0 +1,337 @@
+package s3protocol
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	defaultBlockSize      = 1024 * 1024
+	defaultBlockCacheSize = 64 * 1024 * 1024
+)
+
+// BlockCache caches fixed-size aligned blocks of S3 objects for random access reads.
+// Blocks are kept in memory, and optionally spilled to the disk when they are evicted from the memory.
+// The zero value is a valid cache with the default configuration.
+type BlockCache struct {
+	// BlockSize is the size of each block.
+	// If BlockSize is zero, 1 MiB is used.
+	BlockSize int64
+
+	// MaxBytes is the maximum size of the blocks in memory.
+	// If MaxBytes is zero, 64 MiB is used.
+	MaxBytes int64
+
+	// Dir is the directory for the on-disk tier.
+	// If Dir is empty, the on-disk tier is disabled.
+	Dir string
+
+	// MaxDiskBytes is the maximum size of the blocks on the disk.
+	// If MaxDiskBytes is zero, the on-disk tier is unlimited.
+	MaxDiskBytes int64
+
+	// Readahead is the number of blocks fetched in advance when sequential reading is detected.
+	Readahead int
+
+	mu       sync.Mutex
+	mem      lruList
+	disk     lruList
+	inflight map[blockKey]*blockCall
+	stats    BlockCacheStats
+}
+
+// BlockCacheStats is the statistics of BlockCache.
+type BlockCacheStats struct {
+	// Hits is the number of the blocks found in the cache.
+	Hits int64
+
+	// DiskHits is the number of the blocks found in the on-disk tier.
+	// They are also counted in Hits.
+	DiskHits int64
+
+	// Misses is the number of the blocks fetched from S3.
+	Misses int64
+
+	// Evictions is the number of the blocks evicted from the memory.
+	Evictions int64
+
+	// Bytes is the current size of the blocks in memory.
+	Bytes int64
+
+	// DiskBytes is the current size of the blocks on the disk.
+	DiskBytes int64
+}
+
+type blockKey struct {
+	bucket    string
+	key       string
+	versionID string
+	etag      string
+	index     int64
+}
+
+func (k blockKey) filename() string {
+	h := sha256.New()
+	for _, s := range []string{k.bucket, k.key, k.versionID, k.etag, strconv.FormatInt(k.index, 10)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type blockCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// lruList is a list of the blocks in least recently used order.
+type lruList struct {
+	ll    *list.List
+	items map[blockKey]*list.Element
+	bytes int64
+}
+
+type lruEntry struct {
+	key  blockKey
+	size int64
+	data []byte // nil in the on-disk tier
+}
+
+func (l *lruList) init() {
+	if l.ll == nil {
+		l.ll = list.New()
+		l.items = make(map[blockKey]*list.Element)
+	}
+}
+
+func (l *lruList) get(key blockKey) (*lruEntry, bool) {
+	l.init()
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(e)
+	return e.Value.(*lruEntry), true
+}
+
+func (l *lruList) add(entry *lruEntry) {
+	l.init()
+	if e, ok := l.items[entry.key]; ok {
+		l.remove(e.Value.(*lruEntry).key)
+	}
+	l.items[entry.key] = l.ll.PushFront(entry)
+	l.bytes += entry.size
+}
+
+func (l *lruList) remove(key blockKey) {
+	l.init()
+	if e, ok := l.items[key]; ok {
+		l.ll.Remove(e)
+		delete(l.items, key)
+		l.bytes -= e.Value.(*lruEntry).size
+	}
+}
+
+func (l *lruList) oldest() *lruEntry {
+	l.init()
+	e := l.ll.Back()
+	if e == nil {
+		return nil
+	}
+	return e.Value.(*lruEntry)
+}
+
+func (c *BlockCache) blockSize() int64 {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+	return defaultBlockSize
+}
+
+func (c *BlockCache) maxBytes() int64 {
+	if c.MaxBytes > 0 {
+		return c.MaxBytes
+	}
+	return defaultBlockCacheSize
+}
+
+// Stats returns the statistics of the cache.
+func (c *BlockCache) Stats() BlockCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Bytes = c.mem.bytes
+	stats.DiskBytes = c.disk.bytes
+	return stats
+}
+
+// load returns the block from the cache, or fetches it and caches it.
+// Concurrent loads of the same block share one fetch.
+// The disk I/O is done outside the lock, so readers of the cached blocks are not blocked by it.
+func (c *BlockCache) load(ctx context.Context, key blockKey, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	for {
+		if e, ok := c.mem.get(key); ok {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.data, nil
+		}
+		call, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if !isContextError(call.err) || ctx.Err() != nil {
+			return call.data, call.err
+		}
+		// the shared fetch was canceled by the caller that started it,
+		// but this caller is still alive, so it loads the block by itself.
+		c.mu.Lock()
+	}
+	if c.inflight == nil {
+		c.inflight = make(map[blockKey]*blockCall)
+	}
+	call := &blockCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	_, onDisk := c.disk.get(key)
+	if onDisk {
+		// take the block out of the on-disk tier, it is promoted into the memory.
+		c.disk.remove(key)
+	}
+	c.mu.Unlock()
+
+	var fromDisk bool
+	if onDisk {
+		call.data, call.err = c.readBlock(key)
+		fromDisk = call.err == nil
+	}
+	if !fromDisk {
+		call.data, call.err = fetch(ctx)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if fromDisk {
+		c.stats.Hits++
+		c.stats.DiskHits++
+	} else {
+		c.stats.Misses++
+	}
+	var evicted []*lruEntry
+	if call.err == nil {
+		evicted = c.addLocked(key, call.data)
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	c.spill(evicted)
+	return call.data, call.err
+}
+
+// isContextError reports whether err is caused by the cancellation of the context.
+// The SDK reports it as RequestCanceled.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errorCode(err) == request.CanceledErrorCode
+}
+
+// contains reports whether the block is in the cache or being fetched.
+func (c *BlockCache) contains(key blockKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mem.init()
+	c.disk.init()
+	_, inMem := c.mem.items[key]
+	_, onDisk := c.disk.items[key]
+	_, fetching := c.inflight[key]
+	return inMem || onDisk || fetching
+}
+
+// addLocked adds the block into the memory, and returns the evicted blocks to spill.
+func (c *BlockCache) addLocked(key blockKey, data []byte) []*lruEntry {
+	c.mem.add(&lruEntry{key: key, size: int64(len(data)), data: data})
+	maxBytes := c.maxBytes()
+	var evicted []*lruEntry
+	for c.mem.bytes > maxBytes {
+		e := c.mem.oldest()
+		c.mem.remove(e.key)
+		c.stats.Evictions++
+		if c.Dir != "" {
+			evicted = append(evicted, e)
+		}
+	}
+	return evicted
+}
+
+// readBlock reads the block from the on-disk tier, and removes the file.
+func (c *BlockCache) readBlock(key blockKey) ([]byte, error) {
+	name := filepath.Join(c.Dir, key.filename())
+	data, err := ioutil.ReadFile(name)
+	os.Remove(name)
+	return data, err
+}
+
+// spill writes the evicted blocks into the on-disk tier.
+func (c *BlockCache) spill(entries []*lruEntry) {
+	for _, e := range entries {
+		if c.MaxDiskBytes > 0 && e.size > c.MaxDiskBytes {
+			continue
+		}
+		if err := c.writeBlock(e.key, e.data); err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		c.disk.add(&lruEntry{key: e.key, size: e.size})
+		var removed []blockKey
+		for c.MaxDiskBytes > 0 && c.disk.bytes > c.MaxDiskBytes {
+			old := c.disk.oldest()
+			c.disk.remove(old.key)
+			removed = append(removed, old.key)
+		}
+		c.mu.Unlock()
+
+		for _, key := range removed {
+			os.Remove(filepath.Join(c.Dir, key.filename()))
+		}
+	}
+}
+
+// writeBlock writes the block into a temporary file and renames it,
+// so concurrent readers never see a partially written block.
+func (c *BlockCache) writeBlock(key blockKey, data []byte) error {
+	f, err := ioutil.TempFile(c.Dir, "block-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(c.Dir, key.filename())); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package s3protocol
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func newCountingObjectMock(data []byte, etag string, count *int32) *s3mock {
+	mock := newObjectMock(data, etag)
+	get := mock.getObjectWithContext
+	mock.getObjectWithContext = func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+		atomic.AddInt32(count, 1)
+		return get(ctx, in)
+	}
+	return mock
+}
+
+func TestBlockCache(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var count int32
+	tr := newTestTransport(newCountingObjectMock(data, `"etag"`, &count), "bucket-name")
+	cache := &BlockCache{BlockSize: 4}
+	tr.BlockCache = cache
+
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	p := make([]byte, 6)
+	if _, err := obj.ReadAt(p, 2); err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "234567" {
+		t.Errorf("want %q, got %q", "234567", string(p))
+	}
+	// the blocks 0 and 1 are fetched.
+	if stats := cache.Stats(); stats.Misses != 2 || stats.Hits != 0 || stats.Bytes != 8 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+
+	p = make([]byte, 3)
+	if _, err := obj.ReadAt(p, 5); err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "567" {
+		t.Errorf("want %q, got %q", "567", string(p))
+	}
+	if stats := cache.Stats(); stats.Misses != 2 || stats.Hits != 1 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+	if atomic.LoadInt32(&count) != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, count)
+	}
+
+	// the sequential reading.
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("want %q, got %q", string(data), string(got))
+	}
+}
+
+func TestBlockCache_Eviction(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var count int32
+	tr := newTestTransport(newCountingObjectMock(data, `"etag"`, &count), "bucket-name")
+	cache := &BlockCache{BlockSize: 4, MaxBytes: 8}
+	tr.BlockCache = cache
+
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	p := make([]byte, 4)
+	for _, off := range []int64{0, 4, 8, 0} {
+		if _, err := obj.ReadAt(p, off); err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != string(data[off:off+4]) {
+			t.Errorf("want %q, got %q", string(data[off:off+4]), string(p))
+		}
+	}
+
+	// the block 0 is evicted by the block 2, so it is fetched again.
+	stats := cache.Stats()
+	if stats.Misses != 4 || stats.Hits != 0 || stats.Evictions != 2 || stats.Bytes != 8 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+}
+
+func TestBlockCache_Disk(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var count int32
+	tr := newTestTransport(newCountingObjectMock(data, `"etag"`, &count), "bucket-name")
+	cache := &BlockCache{BlockSize: 4, MaxBytes: 8, Dir: t.TempDir()}
+	tr.BlockCache = cache
+
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	p := make([]byte, 4)
+	for _, off := range []int64{0, 4, 8, 0} {
+		if _, err := obj.ReadAt(p, off); err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != string(data[off:off+4]) {
+			t.Errorf("want %q, got %q", string(data[off:off+4]), string(p))
+		}
+	}
+
+	// the block 0 is served from the disk.
+	stats := cache.Stats()
+	if stats.Misses != 3 || stats.Hits != 1 || stats.DiskHits != 1 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+	if atomic.LoadInt32(&count) != 3 {
+		t.Errorf("unexpected request count: want %d, got %d", 3, count)
+	}
+}
+
+func TestBlockCache_Readahead(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var count int32
+	tr := newTestTransport(newCountingObjectMock(data, `"etag"`, &count), "bucket-name")
+	cache := &BlockCache{BlockSize: 4, Readahead: 2}
+	tr.BlockCache = cache
+
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	p := make([]byte, 4)
+	if _, err := io.ReadFull(obj, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the blocks 1 and 2 to be fetched in background.
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Stats().Bytes < 12 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&count) != 3 {
+		t.Errorf("unexpected request count: want %d, got %d", 3, count)
+	}
+
+	if _, err := io.ReadFull(obj, p); err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "4567" {
+		t.Errorf("want %q, got %q", "4567", string(p))
+	}
+	if stats := cache.Stats(); stats.Hits < 1 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+}
+
+func TestRoundTrip_GetObjectRangeBlockCache(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var count int32
+	tr := newTestTransport(newCountingObjectMock(data, `"etag"`, &count), "bucket-name")
+	cache := &BlockCache{BlockSize: 4}
+	tr.BlockCache = cache
+
+	get := func(rangeHeader string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", rangeHeader)
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("bytes=2-9")
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusPartialContent, resp.StatusCode)
+	}
+	if body != "23456789" {
+		t.Errorf("want %q, got %q", "23456789", body)
+	}
+	if got := resp.Header.Get("Content-Range"); got != "bytes 2-9/20" {
+		t.Errorf("unexpected Content-Range: want %q, got %q", "bytes 2-9/20", got)
+	}
+	if got := resp.Header.Get("Content-Length"); got != "8" {
+		t.Errorf("unexpected Content-Length: want %q, got %q", "8", got)
+	}
+
+	// the blocks 0, 1 and 2 are cached by the first request.
+	_, body = get("bytes=-15")
+	if body != "56789abcdefghij" {
+		t.Errorf("want %q, got %q", "56789abcdefghij", body)
+	}
+	if stats := cache.Stats(); stats.Misses != 5 || stats.Hits != 2 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+	if atomic.LoadInt32(&count) != 5 {
+		t.Errorf("unexpected request count: want %d, got %d", 5, count)
+	}
+}
+
+func TestBlockCache_CanceledFetch(t *testing.T) {
+	cache := &BlockCache{BlockSize: 4}
+	key := blockKey{bucket: "bucket-name", key: "object-key", index: 0}
+
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.load(ctx, key, func(ctx context.Context) ([]byte, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		first <- err
+	}()
+	<-started
+
+	// the second caller waits for the shared fetch.
+	second := make(chan []byte, 1)
+	go func() {
+		data, err := cache.load(context.Background(), key, func(ctx context.Context) ([]byte, error) {
+			return []byte("0123"), nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		second <- data
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// canceling the first caller doesn't fail the second one.
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+	if data := <-second; string(data) != "0123" {
+		t.Errorf("want %q, got %q", "0123", string(data))
+	}
+}
@@ -0,0 +1,580 @@
+package s3protocol
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// bucketHandler returns the handler for the request to the bucket root, such as s3://[BUCKET_NAME]/?versioning.
+// It reports false if the request is not for the bucket,
+// then the request is handled as the object with the empty name as before.
+// The handler is nil if the bucket doesn't support the request.
+func (t *Transport) bucketHandler(req *http.Request) (func(req *http.Request) (*http.Response, error), bool) {
+	query := req.URL.Query()
+	if _, ok := query["acl"]; ok {
+		return t.aclHandler(req), true
+	}
+	if _, ok := query["delete"]; ok {
+		if req.Method == http.MethodPost {
+			return t.deleteObjects, true
+		}
+		return nil, true
+	}
+	switch req.Method {
+	case http.MethodHead:
+		return t.headBucket, true
+	case http.MethodGet:
+		for _, sub := range []struct {
+			name string
+			fn   func(req *http.Request) (*http.Response, error)
+		}{
+			{"location", t.getBucketLocation},
+			{"versioning", t.getBucketVersioning},
+			{"policy", t.getBucketPolicy},
+			{"lifecycle", t.getBucketLifecycleConfiguration},
+			{"cors", t.getBucketCors},
+			{"encryption", t.getBucketEncryption},
+			{"tagging", t.getBucketTagging},
+			{"ownershipControls", t.getBucketOwnershipControls},
+			{"publicAccessBlock", t.getPublicAccessBlock},
+		} {
+			if _, ok := query[sub.name]; ok {
+				return sub.fn, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (t *Transport) headBucket(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newHeadBucketInput(req)
+	in.Bucket = &host
+	out, err := svc.HeadBucketWithContext(ctx, in)
+	header := makeHeaderFromHeadBucketOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
+
+// locationConstraint is the region of the bucket.
+// It is empty for us-east-1, as the S3 API.
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint" json:"-"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty" json:"-"`
+	Value   string   `xml:",chardata" json:"LocationConstraint"`
+}
+
+func (t *Transport) getBucketLocation(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketLocationInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketLocationWithContext(ctx, in)
+	header := makeHeaderFromGetBucketLocationOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := locationConstraint{
+		Xmlns: s3Namespace,
+		Value: aws.StringValue(out.LocationConstraint),
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+// versioningConfiguration is the versioning state of the bucket.
+type versioningConfiguration struct {
+	XMLName   xml.Name `xml:"VersioningConfiguration" json:"-"`
+	Xmlns     string   `xml:"xmlns,attr,omitempty" json:"-"`
+	MFADelete *string  `xml:"MfaDelete,omitempty" json:"MfaDelete,omitempty"`
+	Status    *string  `xml:"Status,omitempty" json:"Status,omitempty"`
+}
+
+func (t *Transport) getBucketVersioning(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketVersioningInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketVersioningWithContext(ctx, in)
+	header := makeHeaderFromGetBucketVersioningOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := versioningConfiguration{
+		Xmlns:     s3Namespace,
+		MFADelete: out.MFADelete,
+		Status:    out.Status,
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+// getBucketPolicy returns the bucket policy as is, because it is a JSON document regardless of the Accept header.
+func (t *Transport) getBucketPolicy(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketPolicyInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketPolicyWithContext(ctx, in)
+	header := makeHeaderFromGetBucketPolicyOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	policy := aws.StringValue(out.Policy)
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(policy)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(policy)),
+		ContentLength: int64(len(policy)),
+		Close:         true,
+	}, nil
+}
+
+// lifecycleConfiguration is the lifecycle rules of the bucket.
+// The elements are named as the S3 API, and the optional ones are omitted if they are not set.
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration" json:"-"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty" json:"-"`
+	Rules   []lifecycleRule `xml:"Rule" json:"Rule"`
+}
+
+type lifecycleRule struct {
+	AbortIncompleteMultipartUpload *abortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty" json:"AbortIncompleteMultipartUpload,omitempty"`
+	Expiration                     *lifecycleExpiration            `xml:"Expiration,omitempty" json:"Expiration,omitempty"`
+	Filter                         *lifecycleRuleFilter            `xml:"Filter,omitempty" json:"Filter,omitempty"`
+	ID                             *string                         `xml:"ID,omitempty" json:"ID,omitempty"`
+	NoncurrentVersionExpiration    *noncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration,omitempty" json:"NoncurrentVersionExpiration,omitempty"`
+	NoncurrentVersionTransitions   []noncurrentVersionTransition   `xml:"NoncurrentVersionTransition,omitempty" json:"NoncurrentVersionTransition,omitempty"`
+	Prefix                         *string                         `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Status                         *string                         `xml:"Status,omitempty" json:"Status,omitempty"`
+	Transitions                    []transition                    `xml:"Transition,omitempty" json:"Transition,omitempty"`
+}
+
+type abortIncompleteMultipartUpload struct {
+	DaysAfterInitiation *int64 `xml:"DaysAfterInitiation,omitempty" json:"DaysAfterInitiation,omitempty"`
+}
+
+type lifecycleExpiration struct {
+	Date                      *time.Time `xml:"Date,omitempty" json:"Date,omitempty"`
+	Days                      *int64     `xml:"Days,omitempty" json:"Days,omitempty"`
+	ExpiredObjectDeleteMarker *bool      `xml:"ExpiredObjectDeleteMarker,omitempty" json:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type lifecycleRuleFilter struct {
+	And                   *lifecycleRuleAndOperator `xml:"And,omitempty" json:"And,omitempty"`
+	ObjectSizeGreaterThan *int64                    `xml:"ObjectSizeGreaterThan,omitempty" json:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64                    `xml:"ObjectSizeLessThan,omitempty" json:"ObjectSizeLessThan,omitempty"`
+	Prefix                *string                   `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Tag                   *tag                      `xml:"Tag,omitempty" json:"Tag,omitempty"`
+}
+
+type lifecycleRuleAndOperator struct {
+	ObjectSizeGreaterThan *int64  `xml:"ObjectSizeGreaterThan,omitempty" json:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64  `xml:"ObjectSizeLessThan,omitempty" json:"ObjectSizeLessThan,omitempty"`
+	Prefix                *string `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Tags                  []tag   `xml:"Tag,omitempty" json:"Tag,omitempty"`
+}
+
+type noncurrentVersionExpiration struct {
+	NewerNoncurrentVersions *int64 `xml:"NewerNoncurrentVersions,omitempty" json:"NewerNoncurrentVersions,omitempty"`
+	NoncurrentDays          *int64 `xml:"NoncurrentDays,omitempty" json:"NoncurrentDays,omitempty"`
+}
+
+type noncurrentVersionTransition struct {
+	NewerNoncurrentVersions *int64  `xml:"NewerNoncurrentVersions,omitempty" json:"NewerNoncurrentVersions,omitempty"`
+	NoncurrentDays          *int64  `xml:"NoncurrentDays,omitempty" json:"NoncurrentDays,omitempty"`
+	StorageClass            *string `xml:"StorageClass,omitempty" json:"StorageClass,omitempty"`
+}
+
+type transition struct {
+	Date         *time.Time `xml:"Date,omitempty" json:"Date,omitempty"`
+	Days         *int64     `xml:"Days,omitempty" json:"Days,omitempty"`
+	StorageClass *string    `xml:"StorageClass,omitempty" json:"StorageClass,omitempty"`
+}
+
+func newLifecycleRule(v *s3.LifecycleRule) lifecycleRule {
+	rule := lifecycleRule{
+		ID:     v.ID,
+		Prefix: v.Prefix,
+		Status: v.Status,
+	}
+	if v.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteMultipartUpload = &abortIncompleteMultipartUpload{
+			DaysAfterInitiation: v.AbortIncompleteMultipartUpload.DaysAfterInitiation,
+		}
+	}
+	if v.Expiration != nil {
+		rule.Expiration = &lifecycleExpiration{
+			Date:                      v.Expiration.Date,
+			Days:                      v.Expiration.Days,
+			ExpiredObjectDeleteMarker: v.Expiration.ExpiredObjectDeleteMarker,
+		}
+	}
+	if f := v.Filter; f != nil {
+		rule.Filter = &lifecycleRuleFilter{
+			ObjectSizeGreaterThan: f.ObjectSizeGreaterThan,
+			ObjectSizeLessThan:    f.ObjectSizeLessThan,
+			Prefix:                f.Prefix,
+		}
+		if f.Tag != nil {
+			rule.Filter.Tag = &tag{
+				Key:   aws.StringValue(f.Tag.Key),
+				Value: aws.StringValue(f.Tag.Value),
+			}
+		}
+		if f.And != nil {
+			and := &lifecycleRuleAndOperator{
+				ObjectSizeGreaterThan: f.And.ObjectSizeGreaterThan,
+				ObjectSizeLessThan:    f.And.ObjectSizeLessThan,
+				Prefix:                f.And.Prefix,
+			}
+			for _, t := range f.And.Tags {
+				and.Tags = append(and.Tags, tag{
+					Key:   aws.StringValue(t.Key),
+					Value: aws.StringValue(t.Value),
+				})
+			}
+			rule.Filter.And = and
+		}
+	}
+	if v.NoncurrentVersionExpiration != nil {
+		rule.NoncurrentVersionExpiration = &noncurrentVersionExpiration{
+			NewerNoncurrentVersions: v.NoncurrentVersionExpiration.NewerNoncurrentVersions,
+			NoncurrentDays:          v.NoncurrentVersionExpiration.NoncurrentDays,
+		}
+	}
+	for _, t := range v.NoncurrentVersionTransitions {
+		rule.NoncurrentVersionTransitions = append(rule.NoncurrentVersionTransitions, noncurrentVersionTransition{
+			NewerNoncurrentVersions: t.NewerNoncurrentVersions,
+			NoncurrentDays:          t.NoncurrentDays,
+			StorageClass:            t.StorageClass,
+		})
+	}
+	for _, t := range v.Transitions {
+		rule.Transitions = append(rule.Transitions, transition{
+			Date:         t.Date,
+			Days:         t.Days,
+			StorageClass: t.StorageClass,
+		})
+	}
+	return rule
+}
+
+func (t *Transport) getBucketLifecycleConfiguration(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketLifecycleConfigurationInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketLifecycleConfigurationWithContext(ctx, in)
+	header := makeHeaderFromGetBucketLifecycleConfigurationOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := lifecycleConfiguration{
+		Xmlns: s3Namespace,
+		Rules: make([]lifecycleRule, 0, len(out.Rules)),
+	}
+	for _, v := range out.Rules {
+		body.Rules = append(body.Rules, newLifecycleRule(v))
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+// corsConfiguration is the CORS rules of the bucket.
+type corsConfiguration struct {
+	XMLName   xml.Name   `xml:"CORSConfiguration" json:"-"`
+	Xmlns     string     `xml:"xmlns,attr,omitempty" json:"-"`
+	CORSRules []corsRule `xml:"CORSRule" json:"CORSRule"`
+}
+
+type corsRule struct {
+	AllowedHeaders []string `xml:"AllowedHeader,omitempty" json:"AllowedHeader,omitempty"`
+	AllowedMethods []string `xml:"AllowedMethod" json:"AllowedMethod"`
+	AllowedOrigins []string `xml:"AllowedOrigin" json:"AllowedOrigin"`
+	ExposeHeaders  []string `xml:"ExposeHeader,omitempty" json:"ExposeHeader,omitempty"`
+	ID             *string  `xml:"ID,omitempty" json:"ID,omitempty"`
+	MaxAgeSeconds  *int64   `xml:"MaxAgeSeconds,omitempty" json:"MaxAgeSeconds,omitempty"`
+}
+
+func (t *Transport) getBucketCors(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketCorsInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketCorsWithContext(ctx, in)
+	header := makeHeaderFromGetBucketCorsOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := corsConfiguration{
+		Xmlns:     s3Namespace,
+		CORSRules: make([]corsRule, 0, len(out.CORSRules)),
+	}
+	for _, v := range out.CORSRules {
+		body.CORSRules = append(body.CORSRules, corsRule{
+			AllowedHeaders: aws.StringValueSlice(v.AllowedHeaders),
+			AllowedMethods: aws.StringValueSlice(v.AllowedMethods),
+			AllowedOrigins: aws.StringValueSlice(v.AllowedOrigins),
+			ExposeHeaders:  aws.StringValueSlice(v.ExposeHeaders),
+			ID:             v.ID,
+			MaxAgeSeconds:  v.MaxAgeSeconds,
+		})
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+// serverSideEncryptionConfiguration is the default encryption of the bucket.
+type serverSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `xml:"ServerSideEncryptionConfiguration" json:"-"`
+	Xmlns   string                     `xml:"xmlns,attr,omitempty" json:"-"`
+	Rules   []serverSideEncryptionRule `xml:"Rule" json:"Rule"`
+}
+
+type serverSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault *serverSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault,omitempty" json:"ApplyServerSideEncryptionByDefault,omitempty"`
+	BucketKeyEnabled                   *bool                          `xml:"BucketKeyEnabled,omitempty" json:"BucketKeyEnabled,omitempty"`
+}
+
+type serverSideEncryptionByDefault struct {
+	KMSMasterKeyID *string `xml:"KMSMasterKeyID,omitempty" json:"KMSMasterKeyID,omitempty"`
+	SSEAlgorithm   *string `xml:"SSEAlgorithm,omitempty" json:"SSEAlgorithm,omitempty"`
+}
+
+func (t *Transport) getBucketEncryption(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketEncryptionInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketEncryptionWithContext(ctx, in)
+	header := makeHeaderFromGetBucketEncryptionOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := serverSideEncryptionConfiguration{
+		Xmlns: s3Namespace,
+		Rules: []serverSideEncryptionRule{},
+	}
+	if config := out.ServerSideEncryptionConfiguration; config != nil {
+		for _, v := range config.Rules {
+			rule := serverSideEncryptionRule{
+				BucketKeyEnabled: v.BucketKeyEnabled,
+			}
+			if d := v.ApplyServerSideEncryptionByDefault; d != nil {
+				rule.ApplyServerSideEncryptionByDefault = &serverSideEncryptionByDefault{
+					KMSMasterKeyID: d.KMSMasterKeyID,
+					SSEAlgorithm:   d.SSEAlgorithm,
+				}
+			}
+			body.Rules = append(body.Rules, rule)
+		}
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+func (t *Transport) getBucketTagging(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketTaggingInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketTaggingWithContext(ctx, in)
+	header := makeHeaderFromGetBucketTaggingOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	// same as the tag set of the objects.
+	body := tagging{
+		Xmlns:  s3Namespace,
+		TagSet: make([]tag, 0, len(out.TagSet)),
+	}
+	for _, v := range out.TagSet {
+		body.TagSet = append(body.TagSet, tag{
+			Key:   aws.StringValue(v.Key),
+			Value: aws.StringValue(v.Value),
+		})
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+// ownershipControls is the object ownership of the bucket.
+type ownershipControls struct {
+	XMLName xml.Name                `xml:"OwnershipControls" json:"-"`
+	Xmlns   string                  `xml:"xmlns,attr,omitempty" json:"-"`
+	Rules   []ownershipControlsRule `xml:"Rule" json:"Rule"`
+}
+
+type ownershipControlsRule struct {
+	ObjectOwnership string `xml:"ObjectOwnership" json:"ObjectOwnership"`
+}
+
+func (t *Transport) getBucketOwnershipControls(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetBucketOwnershipControlsInput(req)
+	in.Bucket = &host
+	out, err := svc.GetBucketOwnershipControlsWithContext(ctx, in)
+	header := makeHeaderFromGetBucketOwnershipControlsOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := ownershipControls{
+		Xmlns: s3Namespace,
+		Rules: []ownershipControlsRule{},
+	}
+	if config := out.OwnershipControls; config != nil {
+		for _, v := range config.Rules {
+			body.Rules = append(body.Rules, ownershipControlsRule{
+				ObjectOwnership: aws.StringValue(v.ObjectOwnership),
+			})
+		}
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+// publicAccessBlockConfiguration is the public access block of the bucket.
+// The settings that are not set are omitted, rather than reported as false.
+type publicAccessBlockConfiguration struct {
+	XMLName               xml.Name `xml:"PublicAccessBlockConfiguration" json:"-"`
+	Xmlns                 string   `xml:"xmlns,attr,omitempty" json:"-"`
+	BlockPublicAcls       *bool    `xml:"BlockPublicAcls,omitempty" json:"BlockPublicAcls,omitempty"`
+	BlockPublicPolicy     *bool    `xml:"BlockPublicPolicy,omitempty" json:"BlockPublicPolicy,omitempty"`
+	IgnorePublicAcls      *bool    `xml:"IgnorePublicAcls,omitempty" json:"IgnorePublicAcls,omitempty"`
+	RestrictPublicBuckets *bool    `xml:"RestrictPublicBuckets,omitempty" json:"RestrictPublicBuckets,omitempty"`
+}
+
+func (t *Transport) getPublicAccessBlock(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetPublicAccessBlockInput(req)
+	in.Bucket = &host
+	out, err := svc.GetPublicAccessBlockWithContext(ctx, in)
+	header := makeHeaderFromGetPublicAccessBlockOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	body := publicAccessBlockConfiguration{
+		Xmlns: s3Namespace,
+	}
+	if config := out.PublicAccessBlockConfiguration; config != nil {
+		body.BlockPublicAcls = config.BlockPublicAcls
+		body.BlockPublicPolicy = config.BlockPublicPolicy
+		body.IgnorePublicAcls = config.IgnorePublicAcls
+		body.RestrictPublicBuckets = config.RestrictPublicBuckets
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
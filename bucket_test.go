@@ -0,0 +1,249 @@
+package s3protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func readTestResponse(t *testing.T, s3 *Transport, method, url, accept string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+func TestRoundTrip_HeadBucket(t *testing.T) {
+	var bucket string
+	var key *string
+	mock := &s3mock{
+		headBucketWithContext: func(ctx context.Context, in *s3.HeadBucketInput, _ ...request.Option) (*s3.HeadBucketOutput, error) {
+			bucket = aws.StringValue(in.Bucket)
+			return &s3.HeadBucketOutput{
+				BucketRegion: aws.String("ap-northeast-1"),
+			}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			t.Error("HeadObject must not be called")
+			return &s3.HeadObjectOutput{}, nil
+		},
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			key = in.Key
+			aerr := awserr.New("NoSuchKey", "The specified key does not exist.", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	for _, url := range []string{"s3://bucket-name/", "s3://bucket-name"} {
+		resp, _ := readTestResponse(t, s3, http.MethodHead, url, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: unexpected status: want %d, got %d", url, http.StatusOK, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Amz-Bucket-Region"); got != "ap-northeast-1" {
+			t.Errorf("%s: unexpected x-amz-bucket-region: want %q, got %q", url, "ap-northeast-1", got)
+		}
+		if bucket != "bucket-name" {
+			t.Errorf("%s: unexpected bucket: want %q, got %q", url, "bucket-name", bucket)
+		}
+	}
+
+	// GET without the subresource is still GetObject with the empty key, as before.
+	resp, _ := readTestResponse(t, s3, http.MethodGet, "s3://bucket-name/", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if key == nil || *key != "" {
+		t.Errorf("unexpected key: want %q, got %v", "", key)
+	}
+}
+
+func TestRoundTrip_BucketConfiguration(t *testing.T) {
+	mock := &s3mock{
+		getBucketLocationWithContext: func(ctx context.Context, in *s3.GetBucketLocationInput, _ ...request.Option) (*s3.GetBucketLocationOutput, error) {
+			return &s3.GetBucketLocationOutput{LocationConstraint: aws.String("ap-northeast-1")}, nil
+		},
+		getBucketVersioningWithContext: func(ctx context.Context, in *s3.GetBucketVersioningInput, _ ...request.Option) (*s3.GetBucketVersioningOutput, error) {
+			return &s3.GetBucketVersioningOutput{Status: aws.String(s3.BucketVersioningStatusEnabled)}, nil
+		},
+		getBucketPolicyWithContext: func(ctx context.Context, in *s3.GetBucketPolicyInput, _ ...request.Option) (*s3.GetBucketPolicyOutput, error) {
+			aerr := awserr.New("NoSuchBucketPolicy", "The bucket policy does not exist", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+		},
+		getBucketLifecycleConfigurationWithContext: func(ctx context.Context, in *s3.GetBucketLifecycleConfigurationInput, _ ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+			return &s3.GetBucketLifecycleConfigurationOutput{
+				Rules: []*s3.LifecycleRule{
+					{
+						ID:         aws.String("expire"),
+						Status:     aws.String(s3.ExpirationStatusEnabled),
+						Expiration: &s3.LifecycleExpiration{Date: aws.Time(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))},
+					},
+					{
+						ID:     aws.String("archive"),
+						Status: aws.String(s3.ExpirationStatusEnabled),
+						Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+						Transitions: []*s3.Transition{
+							{Days: aws.Int64(30), StorageClass: aws.String(s3.TransitionStorageClassGlacier)},
+						},
+					},
+				},
+			}, nil
+		},
+		getBucketCorsWithContext: func(ctx context.Context, in *s3.GetBucketCorsInput, _ ...request.Option) (*s3.GetBucketCorsOutput, error) {
+			return &s3.GetBucketCorsOutput{
+				CORSRules: []*s3.CORSRule{
+					{AllowedMethods: aws.StringSlice([]string{"GET", "HEAD"}), AllowedOrigins: aws.StringSlice([]string{"*"})},
+				},
+			}, nil
+		},
+		getBucketEncryptionWithContext: func(ctx context.Context, in *s3.GetBucketEncryptionInput, _ ...request.Option) (*s3.GetBucketEncryptionOutput, error) {
+			return &s3.GetBucketEncryptionOutput{
+				ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+					Rules: []*s3.ServerSideEncryptionRule{
+						{ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)}},
+					},
+				},
+			}, nil
+		},
+		getBucketTaggingWithContext: func(ctx context.Context, in *s3.GetBucketTaggingInput, _ ...request.Option) (*s3.GetBucketTaggingOutput, error) {
+			return &s3.GetBucketTaggingOutput{
+				TagSet: []*s3.Tag{{Key: aws.String("project"), Value: aws.String("s3protocol")}},
+			}, nil
+		},
+		getBucketOwnershipControlsWithContext: func(ctx context.Context, in *s3.GetBucketOwnershipControlsInput, _ ...request.Option) (*s3.GetBucketOwnershipControlsOutput, error) {
+			return &s3.GetBucketOwnershipControlsOutput{
+				OwnershipControls: &s3.OwnershipControls{
+					Rules: []*s3.OwnershipControlsRule{{ObjectOwnership: aws.String(s3.ObjectOwnershipBucketOwnerEnforced)}},
+				},
+			}, nil
+		},
+		getPublicAccessBlockWithContext: func(ctx context.Context, in *s3.GetPublicAccessBlockInput, _ ...request.Option) (*s3.GetPublicAccessBlockOutput, error) {
+			return &s3.GetPublicAccessBlockOutput{
+				PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+					BlockPublicAcls:   aws.Bool(true),
+					BlockPublicPolicy: aws.Bool(false),
+				},
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	const xmlns = `xmlns="http://s3.amazonaws.com/doc/2006-03-01/"`
+	tests := []struct {
+		query  string
+		accept string
+		want   string
+	}{
+		{
+			query: "location",
+			want:  xmlHeader + `<LocationConstraint ` + xmlns + `>ap-northeast-1</LocationConstraint>`,
+		},
+		{
+			query:  "location",
+			accept: "application/json",
+			want:   `{"LocationConstraint":"ap-northeast-1"}`,
+		},
+		{
+			query: "versioning",
+			want:  xmlHeader + `<VersioningConfiguration ` + xmlns + `><Status>Enabled</Status></VersioningConfiguration>`,
+		},
+		{
+			query: "lifecycle",
+			want: xmlHeader + `<LifecycleConfiguration ` + xmlns + `><Rule><Expiration><Date>2030-01-01T00:00:00Z</Date></Expiration>` +
+				`<ID>expire</ID><Status>Enabled</Status></Rule>` +
+				`<Rule><Filter><Prefix></Prefix></Filter><ID>archive</ID><Status>Enabled</Status>` +
+				`<Transition><Days>30</Days><StorageClass>GLACIER</StorageClass></Transition></Rule></LifecycleConfiguration>`,
+		},
+		{
+			query:  "lifecycle",
+			accept: "application/json",
+			want: `{"Rule":[{"Expiration":{"Date":"2030-01-01T00:00:00Z"},"ID":"expire","Status":"Enabled"},` +
+				`{"Filter":{"Prefix":""},"ID":"archive","Status":"Enabled","Transition":[{"Days":30,"StorageClass":"GLACIER"}]}]}`,
+		},
+		{
+			query:  "cors",
+			accept: "application/json",
+			want:   `{"CORSRule":[{"AllowedMethod":["GET","HEAD"],"AllowedOrigin":["*"]}]}`,
+		},
+		{
+			query: "encryption",
+			want: xmlHeader + `<ServerSideEncryptionConfiguration ` + xmlns + `><Rule><ApplyServerSideEncryptionByDefault>` +
+				`<SSEAlgorithm>AES256</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`,
+		},
+		{
+			query: "tagging",
+			want:  xmlHeader + `<Tagging ` + xmlns + `><TagSet><Tag><Key>project</Key><Value>s3protocol</Value></Tag></TagSet></Tagging>`,
+		},
+		{
+			query:  "ownershipControls",
+			accept: "application/json",
+			want:   `{"Rule":[{"ObjectOwnership":"BucketOwnerEnforced"}]}`,
+		},
+		{
+			query: "publicAccessBlock",
+			want:  xmlHeader + `<PublicAccessBlockConfiguration ` + xmlns + `><BlockPublicAcls>true</BlockPublicAcls><BlockPublicPolicy>false</BlockPublicPolicy></PublicAccessBlockConfiguration>`,
+		},
+		{
+			query:  "publicAccessBlock",
+			accept: "application/json",
+			want:   `{"BlockPublicAcls":true,"BlockPublicPolicy":false}`,
+		},
+	}
+	for _, tt := range tests {
+		resp, body := readTestResponse(t, s3, http.MethodGet, "s3://bucket-name/?"+tt.query, tt.accept)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: unexpected status: want %d, got %d", tt.query, http.StatusOK, resp.StatusCode)
+		}
+		if body != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.query, tt.want, body)
+		}
+	}
+
+	resp, _ := readTestResponse(t, s3, http.MethodGet, "s3://bucket-name/?policy", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorCodeHeader); got != "NoSuchBucketPolicy" {
+		t.Errorf("unexpected error code: want %q, got %q", "NoSuchBucketPolicy", got)
+	}
+}
+
+func TestRoundTrip_BucketPolicy(t *testing.T) {
+	const policy = `{"Version":"2012-10-17","Statement":[]}`
+	mock := &s3mock{
+		getBucketPolicyWithContext: func(ctx context.Context, in *s3.GetBucketPolicyInput, _ ...request.Option) (*s3.GetBucketPolicyOutput, error) {
+			return &s3.GetBucketPolicyOutput{Policy: aws.String(policy)}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	resp, body := readTestResponse(t, s3, http.MethodGet, "s3://bucket-name/?policy", "")
+	if body != policy {
+		t.Errorf("want %s, got %s", policy, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("unexpected Content-Type: %q", got)
+	}
+}
@@ -0,0 +1,423 @@
+package s3protocol
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const defaultResponseCacheSize = 64 * 1024 * 1024
+
+// ResponseCache caches the responses of GET requests.
+// Fresh entries are served without requests to S3,
+// and stale entries are revalidated with If-None-Match and the cached ETag.
+// The freshness lifetime comes from the Cache-Control of the object.
+// The zero value is a valid in-memory cache with the default configuration.
+type ResponseCache struct {
+	// Dir is the directory for storing the response bodies.
+	// If Dir is empty, the bodies are stored in memory.
+	Dir string
+
+	// MaxBytes is the maximum total size of the cached bodies.
+	// If MaxBytes is zero, 64 MiB is used.
+	MaxBytes int64
+
+	// MaxObjectSize is the maximum size of a cacheable object.
+	// If MaxObjectSize is zero, MaxBytes is used.
+	MaxObjectSize int64
+
+	// DefaultMaxAge is the freshness lifetime of the objects that have no max-age directive in their Cache-Control.
+	// If DefaultMaxAge is zero, such objects are revalidated on every request.
+	DefaultMaxAge time.Duration
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[responseCacheKey]*list.Element
+	bytes   int64
+
+	// gen is incremented on every purge.
+	// responses fetched before the purge are not stored.
+	gen uint64
+}
+
+type responseCacheKey struct {
+	bucket    string
+	key       string
+	versionID string
+}
+
+type responseCacheEntry struct {
+	key      responseCacheKey
+	header   http.Header
+	etag     string
+	size     int64
+	storedAt time.Time
+	expires  time.Time
+
+	// the body is stored in either data or file.
+	data []byte
+	file string
+}
+
+// isCacheable reports whether the response of the request can be stored in the cache.
+// Partial, conditional and customized requests bypass the cache.
+func isCacheable(in *s3.GetObjectInput) bool {
+	return in.Range == nil && in.PartNumber == nil &&
+		in.IfMatch == nil && in.IfNoneMatch == nil && in.IfModifiedSince == nil && in.IfUnmodifiedSince == nil &&
+		in.SSECustomerKey == nil && in.ChecksumMode == nil &&
+		in.ResponseCacheControl == nil && in.ResponseContentDisposition == nil && in.ResponseContentEncoding == nil &&
+		in.ResponseContentLanguage == nil && in.ResponseContentType == nil && in.ResponseExpires == nil
+}
+
+func (c *ResponseCache) maxBytes() int64 {
+	if c.MaxBytes > 0 {
+		return c.MaxBytes
+	}
+	return defaultResponseCacheSize
+}
+
+func (c *ResponseCache) maxObjectSize() int64 {
+	if c.MaxObjectSize > 0 {
+		return c.MaxObjectSize
+	}
+	return c.maxBytes()
+}
+
+func (c *ResponseCache) getObject(in *s3.GetObjectInput, fetch func(in *s3.GetObjectInput) (*http.Response, error)) (*http.Response, error) {
+	key := responseCacheKey{
+		bucket:    aws.StringValue(in.Bucket),
+		key:       aws.StringValue(in.Key),
+		versionID: aws.StringValue(in.VersionId),
+	}
+
+	now := time.Now()
+	entry, gen := c.get(key)
+	if entry != nil && now.Before(entry.expires) {
+		if resp, ok := entry.response(now); ok {
+			return resp, nil
+		}
+		c.remove(key)
+		entry = nil
+	}
+
+	if entry != nil {
+		// revalidate the stale entry.
+		rin := *in
+		rin.IfNoneMatch = aws.String(entry.etag)
+		resp, err := fetch(&rin)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			if entry := c.refresh(key, resp.Header, now); entry != nil {
+				if resp, ok := entry.response(now); ok {
+					return resp, nil
+				}
+			}
+			c.remove(key)
+			return fetch(in)
+		}
+		return c.store(key, resp, now, gen), nil
+	}
+
+	resp, err := fetch(in)
+	if err != nil {
+		return nil, err
+	}
+	return c.store(key, resp, now, gen), nil
+}
+
+// store wraps the body of the response to store it into the cache when it is read through.
+// gen is the generation of the cache before the request, and the body is not stored if the object is purged after that.
+func (c *ResponseCache) store(key responseCacheKey, resp *http.Response, now time.Time, gen uint64) *http.Response {
+	if resp.StatusCode != http.StatusOK {
+		return resp
+	}
+	maxAge, ok := c.maxAge(resp.Header)
+	if !ok {
+		return resp
+	}
+	etag := resp.Header.Get("Etag")
+	if etag == "" || resp.ContentLength < 0 || resp.ContentLength > c.maxObjectSize() {
+		return resp
+	}
+
+	w := &cacheWriter{
+		cache: c,
+		gen:   gen,
+		body:  resp.Body,
+		entry: &responseCacheEntry{
+			key:      key,
+			header:   resp.Header.Clone(),
+			etag:     etag,
+			size:     resp.ContentLength,
+			storedAt: now,
+			expires:  now.Add(maxAge),
+		},
+	}
+	if c.Dir != "" {
+		f, err := ioutil.TempFile(c.Dir, "s3protocol-")
+		if err != nil {
+			return resp
+		}
+		w.file = f
+		w.entry.file = f.Name()
+	} else {
+		w.buf = bytes.NewBuffer(make([]byte, 0, resp.ContentLength))
+	}
+	resp.Body = w
+	return resp
+}
+
+// maxAge returns the freshness lifetime of the response.
+// It returns false if the response must not be stored.
+func (c *ResponseCache) maxAge(header http.Header) (time.Duration, bool) {
+	maxAge := c.DefaultMaxAge
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store" || directive == "private":
+				return 0, false
+			case directive == "no-cache":
+				maxAge = 0
+			case strings.HasPrefix(directive, "max-age="):
+				sec, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+				if err == nil {
+					maxAge = time.Duration(sec) * time.Second
+				}
+			}
+		}
+	}
+	return maxAge, true
+}
+
+func (c *ResponseCache) init() {
+	if c.ll == nil {
+		c.ll = list.New()
+		c.entries = make(map[responseCacheKey]*list.Element)
+	}
+}
+
+// get returns a snapshot of the entry and the current generation.
+func (c *ResponseCache) get(key responseCacheKey) (*responseCacheEntry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen
+	}
+	c.ll.MoveToFront(e)
+	entry := *e.Value.(*responseCacheEntry)
+	return &entry, c.gen
+}
+
+// refresh updates the freshness of the entry revalidated by S3, and returns a snapshot of it.
+func (c *ResponseCache) refresh(key responseCacheKey, header http.Header, now time.Time) *responseCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*responseCacheEntry)
+
+	maxAge, ok := c.maxAge(entry.header)
+	if len(header.Values("Cache-Control")) > 0 {
+		maxAge, ok = c.maxAge(header)
+	}
+	if !ok {
+		c.removeLocked(key)
+		return nil
+	}
+	entry.storedAt = now
+	entry.expires = now.Add(maxAge)
+	snapshot := *entry
+	return &snapshot
+}
+
+// add adds the entry fetched at the generation gen.
+// It reports false if the cache is purged after that, and the entry is not added.
+func (c *ResponseCache) add(entry *responseCacheEntry, gen uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	if gen != c.gen {
+		// the object may be modified while fetching.
+		return false
+	}
+	c.removeLocked(entry.key)
+	c.entries[entry.key] = c.ll.PushFront(entry)
+	c.bytes += entry.size
+
+	maxBytes := c.maxBytes()
+	for c.bytes > maxBytes {
+		e := c.ll.Back()
+		if e == nil {
+			break
+		}
+		c.removeLocked(e.Value.(*responseCacheEntry).key)
+	}
+	return true
+}
+
+func (c *ResponseCache) remove(key responseCacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+func (c *ResponseCache) removeLocked(key responseCacheKey) {
+	c.init()
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*responseCacheEntry)
+	c.ll.Remove(e)
+	delete(c.entries, key)
+	c.bytes -= entry.size
+	if entry.file != "" {
+		os.Remove(entry.file)
+	}
+}
+
+// Purge removes all versions of the object from the cache.
+func (c *ResponseCache) Purge(bucket, key string) {
+	c.purge(func(k responseCacheKey) bool {
+		return k.bucket == bucket && k.key == key
+	})
+}
+
+// PurgePrefix removes the objects that have the prefix from the cache.
+func (c *ResponseCache) PurgePrefix(bucket, prefix string) {
+	c.purge(func(k responseCacheKey) bool {
+		return k.bucket == bucket && strings.HasPrefix(k.key, prefix)
+	})
+}
+
+func (c *ResponseCache) purge(match func(k responseCacheKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	c.gen++
+	for key := range c.entries {
+		if match(key) {
+			c.removeLocked(key)
+		}
+	}
+}
+
+func (entry *responseCacheEntry) response(now time.Time) (*http.Response, bool) {
+	var body io.ReadCloser
+	if entry.file != "" {
+		f, err := os.Open(entry.file)
+		if err != nil {
+			return nil, false
+		}
+		body = f
+	} else {
+		body = ioutil.NopCloser(bytes.NewReader(entry.data))
+	}
+
+	header := entry.header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(now.Sub(entry.storedAt)/time.Second), 10))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		Header:        header,
+		Body:          body,
+		ContentLength: entry.size,
+		Close:         true,
+	}, true
+}
+
+// cacheWriter stores the body into the cache while the body is read.
+type cacheWriter struct {
+	cache *ResponseCache
+	gen   uint64
+	body  io.ReadCloser
+	entry *responseCacheEntry
+
+	// the body is written into either buf or file.
+	buf  *bytes.Buffer
+	file *os.File
+
+	n      int64
+	failed bool
+	done   bool
+}
+
+func (w *cacheWriter) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 && !w.failed {
+		var werr error
+		if w.file != nil {
+			_, werr = w.file.Write(p[:n])
+		} else {
+			_, werr = w.buf.Write(p[:n])
+		}
+		w.n += int64(n)
+		if werr != nil || w.n > w.entry.size {
+			w.failed = true
+		}
+	}
+	if err == io.EOF {
+		w.commit()
+	}
+	return n, err
+}
+
+func (w *cacheWriter) commit() {
+	if w.done {
+		return
+	}
+	w.done = true
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			w.failed = true
+		}
+	}
+	if w.failed || w.n != w.entry.size {
+		w.discard()
+		return
+	}
+	if w.buf != nil {
+		w.entry.data = w.buf.Bytes()
+	}
+	if !w.cache.add(w.entry, w.gen) {
+		w.discard()
+	}
+}
+
+func (w *cacheWriter) discard() {
+	if w.file != nil {
+		w.file.Close()
+		os.Remove(w.file.Name())
+	}
+}
+
+func (w *cacheWriter) Close() error {
+	if !w.done {
+		// the body is not read through.
+		w.done = true
+		w.discard()
+	}
+	return w.body.Close()
+}
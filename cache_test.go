@@ -0,0 +1,208 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type cacheTestObject struct {
+	body         string
+	etag         string
+	cacheControl string
+	requests     []*s3.GetObjectInput
+}
+
+func (obj *cacheTestObject) mock() *s3mock {
+	return &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			obj.requests = append(obj.requests, in)
+			out := &s3.GetObjectOutput{
+				ETag:          aws.String(obj.etag),
+				ContentLength: aws.Int64(int64(len(obj.body))),
+				Body:          ioutil.NopCloser(bytes.NewReader([]byte(obj.body))),
+			}
+			if obj.cacheControl != "" {
+				out.CacheControl = aws.String(obj.cacheControl)
+			}
+			if aws.StringValue(in.IfNoneMatch) == obj.etag {
+				aerr := awserr.New("NotModified", "not modified", nil)
+				return out, awserr.NewRequestFailure(aerr, http.StatusNotModified, "request-id")
+			}
+			return out, nil
+		},
+	}
+}
+
+func getString(t *testing.T, c *http.Client, url string) string {
+	t.Helper()
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(got)
+}
+
+func newCacheTestClient(obj *cacheTestObject, cache *ResponseCache) *http.Client {
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+	s3.Cache = cache
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	return &http.Client{Transport: tr}
+}
+
+func TestResponseCache_Fresh(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		obj := &cacheTestObject{body: "Hello S3!", etag: `"etag"`, cacheControl: "max-age=60"}
+		c := newCacheTestClient(obj, &ResponseCache{Dir: dir})
+
+		for i := 0; i < 3; i++ {
+			if got := getString(t, c, "s3://bucket-name/object-key"); got != "Hello S3!" {
+				t.Errorf("want %q, got %q", "Hello S3!", got)
+			}
+		}
+		if len(obj.requests) != 1 {
+			t.Errorf("unexpected request count: want %d, got %d", 1, len(obj.requests))
+		}
+	}
+}
+
+func TestResponseCache_Revalidate(t *testing.T) {
+	obj := &cacheTestObject{body: "Hello S3!", etag: `"etag"`}
+	c := newCacheTestClient(obj, &ResponseCache{})
+
+	for i := 0; i < 2; i++ {
+		if got := getString(t, c, "s3://bucket-name/object-key"); got != "Hello S3!" {
+			t.Errorf("want %q, got %q", "Hello S3!", got)
+		}
+	}
+	if len(obj.requests) != 2 {
+		t.Fatalf("unexpected request count: want %d, got %d", 2, len(obj.requests))
+	}
+	if got := aws.StringValue(obj.requests[1].IfNoneMatch); got != `"etag"` {
+		t.Errorf("unexpected If-None-Match: want %q, got %q", `"etag"`, got)
+	}
+
+	// the object is modified.
+	obj.body = "Hello Amazon S3!"
+	obj.etag = `"modified"`
+	if got := getString(t, c, "s3://bucket-name/object-key"); got != "Hello Amazon S3!" {
+		t.Errorf("want %q, got %q", "Hello Amazon S3!", got)
+	}
+	if got := getString(t, c, "s3://bucket-name/object-key"); got != "Hello Amazon S3!" {
+		t.Errorf("want %q, got %q", "Hello Amazon S3!", got)
+	}
+	if got := aws.StringValue(obj.requests[3].IfNoneMatch); got != `"modified"` {
+		t.Errorf("unexpected If-None-Match: want %q, got %q", `"modified"`, got)
+	}
+}
+
+func TestResponseCache_NoStore(t *testing.T) {
+	obj := &cacheTestObject{body: "Hello S3!", etag: `"etag"`, cacheControl: "no-store"}
+	c := newCacheTestClient(obj, &ResponseCache{})
+
+	for i := 0; i < 2; i++ {
+		getString(t, c, "s3://bucket-name/object-key")
+	}
+	if len(obj.requests) != 2 {
+		t.Fatalf("unexpected request count: want %d, got %d", 2, len(obj.requests))
+	}
+	if obj.requests[1].IfNoneMatch != nil {
+		t.Errorf("unexpected If-None-Match: %q", aws.StringValue(obj.requests[1].IfNoneMatch))
+	}
+}
+
+func TestResponseCache_MaxObjectSize(t *testing.T) {
+	obj := &cacheTestObject{body: "Hello S3!", etag: `"etag"`, cacheControl: "max-age=60"}
+	c := newCacheTestClient(obj, &ResponseCache{MaxObjectSize: 5})
+
+	for i := 0; i < 2; i++ {
+		getString(t, c, "s3://bucket-name/object-key")
+	}
+	if len(obj.requests) != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, len(obj.requests))
+	}
+}
+
+func TestResponseCache_Purge(t *testing.T) {
+	obj := &cacheTestObject{body: "Hello S3!", etag: `"etag"`, cacheControl: "max-age=60"}
+	cache := &ResponseCache{}
+	c := newCacheTestClient(obj, cache)
+
+	getString(t, c, "s3://bucket-name/dir/object-key")
+	cache.Purge("bucket-name", "dir/object-key")
+	getString(t, c, "s3://bucket-name/dir/object-key")
+	cache.PurgePrefix("bucket-name", "dir/")
+	getString(t, c, "s3://bucket-name/dir/object-key")
+	getString(t, c, "s3://bucket-name/dir/object-key")
+
+	if len(obj.requests) != 3 {
+		t.Errorf("unexpected request count: want %d, got %d", 3, len(obj.requests))
+	}
+}
+
+func TestResponseCache_PutWhileReading(t *testing.T) {
+	obj := &cacheTestObject{body: "Hello S3!", etag: `"etag"`, cacheControl: "max-age=60"}
+	mock := obj.mock()
+	mock.putObjectWithContext = func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+		data, err := ioutil.ReadAll(in.Body)
+		if err != nil {
+			return nil, err
+		}
+		obj.body = string(data)
+		obj.etag = `"updated"`
+		return &s3.PutObjectOutput{ETag: aws.String(obj.etag)}, nil
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Cache = &ResponseCache{}
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	// GET starts before PUT, and finishes reading after PUT.
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello Updated S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	put, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", got)
+	}
+
+	// the old body must not be stored.
+	if got := getString(t, c, "s3://bucket-name/object-key"); got != "Hello Updated S3!" {
+		t.Errorf("want %q, got %q", "Hello Updated S3!", got)
+	}
+	if len(obj.requests) != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, len(obj.requests))
+	}
+}
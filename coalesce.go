@@ -0,0 +1,328 @@
+package s3protocol
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const defaultCoalesceBufferSize = 1024 * 1024
+
+// the headers that change the response of GetObject and HeadObject.
+var coalesceHeaders = []string{
+	"Range",
+	"If-Match",
+	"If-None-Match",
+	"If-Modified-Since",
+	"If-Unmodified-Since",
+	"If-Range",
+	"X-Amz-Server-Side-Encryption-Customer-Algorithm",
+	"X-Amz-Server-Side-Encryption-Customer-Key",
+	"X-Amz-Server-Side-Encryption-Customer-Key-Md5",
+	"X-Amz-Checksum-Mode",
+	"X-Amz-Request-Payer",
+	"X-Amz-Expected-Bucket-Owner",
+}
+
+var errBodyClosed = errors.New("s3protocol: read on closed response body")
+
+// flight is an upstream call shared by identical concurrent requests.
+type flight struct {
+	t      *Transport
+	key    [sha256.Size]byte
+	cancel context.CancelFunc
+
+	// done is closed when the response headers arrive.
+	done chan struct{}
+	resp *http.Response
+	err  error
+
+	body *sharedBody
+
+	mu   sync.Mutex
+	refs int
+	left bool // all readers have left
+}
+
+// sharedBody fans out the response body to the readers through a bounded buffer.
+// The upstream is read as fast as the slowest reader.
+type sharedBody struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	buf     []byte
+	base    int64 // the offset of buf[0]
+	err     error // io.EOF or the error of the upstream
+	readers map[*sharedReader]struct{}
+}
+
+type sharedReader struct {
+	f      *flight
+	off    int64
+	err    error
+	closed chan struct{}
+	once   sync.Once
+}
+
+// coalesceKey returns the key that identifies the identical requests.
+func coalesceKey(req *http.Request) [sha256.Size]byte {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	write(req.Method)
+	write(req.Host)
+	write(req.URL.Host)
+	write(req.URL.Path)
+	write(req.URL.RawQuery)
+	for _, name := range coalesceHeaders {
+		write(req.Header.Get(name))
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+func (t *Transport) coalesceBufferSize() int {
+	if t.CoalesceBufferSize > 0 {
+		return t.CoalesceBufferSize
+	}
+	return defaultCoalesceBufferSize
+}
+
+// coalesce shares one call of fn among the concurrent identical requests.
+func (t *Transport) coalesce(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		return t.doCoalesce(req, fn)
+	}
+}
+
+func (t *Transport) doCoalesce(req *http.Request, fn func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	key := coalesceKey(req)
+
+	t.flightsMu.Lock()
+	if t.flights == nil {
+		t.flights = make(map[[sha256.Size]byte]*flight)
+	}
+	f, ok := t.flights[key]
+	var r *sharedReader
+	if ok {
+		r = f.join()
+	}
+	if r == nil {
+		// the upstream call is detached from the context of the caller,
+		// so canceling the request cancels only its own copy.
+		ctx, cancel := context.WithCancel(context.Background())
+		f = &flight{
+			t:      t,
+			key:    key,
+			cancel: cancel,
+			done:   make(chan struct{}),
+			body: &sharedBody{
+				limit:   t.coalesceBufferSize(),
+				readers: make(map[*sharedReader]struct{}),
+			},
+		}
+		f.body.cond = sync.NewCond(&f.body.mu)
+		t.flights[key] = f
+		r = f.join()
+		go f.run(req.Clone(ctx), fn)
+	}
+	t.flightsMu.Unlock()
+
+	ctx := req.Context()
+	go r.watch(ctx)
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		r.Close()
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		r.Close()
+		return nil, f.err
+	}
+
+	resp := *f.resp
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = r
+	resp.Request = req
+	return &resp, nil
+}
+
+// join registers a new reader of the flight.
+// It returns nil if the flight has already discarded the head of the body.
+func (f *flight) join() *sharedReader {
+	b := f.body
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.base > 0 || b.err != nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.left {
+		return nil
+	}
+	f.refs++
+
+	r := &sharedReader{
+		f:      f,
+		closed: make(chan struct{}),
+	}
+	b.readers[r] = struct{}{}
+	return r
+}
+
+func (f *flight) release() {
+	f.mu.Lock()
+	f.refs--
+	left := f.refs == 0
+	f.left = left
+	f.mu.Unlock()
+	if left {
+		f.cancel()
+		f.forget()
+	}
+}
+
+// forget removes the flight from the transport, so new requests make a new flight.
+func (f *flight) forget() {
+	f.t.flightsMu.Lock()
+	defer f.t.flightsMu.Unlock()
+	if f.t.flights[f.key] == f {
+		delete(f.t.flights, f.key)
+	}
+}
+
+func (f *flight) run(req *http.Request, fn func(req *http.Request) (*http.Response, error)) {
+	resp, err := fn(req)
+	f.resp, f.err = resp, err
+	close(f.done)
+
+	b := f.body
+	if err != nil {
+		b.mu.Lock()
+		b.err = err
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		f.forget()
+		return
+	}
+	b.pump(resp.Body)
+	f.forget()
+}
+
+// pump reads the upstream body into the buffer.
+func (b *sharedBody) pump(src io.ReadCloser) {
+	defer src.Close()
+
+	chunk := make([]byte, 32*1024)
+	for {
+		b.mu.Lock()
+		for {
+			if len(b.readers) == 0 {
+				b.err = errBodyClosed
+				b.mu.Unlock()
+				return
+			}
+			b.trimLocked()
+			if len(b.buf) < b.limit {
+				break
+			}
+			b.cond.Wait()
+		}
+		n := b.limit - len(b.buf)
+		b.mu.Unlock()
+
+		if n > len(chunk) {
+			n = len(chunk)
+		}
+		n, err := src.Read(chunk[:n])
+
+		b.mu.Lock()
+		b.buf = append(b.buf, chunk[:n]...)
+		if err != nil {
+			b.err = err
+		}
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// trimLocked discards the data that all readers have read.
+func (b *sharedBody) trimLocked() {
+	min := b.base + int64(len(b.buf))
+	for r := range b.readers {
+		if r.off < min {
+			min = r.off
+		}
+	}
+	if d := int(min - b.base); d > 0 {
+		b.buf = append(b.buf[:0], b.buf[d:]...)
+		b.base = min
+	}
+}
+
+// watch closes the reader when the context of its request is canceled.
+func (r *sharedReader) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		b := r.f.body
+		b.mu.Lock()
+		if r.err == nil {
+			r.err = ctx.Err()
+		}
+		b.mu.Unlock()
+		r.Close()
+	case <-r.closed:
+	}
+}
+
+// Read implements io.Reader.
+func (r *sharedReader) Read(p []byte) (int, error) {
+	b := r.f.body
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if end := b.base + int64(len(b.buf)); r.off < end {
+			n := copy(p, b.buf[r.off-b.base:])
+			r.off += int64(n)
+			b.cond.Broadcast()
+			return n, nil
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.cond.Wait()
+	}
+}
+
+// Close implements io.Closer.
+func (r *sharedReader) Close() error {
+	r.once.Do(func() {
+		b := r.f.body
+		b.mu.Lock()
+		if r.err == nil {
+			r.err = errBodyClosed
+		}
+		delete(b.readers, r)
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		close(r.closed)
+		r.f.release()
+	})
+	return nil
+}
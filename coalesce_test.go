@@ -0,0 +1,220 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// waitForRefs waits for the number of the callers sharing the flight to be n.
+func waitForRefs(t *testing.T, tr *Transport, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		tr.flightsMu.Lock()
+		refs := 0
+		for _, f := range tr.flights {
+			f.mu.Lock()
+			refs += f.refs
+			f.mu.Unlock()
+		}
+		tr.flightsMu.Unlock()
+		if refs == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timeout: waiting for %d callers", n)
+}
+
+func TestCoalesce(t *testing.T) {
+	data := bytes.Repeat([]byte("Hello S3!"), 1000)
+	var count int32
+	release := make(chan struct{})
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			atomic.AddInt32(&count, 1)
+			<-release
+			return &s3.GetObjectOutput{
+				ETag:          aws.String(`"etag"`),
+				ContentLength: aws.Int64(int64(len(data))),
+				Body:          ioutil.NopCloser(bytes.NewReader(data)),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.CoalesceRequests = true
+	s3.CoalesceBufferSize = 100
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	const n = 5
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get("s3://bucket-name/object-key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			got, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("unexpected body: got %d bytes", len(got))
+			}
+			if resp.Header.Get("ETag") != `"etag"` {
+				t.Errorf("unexpected ETag: want %q, got %q", `"etag"`, resp.Header.Get("ETag"))
+			}
+		}()
+	}
+	waitForRefs(t, s3, n)
+	close(release)
+	wg.Wait()
+
+	if atomic.LoadInt32(&count) != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, count)
+	}
+
+	// the completed flight is not shared.
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if atomic.LoadInt32(&count) != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, count)
+	}
+}
+
+func TestCoalesce_DifferentRange(t *testing.T) {
+	var count int32
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			atomic.AddInt32(&count, 1)
+			return &s3.GetObjectOutput{
+				Body: ioutil.NopCloser(bytes.NewReader([]byte(aws.StringValue(in.Range)))),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.CoalesceRequests = true
+
+	req1, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req1.Header.Set("Range", "bytes=0-9")
+	req2 := req1.Clone(context.Background())
+	req2.Header.Set("Range", "bytes=10-19")
+	if coalesceKey(req1) == coalesceKey(req2) {
+		t.Error("requests with different ranges must not be identical")
+	}
+
+	resp1, err := s3.RoundTrip(req1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp1.Body.Close()
+	resp2, err := s3.RoundTrip(req2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	got1, _ := ioutil.ReadAll(resp1.Body)
+	got2, _ := ioutil.ReadAll(resp2.Body)
+	if string(got1) != "bytes=0-9" || string(got2) != "bytes=10-19" {
+		t.Errorf("unexpected bodies: %q, %q", got1, got2)
+	}
+}
+
+func TestCoalesce_Cancel(t *testing.T) {
+	data := bytes.Repeat([]byte("Hello S3!"), 1000)
+	release := make(chan struct{})
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			<-release
+			return &s3.GetObjectOutput{
+				ContentLength: aws.Int64(int64(len(data))),
+				Body:          ioutil.NopCloser(bytes.NewReader(data)),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.CoalesceRequests = true
+	s3.CoalesceBufferSize = 100
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req1, err := http.NewRequestWithContext(ctx, http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req2, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	ch1 := make(chan result, 1)
+	ch2 := make(chan result, 1)
+	go func() {
+		resp, err := s3.RoundTrip(req1)
+		ch1 <- result{resp, err}
+	}()
+	go func() {
+		resp, err := s3.RoundTrip(req2)
+		ch2 <- result{resp, err}
+	}()
+	waitForRefs(t, s3, 2)
+	close(release)
+
+	r1 := <-ch1
+	if r1.err != nil {
+		t.Fatal(r1.err)
+	}
+	defer r1.resp.Body.Close()
+	r2 := <-ch2
+	if r2.err != nil {
+		t.Fatal(r2.err)
+	}
+	defer r2.resp.Body.Close()
+
+	// the first caller stops reading and cancels its request.
+	p := make([]byte, 10)
+	if _, err := r1.resp.Body.Read(p); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// the second caller can read the whole body.
+	got, err := ioutil.ReadAll(r2.resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("unexpected body: got %d bytes", len(got))
+	}
+
+	if _, err := ioutil.ReadAll(r1.resp.Body); err != context.Canceled {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+}
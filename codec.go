@@ -0,0 +1,100 @@
+package s3protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// s3Namespace is the XML namespace of the S3 API.
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// the maximum size of the request bodies decoded by decodeRequest.
+const maxRequestBodySize = 1 << 20
+
+// isJSON reports whether the media type is JSON.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// acceptsJSON reports whether the client asks for JSON rather than XML by the Accept header.
+func acceptsJSON(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Accept"), ",") {
+		if isJSON(strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRequest decodes the request body as JSON or XML by the Content-Type header.
+// XML is the default, as the S3 API.
+func decodeRequest(req *http.Request, v interface{}) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return fmt.Errorf("s3protocol: request body is empty")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, maxRequestBodySize))
+	if err != nil {
+		return err
+	}
+	if isJSON(req.Header.Get("Content-Type")) {
+		err = json.Unmarshal(data, v)
+	} else {
+		err = xml.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("s3protocol: invalid request body: %w", err)
+	}
+	return nil
+}
+
+// encodeResponse returns the response with v encoded as JSON or XML by the Accept header.
+// XML is the default, as the S3 API.
+func encodeResponse(req *http.Request, code int, header http.Header, v interface{}) (*http.Response, error) {
+	var data []byte
+	var err error
+	var contentType string
+	if acceptsJSON(req) {
+		data, err = json.Marshal(v)
+		contentType = "application/json"
+	} else {
+		data, err = xml.Marshal(v)
+		data = append([]byte(xml.Header), data...)
+		contentType = "application/xml"
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dataResponse(code, header, contentType, data), nil
+}
+
+// dataResponse returns the response with the body.
+func dataResponse(code int, header http.Header, contentType string, data []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Close:         true,
+	}
+}
@@ -51,6 +51,8 @@ func (g *Generator) generate() error {
 		"net/http"
 		"net/url"
 		"strconv"
+		"strings"
+		"time"
 	
 		"github.com/aws/aws-sdk-go/aws"
 		"github.com/aws/aws-sdk-go/service/s3"
@@ -62,12 +64,177 @@ func (g *Generator) generate() error {
 	if err := g.generateInput(s3.HeadObjectInput{}); err != nil {
 		return err
 	}
+	if err := g.generateInput(s3.PutObjectInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.DeleteObjectInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.RestoreObjectInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetObjectTaggingInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.PutObjectTaggingInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.DeleteObjectTaggingInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetObjectAttributesInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetObjectRetentionInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.PutObjectRetentionInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetObjectLegalHoldInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.PutObjectLegalHoldInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetObjectAclInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.PutObjectAclInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketAclInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.PutBucketAclInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.HeadBucketInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketLocationInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketVersioningInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketPolicyInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketLifecycleConfigurationInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketCorsInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketEncryptionInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketTaggingInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetBucketOwnershipControlsInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.GetPublicAccessBlockInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.CopyObjectInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.CreateMultipartUploadInput{}); err != nil {
+		return err
+	}
+	if err := g.generateInput(s3.DeleteObjectsInput{}); err != nil {
+		return err
+	}
 	if err := g.generateOutput(s3.GetObjectOutput{}); err != nil {
 		return err
 	}
 	if err := g.generateOutput(s3.HeadObjectOutput{}); err != nil {
 		return err
 	}
+	if err := g.generateOutput(s3.PutObjectOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.DeleteObjectOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.RestoreObjectOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetObjectTaggingOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.PutObjectTaggingOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.DeleteObjectTaggingOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetObjectAttributesOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetObjectRetentionOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.PutObjectRetentionOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetObjectLegalHoldOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.PutObjectLegalHoldOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetObjectAclOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.PutObjectAclOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketAclOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.PutBucketAclOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.HeadBucketOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketLocationOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketVersioningOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketPolicyOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketLifecycleConfigurationOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketCorsOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketEncryptionOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketTaggingOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetBucketOwnershipControlsOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.GetPublicAccessBlockOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.CopyObjectOutput{}); err != nil {
+		return err
+	}
+	if err := g.generateOutput(s3.CompleteMultipartUploadOutput{}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -83,12 +250,18 @@ func (g *Generator) generateInput(target interface{}) error {
 	if header == nil {
 		header = make(http.Header)
 	}
-	query, err := url.ParseQuery(req.URL.RawQuery)
-	if err != nil {
-		query = make(url.Values)
-	}
 	`)
 	num := typ.NumField()
+	for i := 0; i < num; i++ {
+		if typ.Field(i).Tag.Get("location") == "querystring" {
+			g.Printf(`query, err := url.ParseQuery(req.URL.RawQuery)
+			if err != nil {
+				query = make(url.Values)
+			}
+			`)
+			break
+		}
+	}
 	for i := 0; i < num; i++ {
 		f := typ.Field(i)
 		tag := f.Tag
@@ -99,11 +272,43 @@ func (g *Generator) generateInput(target interface{}) error {
 			g.Printf("if v, ok := header[%q]; ok && len(v) > 0 {\n", name)
 		case "querystring":
 			g.Printf("if v, ok := query[%q]; ok && len(v) > 0 {\n", name)
+		case "headers":
+			g.Printf(`for k, v := range header {
+				if len(v) == 0 || !strings.HasPrefix(strings.ToLower(k), %[1]q) {
+					continue
+				}
+				if in.%[2]s == nil {
+					in.%[2]s = make(map[string]*string)
+				}
+				in.%[2]s[k[len(%[1]q):]] = aws.String(v[0])
+			}
+			`, name, f.Name)
+			continue
 		default:
 			continue
 		}
 
+		if f.Type.Kind() == reflect.Slice {
+			if f.Type.Elem().Elem().Kind() != reflect.String {
+				return fmt.Errorf("unknown type: %v", f.Type)
+			}
+			// the list is a comma-separated string.
+			g.Printf(`for _, s := range strings.Split(strings.Join(v, ","), ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					in.%s = append(in.%s, aws.String(s))
+				}
+			}
+			}
+			`, f.Name, f.Name)
+			continue
+		}
 		switch f.Type.Elem().Kind() {
+		case reflect.Bool:
+			g.Printf(`b, err := strconv.ParseBool(v[0])
+			if err == nil {
+				in.%s = aws.Bool(b)
+			}
+			`, f.Name)
 		case reflect.String:
 			g.Printf("in.%s = aws.String(v[0])\n", f.Name)
 		case reflect.Int64:
@@ -113,7 +318,13 @@ func (g *Generator) generateInput(target interface{}) error {
 			}
 			`, f.Name)
 		case reflect.Struct:
-			if f.Type.Elem() == typeTime {
+			if f.Type.Elem() == typeTime && tag.Get("timestampFormat") == "iso8601" {
+				g.Printf(`t, err := time.Parse(time.RFC3339, v[0])
+				if err == nil {
+					in.%s = aws.Time(t)
+				}
+				`, f.Name)
+			} else if f.Type.Elem() == typeTime {
 				g.Printf(`t, err := http.ParseTime(v[0])
 				if err == nil {
 					in.%s = aws.Time(t)
@@ -155,7 +366,9 @@ func (g *Generator) generateOutput(target interface{}) error {
 		case reflect.Int64:
 			g.Printf("header.Set(%q, strconv.FormatInt(aws.Int64Value(out.%s), 10))\n", name, f.Name)
 		case reflect.Struct:
-			if f.Type.Elem() == typeTime {
+			if f.Type.Elem() == typeTime && tag.Get("timestampFormat") == "iso8601" {
+				g.Printf("header.Set(%q, out.%s.UTC().Format(time.RFC3339))\n", name, f.Name)
+			} else if f.Type.Elem() == typeTime {
 				g.Printf("header.Set(%q, out.%s.Format(http.TimeFormat))\n", name, f.Name)
 			} else {
 				return fmt.Errorf("unknown type: %v", f.Type.Elem())
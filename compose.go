@@ -0,0 +1,570 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ComposeSource is a source object of Compose.
+type ComposeSource struct {
+	// URL is the source object in the form of s3://[BUCKET_NAME]/[OBJECT_NAME]?versionId=[VERSION_ID].
+	URL string `xml:"URL" json:"URL"`
+
+	// Range is the byte range of the source in the form of the Range header, such as "bytes=0-1023".
+	// If Range is empty, the whole object is used.
+	Range string `xml:"Range,omitempty" json:"Range,omitempty"`
+
+	// SSECustomerAlgorithm, SSECustomerKey and SSECustomerKeyMD5 are the customer-provided key
+	// of the source encrypted with SSE-C.
+	// They are not read from the manifest of POST ?compose;
+	// the x-amz-copy-source-server-side-encryption-customer-* headers of the request are used for all sources instead.
+	SSECustomerAlgorithm string `xml:"-" json:"-"`
+	SSECustomerKey       string `xml:"-" json:"-"`
+	SSECustomerKeyMD5    string `xml:"-" json:"-"`
+}
+
+// ComposeResult is the result of Compose.
+type ComposeResult struct {
+	// ETag is the entity tag of the composed object.
+	ETag string
+
+	// VersionID is the version id of the composed object.
+	VersionID string
+}
+
+// composeManifest is the request body of POST ?compose exchanged in JSON or XML.
+type composeManifest struct {
+	XMLName xml.Name        `xml:"Compose" json:"-"`
+	Sources []ComposeSource `xml:"Source" json:"Sources"`
+}
+
+// composeObjectResult is the response of POST ?compose, same as CompleteMultipartUpload.
+type composeObjectResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult" json:"-"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty" json:"-"`
+	Bucket  string   `xml:"Bucket" json:"Bucket"`
+	Key     string   `xml:"Key" json:"Key"`
+	ETag    string   `xml:"ETag,omitempty" json:"ETag,omitempty"`
+}
+
+// Compose concatenates the sources into the object of dstURL.
+// The url is in the form of s3://[BUCKET_NAME]/[OBJECT_NAME].
+//
+// The object is built by a multipart upload, and the sources are copied by UploadPartCopy on the server side.
+// The sources smaller than the minimum part size, 5 MiB, are downloaded and uploaded together with the adjacent sources.
+// The composed object has the content type of the first source.
+// The reads of the sources are pinned to their ETags, and the upload is aborted on failure.
+func (t *Transport) Compose(ctx context.Context, dstURL string, sources []ComposeSource) (*ComposeResult, error) {
+	dst, err := parseObjectURL(dstURL)
+	if err != nil {
+		return nil, err
+	}
+	out, err := t.compose(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(dst.bucket),
+		Key:    aws.String(dst.key),
+	}, sources)
+	if err != nil {
+		return nil, err
+	}
+	return &ComposeResult{
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionId),
+	}, nil
+}
+
+// composeObject handles POST ?compose.
+// The sources are given by the manifest in the request body, and the relative URLs are resolved against the request URL.
+// The Content-Type header is the type of the manifest, so the composed object has the content type of the first source.
+func (t *Transport) composeObject(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	var manifest composeManifest
+	if err := decodeRequest(req, &manifest); err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+	if len(manifest.Sources) == 0 {
+		return textResponse(http.StatusBadRequest, nil, "s3protocol: no compose sources\n"), nil
+	}
+	for i, src := range manifest.Sources {
+		u, err := req.URL.Parse(src.URL)
+		if err != nil {
+			return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+		}
+		if _, err := parseObjectURL(u.String()); err != nil {
+			return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+		}
+		manifest.Sources[i].URL = u.String()
+		manifest.Sources[i].SSECustomerAlgorithm = req.Header.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm")
+		manifest.Sources[i].SSECustomerKey = req.Header.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key")
+		manifest.Sources[i].SSECustomerKeyMD5 = req.Header.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-MD5")
+	}
+
+	in := newCreateMultipartUploadInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	in.ContentType = nil // it is the type of the manifest.
+	out, err := t.compose(req.Context(), in, manifest.Sources)
+	header := makeHeaderFromCompleteMultipartUploadOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return encodeResponse(req, http.StatusOK, header, &composeObjectResult{
+		Xmlns:  s3Namespace,
+		Bucket: host,
+		Key:    path,
+		ETag:   aws.StringValue(out.ETag),
+	})
+}
+
+// composeSegment is the byte range [start, end) of the source object.
+type composeSegment struct {
+	svc         s3iface.S3API
+	src         objectRef
+	etag        *string
+	contentType *string
+	start       int64
+	end         int64
+
+	// the customer-provided key of the source.
+	sseAlgorithm *string
+	sseKey       *string
+	sseKeyMD5    *string
+}
+
+func (seg composeSegment) size() int64 {
+	return seg.end - seg.start
+}
+
+func (seg composeSegment) byteRange() string {
+	return fmt.Sprintf("bytes=%d-%d", seg.start, seg.end-1)
+}
+
+// composePart is a part of the composed object.
+// The copied part has the only segment copied by UploadPartCopy,
+// and the other parts are downloaded and uploaded by UploadPart.
+type composePart struct {
+	copy     bool
+	segments []composeSegment
+}
+
+func invalidByteRange(s string) error {
+	aerr := awserr.New("InvalidArgument", fmt.Sprintf("s3protocol: invalid range %q", s), nil)
+	return awserr.NewRequestFailure(aerr, http.StatusBadRequest, "")
+}
+
+// parseByteRange parses the range in the form of "bytes=first-last", "bytes=first-" or "bytes=-suffix",
+// and returns [start, end) in the object of the size.
+func parseByteRange(s string, size int64) (int64, int64, error) {
+	if s == "" {
+		return 0, size, nil
+	}
+	spec := strings.TrimPrefix(s, "bytes=")
+	idx := strings.IndexByte(spec, '-')
+	if spec == s || idx < 0 {
+		return 0, 0, invalidByteRange(s)
+	}
+	first, last := spec[:idx], spec[idx+1:]
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, invalidByteRange(s)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, invalidByteRange(s)
+	}
+	end := size
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < start {
+			return 0, 0, invalidByteRange(s)
+		}
+		if n+1 < end {
+			end = n + 1
+		}
+	}
+	if start >= size {
+		aerr := awserr.New("InvalidRange", fmt.Sprintf("the range %q is not satisfiable for the object of %d bytes", s, size), nil)
+		return 0, 0, awserr.NewRequestFailure(aerr, http.StatusRequestedRangeNotSatisfiable, "")
+	}
+	return start, end, nil
+}
+
+// composeSegments resolves the sources to the segments pinned to the ETags and the version ids.
+// The sources are resolved in parallel.
+func (t *Transport) composeSegments(ctx context.Context, sources []ComposeSource) ([]composeSegment, error) {
+	refs := make([]objectRef, len(sources))
+	for i, source := range sources {
+		src, err := parseObjectURL(source.URL)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = src
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	segments := make([]composeSegment, len(sources))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	indexes := make(chan int)
+	for i := 0; i < t.multipartCopyConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				seg, err := t.composeSegment(ctx, refs[i], sources[i])
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					segments[i] = seg
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+LOOP:
+	for i := range sources {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+// composeSegment resolves the source by HeadObject.
+func (t *Transport) composeSegment(ctx context.Context, src objectRef, source ComposeSource) (composeSegment, error) {
+	svc, err := t.getBucketClient(ctx, src.bucket)
+	if err != nil {
+		return composeSegment{}, err
+	}
+	seg := composeSegment{
+		svc:          svc,
+		sseAlgorithm: nilIfEmpty(source.SSECustomerAlgorithm),
+		sseKey:       nilIfEmpty(source.SSECustomerKey),
+		sseKeyMD5:    nilIfEmpty(source.SSECustomerKeyMD5),
+	}
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(src.bucket),
+		Key:                  aws.String(src.key),
+		VersionId:            nilIfEmpty(src.versionID),
+		SSECustomerAlgorithm: seg.sseAlgorithm,
+		SSECustomerKey:       seg.sseKey,
+		SSECustomerKeyMD5:    seg.sseKeyMD5,
+	})
+	if err != nil {
+		return composeSegment{}, err
+	}
+	src.versionID = aws.StringValue(head.VersionId)
+	start, end, err := parseByteRange(source.Range, aws.Int64Value(head.ContentLength))
+	if err != nil {
+		return composeSegment{}, err
+	}
+	seg.src = src
+	seg.etag = head.ETag
+	seg.contentType = head.ContentType
+	seg.start = start
+	seg.end = end
+	return seg, nil
+}
+
+// planComposeParts splits the segments into the parts.
+// All parts except the last one must be at least minPartSize bytes,
+// so the small segments are merged with the adjacent segments and uploaded by UploadPart.
+func (t *Transport) planComposeParts(segments []composeSegment, minPartSize int64) []composePart {
+	var total int64
+	for _, seg := range segments {
+		total += seg.size()
+	}
+	partSize := t.multipartCopyPartSize(total)
+
+	var parts []composePart
+	var pending []composeSegment
+	var pendingSize int64
+	flush := func() {
+		parts = append(parts, composePart{segments: pending})
+		pending = nil
+		pendingSize = 0
+	}
+	for _, seg := range segments {
+		if seg.size() == 0 {
+			continue
+		}
+		if pendingSize > 0 {
+			need := minPartSize - pendingSize
+			if seg.size()-need < minPartSize {
+				// the rest of the segment is too small to copy.
+				pending = append(pending, seg)
+				pendingSize += seg.size()
+				if pendingSize >= minPartSize {
+					flush()
+				}
+				continue
+			}
+			// fill the pending part with the head of the segment, and copy the rest.
+			head := seg
+			head.end = seg.start + need
+			pending = append(pending, head)
+			flush()
+			seg.start += need
+		}
+		if seg.size() < minPartSize {
+			pending = append(pending, seg)
+			pendingSize += seg.size()
+			continue
+		}
+		for start := seg.start; start < seg.end; {
+			end := start + partSize
+			if end > seg.end || seg.end-end < minPartSize {
+				end = seg.end
+			}
+			chunk := seg
+			chunk.start, chunk.end = start, end
+			parts = append(parts, composePart{copy: true, segments: []composeSegment{chunk}})
+			start = end
+		}
+	}
+	if len(pending) > 0 || len(parts) == 0 {
+		// the last part can be smaller than minPartSize.
+		flush()
+	}
+	return parts
+}
+
+func (t *Transport) compose(ctx context.Context, in *s3.CreateMultipartUploadInput, sources []ComposeSource) (*s3.CompleteMultipartUploadOutput, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("s3protocol: no compose sources")
+	}
+	svc, err := t.getBucketClient(ctx, aws.StringValue(in.Bucket))
+	if err != nil {
+		return nil, err
+	}
+	segments, err := t.composeSegments(ctx, sources)
+	if err != nil {
+		return nil, err
+	}
+	if in.ContentType == nil {
+		in.ContentType = segments[0].contentType
+	}
+	parts := t.planComposeParts(segments, s3manager.MinUploadPartSize)
+	if len(parts) > maxUploadParts {
+		return nil, fmt.Errorf("s3protocol: too many parts to compose: %d", len(parts))
+	}
+
+	upload, err := svc.CreateMultipartUploadWithContext(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := t.uploadComposeParts(ctx, svc, in, upload.UploadId, parts)
+	if err == nil {
+		var out *s3.CompleteMultipartUploadOutput
+		out, err = svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:               in.Bucket,
+			Key:                  in.Key,
+			UploadId:             upload.UploadId,
+			MultipartUpload:      &s3.CompletedMultipartUpload{Parts: completed},
+			ExpectedBucketOwner:  in.ExpectedBucketOwner,
+			RequestPayer:         in.RequestPayer,
+			SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+			SSECustomerKey:       in.SSECustomerKey,
+			SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		})
+		if err == nil {
+			return out, nil
+		}
+	}
+
+	// the request may be canceled, so abort the upload with another context.
+	abortCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	svc.AbortMultipartUploadWithContext(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:              in.Bucket,
+		Key:                 in.Key,
+		UploadId:            upload.UploadId,
+		ExpectedBucketOwner: in.ExpectedBucketOwner,
+		RequestPayer:        in.RequestPayer,
+	})
+	return nil, err
+}
+
+// uploadComposeParts uploads the parts in parallel.
+func (t *Transport) uploadComposeParts(ctx context.Context, svc s3iface.S3API, in *s3.CreateMultipartUploadInput, uploadID *string, parts []composePart) ([]*s3.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	completed := make([]*s3.CompletedPart, len(parts))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	indexes := make(chan int)
+	for i := 0; i < t.multipartCopyConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				var etag *string
+				var err error
+				if parts[i].copy {
+					etag, err = t.copyComposePart(ctx, svc, in, uploadID, i, parts[i].segments[0])
+				} else {
+					etag, err = t.uploadComposePart(ctx, svc, in, uploadID, i, parts[i].segments)
+				}
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					completed[i] = &s3.CompletedPart{
+						ETag:       etag,
+						PartNumber: aws.Int64(int64(i + 1)),
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+LOOP:
+	for i := range parts {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return completed, nil
+}
+
+func (t *Transport) copyComposePart(ctx context.Context, svc s3iface.S3API, in *s3.CreateMultipartUploadInput, uploadID *string, i int, seg composeSegment) (*string, error) {
+	out, err := svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+		Bucket:                         in.Bucket,
+		Key:                            in.Key,
+		UploadId:                       uploadID,
+		PartNumber:                     aws.Int64(int64(i + 1)),
+		CopySource:                     aws.String(seg.src.String()),
+		CopySourceRange:                aws.String(seg.byteRange()),
+		CopySourceIfMatch:              seg.etag,
+		CopySourceSSECustomerAlgorithm: seg.sseAlgorithm,
+		CopySourceSSECustomerKey:       seg.sseKey,
+		CopySourceSSECustomerKeyMD5:    seg.sseKeyMD5,
+		SSECustomerAlgorithm:           in.SSECustomerAlgorithm,
+		SSECustomerKey:                 in.SSECustomerKey,
+		SSECustomerKeyMD5:              in.SSECustomerKeyMD5,
+		RequestPayer:                   in.RequestPayer,
+		ExpectedBucketOwner:            in.ExpectedBucketOwner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.CopyPartResult == nil {
+		return nil, nil
+	}
+	return out.CopyPartResult.ETag, nil
+}
+
+func (t *Transport) uploadComposePart(ctx context.Context, svc s3iface.S3API, in *s3.CreateMultipartUploadInput, uploadID *string, i int, segments []composeSegment) (*string, error) {
+	var size int64
+	for _, seg := range segments {
+		size += seg.size()
+	}
+	data := make([]byte, size)
+	var off int64
+	for _, seg := range segments {
+		out, err := seg.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:               aws.String(seg.src.bucket),
+			Key:                  aws.String(seg.src.key),
+			VersionId:            nilIfEmpty(seg.src.versionID),
+			IfMatch:              seg.etag,
+			Range:                aws.String(seg.byteRange()),
+			SSECustomerAlgorithm: seg.sseAlgorithm,
+			SSECustomerKey:       seg.sseKey,
+			SSECustomerKeyMD5:    seg.sseKeyMD5,
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(out.Body, data[off:off+seg.size()])
+		out.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		off += seg.size()
+	}
+
+	sum := md5.Sum(data)
+	out, err := svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:               in.Bucket,
+		Key:                  in.Key,
+		UploadId:             uploadID,
+		PartNumber:           aws.Int64(int64(i + 1)),
+		Body:                 bytes.NewReader(data),
+		ContentLength:        aws.Int64(size),
+		ContentMD5:           aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		SSECustomerKey:       in.SSECustomerKey,
+		SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		RequestPayer:         in.RequestPayer,
+		ExpectedBucketOwner:  in.ExpectedBucketOwner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.ETag, nil
+}
@@ -0,0 +1,317 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestParseComposeRange(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int64
+	}{
+		{"", 0, 100},
+		{"bytes=0-9", 0, 10},
+		{"bytes=10-", 10, 100},
+		{"bytes=90-199", 90, 100},
+		{"bytes=-10", 90, 100},
+	}
+	for _, tt := range tests {
+		start, end, err := parseByteRange(tt.in, 100)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if start != tt.start || end != tt.end {
+			t.Errorf("%q: want [%d, %d), got [%d, %d)", tt.in, tt.start, tt.end, start, end)
+		}
+	}
+
+	for _, in := range []string{"0-9", "bytes=9-0", "bytes=a-b", "bytes=100-"} {
+		if _, _, err := parseByteRange(in, 100); err == nil {
+			t.Errorf("%q: want error, got nil", in)
+		}
+	}
+}
+
+func TestPlanComposeParts(t *testing.T) {
+	s3 := &Transport{
+		MultipartCopyPartSize: 25,
+	}
+	segment := func(key string, size int64) composeSegment {
+		return composeSegment{src: objectRef{bucket: "bucket-name", key: key}, end: size}
+	}
+	parts := s3.planComposeParts([]composeSegment{
+		segment("a", 30),
+		segment("b", 3),
+		segment("c", 4),
+		segment("empty", 0),
+		segment("d", 60),
+		segment("e", 2),
+	}, 10)
+
+	var got []string
+	for _, part := range parts {
+		var segs []string
+		for _, seg := range part.segments {
+			segs = append(segs, fmt.Sprintf("%s[%d,%d)", seg.src.key, seg.start, seg.end))
+		}
+		kind := "upload"
+		if part.copy {
+			kind = "copy"
+		}
+		got = append(got, kind+" "+strings.Join(segs, " "))
+	}
+	want := []string{
+		"copy a[0,30)",
+		"upload b[0,3) c[0,4) d[0,3)",
+		"copy d[3,28)",
+		"copy d[28,60)",
+		"upload e[0,2)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestRoundTrip_Compose(t *testing.T) {
+	const largeSize = 6 * 1024 * 1024
+	small := []byte("the small object")
+
+	var mu sync.Mutex
+	var copies []*s3.UploadPartCopyInput
+	var uploaded []byte
+	var complete *s3.CompleteMultipartUploadInput
+	var create *s3.CreateMultipartUploadInput
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			switch aws.StringValue(in.Key) {
+			case "large-key":
+				return &s3.HeadObjectOutput{
+					ContentLength: aws.Int64(largeSize),
+					ETag:          aws.String(`"large"`),
+					VersionId:     aws.String("v1"),
+					ContentType:   aws.String("text/csv"),
+				}, nil
+			case "small-key":
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(small))), ETag: aws.String(`"small"`)}, nil
+			}
+			return nil, errors.New("unexpected key")
+		},
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			if aws.StringValue(in.Key) != "small-key" || aws.StringValue(in.IfMatch) != `"small"` {
+				t.Errorf("unexpected input: %v", in)
+			}
+			var start, end int
+			if _, err := fmt.Sscanf(aws.StringValue(in.Range), "bytes=%d-%d", &start, &end); err != nil {
+				t.Errorf("unexpected range: %q", aws.StringValue(in.Range))
+			}
+			return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(small[start : end+1]))}, nil
+		},
+		createMultipartUploadWithContext: func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+			create = in
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+		},
+		uploadPartCopyWithContext: func(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error) {
+			mu.Lock()
+			copies = append(copies, in)
+			mu.Unlock()
+			return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"copied"`)}}, nil
+		},
+		uploadPartWithContext: func(ctx context.Context, in *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+			data, err := ioutil.ReadAll(in.Body)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			uploaded = data
+			mu.Unlock()
+			return &s3.UploadPartOutput{ETag: aws.String(`"uploaded"`)}, nil
+		},
+		completeMultipartUploadWithContext: func(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+			complete = in
+			return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"composed-2"`), VersionId: aws.String("v2")}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	body := `{"Sources":[{"URL":"s3://bucket-name/large-key?versionId=v1"},{"URL":"/small-key","Range":"bytes=4-"}]}`
+	req, err := http.NewRequest(http.MethodPost, "s3://bucket-name/composed-key?compose", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Amz-Meta-Foo", "bar")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if want := `{"Bucket":"bucket-name","Key":"composed-key","ETag":"\"composed-2\""}`; string(data) != want {
+		t.Errorf("want %s, got %s", want, data)
+	}
+	if got := resp.Header.Get("X-Amz-Version-Id"); got != "v2" {
+		t.Errorf("unexpected x-amz-version-id: want %q, got %q", "v2", got)
+	}
+
+	if aws.StringValue(create.Key) != "composed-key" || aws.StringValue(create.Metadata["Foo"]) != "bar" || aws.StringValue(create.ContentType) != "text/csv" {
+		t.Errorf("unexpected input: %v", create)
+	}
+	if len(copies) != 1 {
+		t.Fatalf("unexpected copies: %v", copies)
+	}
+	if c := copies[0]; aws.StringValue(c.CopySource) != "bucket-name/large-key?versionId=v1" ||
+		aws.StringValue(c.CopySourceRange) != fmt.Sprintf("bytes=0-%d", largeSize-1) ||
+		aws.StringValue(c.CopySourceIfMatch) != `"large"` {
+		t.Errorf("unexpected copy: %v", c)
+	}
+	if string(uploaded) != "small object" {
+		t.Errorf("unexpected uploaded data: %q", uploaded)
+	}
+	if len(complete.MultipartUpload.Parts) != 2 {
+		t.Fatalf("unexpected parts: %v", complete.MultipartUpload.Parts)
+	}
+	if p := complete.MultipartUpload.Parts; aws.StringValue(p[0].ETag) != `"copied"` || aws.StringValue(p[1].ETag) != `"uploaded"` {
+		t.Errorf("unexpected parts: %v", p)
+	}
+
+	// the manifest without sources
+	req, err = http.NewRequest(http.MethodPost, "s3://bucket-name/composed-key?compose", strings.NewReader(`<Compose></Compose>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestCompose_Abort(t *testing.T) {
+	var aborted bool
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(6 * 1024 * 1024), ETag: aws.String(`"etag"`)}, nil
+		},
+		createMultipartUploadWithContext: func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+		},
+		uploadPartCopyWithContext: func(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error) {
+			return nil, errors.New("copy failed")
+		},
+		abortMultipartUploadWithContext: func(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+			aborted = aws.StringValue(in.UploadId) == "upload-id"
+			return &s3.AbortMultipartUploadOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	_, err := s3.Compose(context.Background(), "s3://bucket-name/composed-key", []ComposeSource{
+		{URL: "s3://bucket-name/a"},
+		{URL: "s3://bucket-name/b"},
+	})
+	if err == nil || err.Error() != "copy failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !aborted {
+		t.Error("the upload is not aborted")
+	}
+}
+
+func TestCompose_SSECustomer(t *testing.T) {
+	const largeSize = 6 * 1024 * 1024
+	small := []byte("the small object")
+
+	// the sources are resolved in parallel.
+	var heads sync.WaitGroup
+	heads.Add(2)
+
+	var mu sync.Mutex
+	var copies []*s3.UploadPartCopyInput
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			heads.Done()
+			heads.Wait()
+			if aws.StringValue(in.SSECustomerAlgorithm) != "AES256" || aws.StringValue(in.SSECustomerKey) != "source-key" {
+				aerr := awserr.New("BadRequest", "Bad Request", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusBadRequest, "request-id")
+			}
+			switch aws.StringValue(in.Key) {
+			case "large-key":
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(largeSize), ETag: aws.String(`"large"`)}, nil
+			case "small-key":
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(small))), ETag: aws.String(`"small"`)}, nil
+			}
+			return nil, errors.New("unexpected key")
+		},
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			if aws.StringValue(in.SSECustomerAlgorithm) != "AES256" || aws.StringValue(in.SSECustomerKey) != "source-key" {
+				t.Errorf("unexpected input: %v", in)
+			}
+			return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(small))}, nil
+		},
+		createMultipartUploadWithContext: func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+		},
+		uploadPartCopyWithContext: func(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error) {
+			mu.Lock()
+			copies = append(copies, in)
+			mu.Unlock()
+			return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"copied"`)}}, nil
+		},
+		uploadPartWithContext: func(ctx context.Context, in *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+			return &s3.UploadPartOutput{ETag: aws.String(`"uploaded"`)}, nil
+		},
+		completeMultipartUploadWithContext: func(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+			return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"composed-2"`)}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Concurrency = 2
+
+	body := `{"Sources":[{"URL":"/large-key"},{"URL":"/small-key"}]}`
+	req, err := http.NewRequest(http.MethodPost, "s3://bucket-name/composed-key?compose", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	req.Header.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key", "source-key")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if len(copies) != 1 {
+		t.Fatalf("unexpected copies: %v", copies)
+	}
+	if c := copies[0]; aws.StringValue(c.CopySourceSSECustomerAlgorithm) != "AES256" || aws.StringValue(c.CopySourceSSECustomerKey) != "source-key" {
+		t.Errorf("unexpected copy: %v", c)
+	}
+}
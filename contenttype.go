@@ -0,0 +1,81 @@
+package s3protocol
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// the number of bytes that http.DetectContentType considers.
+const sniffLen = 512
+
+// isGenericContentType reports whether the Content-Type doesn't tell the type of the content.
+func isGenericContentType(typ string) bool {
+	mediaType, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return true
+	}
+	switch mediaType {
+	case "binary/octet-stream", "application/octet-stream":
+		return true
+	}
+	return false
+}
+
+// detectContentType applies DetectContentType to fn.
+func (t *Transport) detectContentType(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		resp, err := fn(req)
+		if err != nil || resp.StatusCode/100 != 2 || !isGenericContentType(resp.Header.Get("Content-Type")) {
+			return resp, err
+		}
+
+		key := req.URL.Path
+		if resp.Uncompressed {
+			// the suffix of the encoding doesn't tell the type of the decompressed content.
+			for suffix := range suffixEncodings {
+				key = strings.TrimSuffix(key, suffix)
+			}
+		}
+		if typ := mime.TypeByExtension(path.Ext(key)); typ != "" {
+			resp.Header.Set("Content-Type", typ)
+			return resp, nil
+		}
+
+		if req.Method != http.MethodGet || req.Header.Get("Range") != "" || resp.Body == nil || resp.Body == http.NoBody {
+			// the content is not available, or it's a part of the object.
+			return resp, nil
+		}
+
+		// sniff the head of the body, and put it back for the caller.
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(resp.Body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			resp.Body.Close()
+			return nil, err
+		}
+		buf = buf[:n]
+		if n > 0 {
+			resp.Header.Set("Content-Type", http.DetectContentType(buf))
+		}
+		resp.Body = &sniffedBody{
+			Reader: io.MultiReader(bytes.NewReader(buf), resp.Body),
+			body:   resp.Body,
+		}
+		return resp, nil
+	}
+}
+
+// sniffedBody is the response body with the sniffed head put back.
+type sniffedBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+// Close implements io.Closer.
+func (b *sniffedBody) Close() error {
+	return b.body.Close()
+}
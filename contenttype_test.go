@@ -0,0 +1,80 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func newContentTypeTestTransport(data []byte, contentType *string) *Transport {
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				ContentType: contentType,
+				Body:        ioutil.NopCloser(bytes.NewReader(data)),
+			}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentType: contentType,
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.DetectContentType = true
+	return s3
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		method      string
+		url         string
+		contentType *string
+		want        string
+	}{
+		// by the extension
+		{http.MethodGet, "s3://bucket-name/index.html", aws.String("binary/octet-stream"), mime.TypeByExtension(".html")},
+		{http.MethodHead, "s3://bucket-name/index.html", nil, mime.TypeByExtension(".html")},
+
+		// by the content
+		{http.MethodGet, "s3://bucket-name/image", aws.String("binary/octet-stream"), "image/png"},
+		{http.MethodGet, "s3://bucket-name/image", nil, "image/png"},
+
+		// HEAD can't sniff the content
+		{http.MethodHead, "s3://bucket-name/image", aws.String("binary/octet-stream"), "binary/octet-stream"},
+
+		// specific types are kept
+		{http.MethodGet, "s3://bucket-name/index.html", aws.String("text/plain"), "text/plain"},
+	}
+
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A" + "Hello S3!")
+	for _, tt := range tests {
+		s3 := newContentTypeTestTransport(png, tt.contentType)
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.want {
+			t.Errorf("%s %s: want %q, got %q", tt.method, tt.url, tt.want, got)
+		}
+		if tt.method == http.MethodGet && !bytes.Equal(body, png) {
+			t.Errorf("%s %s: the body is consumed: %q", tt.method, tt.url, body)
+		}
+	}
+}
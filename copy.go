@@ -0,0 +1,420 @@
+package s3protocol
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// MethodCopy is the WebDAV COPY method.
+// The object is copied to the URL in the Destination header on the server side.
+const MethodCopy = "COPY"
+
+// maxCopyObjectSize is the maximum size of the objects copied by CopyObject.
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+// defaultMultipartCopyPartSize is the default size of each part of the multipart copy.
+const defaultMultipartCopyPartSize = 512 * 1024 * 1024
+
+// maxUploadParts is the maximum number of the parts of a multipart upload.
+const maxUploadParts = 10000
+
+func (t *Transport) multipartCopyThreshold() int64 {
+	if t.MultipartCopyThreshold > 0 {
+		return t.MultipartCopyThreshold
+	}
+	return maxCopyObjectSize
+}
+
+func (t *Transport) multipartCopyPartSize(size int64) int64 {
+	partSize := t.MultipartCopyPartSize
+	if partSize <= 0 {
+		partSize = defaultMultipartCopyPartSize
+	}
+	if min := (size + maxUploadParts - 1) / maxUploadParts; partSize < min {
+		partSize = min
+	}
+	return partSize
+}
+
+func (t *Transport) multipartCopyConcurrency() int {
+	if t.Concurrency > 1 {
+		return t.Concurrency
+	}
+	return s3manager.DefaultUploadConcurrency
+}
+
+// copyObjectResult is the result of the copy exchanged in JSON or XML.
+type copyObjectResult struct {
+	XMLName      xml.Name   `xml:"CopyObjectResult" json:"-"`
+	Xmlns        string     `xml:"xmlns,attr,omitempty" json:"-"`
+	ETag         string     `xml:"ETag,omitempty" json:"ETag,omitempty"`
+	LastModified *time.Time `xml:"LastModified,omitempty" json:"LastModified,omitempty"`
+}
+
+// objectRef refers to the object, such as the source of the copy.
+type objectRef struct {
+	bucket    string
+	key       string
+	versionID string
+}
+
+// parseCopySource parses the x-amz-copy-source header, such as "bucket/key?versionId=version".
+// The key is URL-encoded.
+func parseCopySource(s string) (objectRef, error) {
+	var src objectRef
+	path := strings.TrimPrefix(s, "/")
+	if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		query, err := url.ParseQuery(path[idx+1:])
+		if err != nil {
+			return src, fmt.Errorf("s3protocol: invalid copy source %q: %w", s, err)
+		}
+		src.versionID = query.Get("versionId")
+		path = path[:idx]
+	}
+	path, err := url.PathUnescape(path)
+	if err != nil {
+		return src, fmt.Errorf("s3protocol: invalid copy source %q: %w", s, err)
+	}
+	idx := strings.IndexByte(path, '/')
+	if idx <= 0 || idx == len(path)-1 {
+		return src, fmt.Errorf("s3protocol: invalid copy source %q", s)
+	}
+	src.bucket = path[:idx]
+	src.key = path[idx+1:]
+	return src, nil
+}
+
+// String returns the source in the format of the x-amz-copy-source header.
+func (src objectRef) String() string {
+	s := strings.ReplaceAll(url.PathEscape(src.bucket+"/"+src.key), "%2F", "/")
+	if src.versionID != "" {
+		s += "?versionId=" + url.QueryEscape(src.versionID)
+	}
+	return s
+}
+
+// copyDestination returns the bucket and the key of the Destination header of the COPY request.
+// The relative destination is resolved against the request URL.
+func copyDestination(req *http.Request) (string, string, error) {
+	dest := req.Header.Get("Destination")
+	if dest == "" {
+		return "", "", errors.New("s3protocol: Destination header is missing")
+	}
+	u, err := req.URL.Parse(dest)
+	if err != nil {
+		return "", "", fmt.Errorf("s3protocol: invalid destination %q: %w", dest, err)
+	}
+	if u.Scheme != req.URL.Scheme {
+		return "", "", fmt.Errorf("s3protocol: the destination %q must have the %s scheme", dest, req.URL.Scheme)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("s3protocol: invalid destination %q", dest)
+	}
+	return u.Host, key, nil
+}
+
+// copyObject copies the object on the server side.
+// The COPY request copies the object of the request URL to the Destination header,
+// and the PUT request copies the object of the x-amz-copy-source header to the request URL.
+func (t *Transport) copyObject(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	in := newCopyObjectInput(req)
+	code := http.StatusOK
+	if req.Method == MethodCopy {
+		bucket, key, err := copyDestination(req)
+		if err != nil {
+			return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+		}
+		src := objectRef{
+			bucket:    host,
+			key:       path,
+			versionID: req.URL.Query().Get("versionId"),
+		}
+		in.CopySource = aws.String(src.String())
+		host, path = bucket, key
+		code = http.StatusCreated
+	}
+	src, err := parseCopySource(aws.StringValue(in.CopySource))
+	if err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+	srcSvc, err := t.getBucketClient(ctx, src.bucket)
+	if err != nil {
+		return handleError(nil, err)
+	}
+	in.Bucket = &host
+	in.Key = &path
+
+	head, err := srcSvc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(src.bucket),
+		Key:                  aws.String(src.key),
+		VersionId:            nilIfEmpty(src.versionID),
+		IfMatch:              in.CopySourceIfMatch,
+		IfNoneMatch:          in.CopySourceIfNoneMatch,
+		IfModifiedSince:      in.CopySourceIfModifiedSince,
+		IfUnmodifiedSince:    in.CopySourceIfUnmodifiedSince,
+		SSECustomerAlgorithm: in.CopySourceSSECustomerAlgorithm,
+		SSECustomerKey:       in.CopySourceSSECustomerKey,
+		SSECustomerKeyMD5:    in.CopySourceSSECustomerKeyMD5,
+		RequestPayer:         in.RequestPayer,
+		ExpectedBucketOwner:  in.ExpectedSourceBucketOwner,
+	})
+	if err != nil {
+		if rerr, ok := awsRequestFailure(err); ok && rerr.StatusCode() == http.StatusNotModified {
+			// the copy fails with 412 Precondition Failed, even if the condition is If-None-Match or If-Modified-Since.
+			aerr := awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", err)
+			err = awserr.NewRequestFailure(aerr, http.StatusPreconditionFailed, rerr.RequestID())
+		}
+		return handleError(nil, err)
+	}
+
+	header, result, err := t.doCopyObject(ctx, svc, srcSvc, in, src, head)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+	return encodeResponse(req, code, header, result)
+}
+
+// doCopyObject copies the object with CopyObject,
+// or with the multipart copy if the source is larger than MultipartCopyThreshold.
+func (t *Transport) doCopyObject(ctx context.Context, svc, srcSvc s3iface.S3API, in *s3.CopyObjectInput, src objectRef, head *s3.HeadObjectOutput) (http.Header, *copyObjectResult, error) {
+	result := &copyObjectResult{
+		Xmlns: s3Namespace,
+	}
+	if aws.Int64Value(head.ContentLength) > t.multipartCopyThreshold() {
+		out, err := t.multipartCopy(ctx, svc, srcSvc, in, src, head)
+		header := makeHeaderFromCompleteMultipartUploadOutput(out)
+		if err != nil {
+			return header, nil, err
+		}
+		if head.VersionId != nil {
+			header.Set("X-Amz-Copy-Source-Version-Id", aws.StringValue(head.VersionId))
+		}
+		result.ETag = aws.StringValue(out.ETag)
+		return header, result, nil
+	}
+
+	out, err := svc.CopyObjectWithContext(ctx, in)
+	header := makeHeaderFromCopyObjectOutput(out)
+	if err != nil {
+		return header, nil, err
+	}
+	if r := out.CopyObjectResult; r != nil {
+		result.ETag = aws.StringValue(r.ETag)
+		result.LastModified = r.LastModified
+	}
+	return header, result, nil
+}
+
+// multipartCopy copies the object larger than CopyObject supports with parallel UploadPartCopy requests.
+// The metadata and the tags are copied from the source unless the directives are REPLACE, as CopyObject does.
+func (t *Transport) multipartCopy(ctx context.Context, svc, srcSvc s3iface.S3API, in *s3.CopyObjectInput, src objectRef, head *s3.HeadObjectOutput) (*s3.CompleteMultipartUploadOutput, error) {
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:                    in.Bucket,
+		Key:                       in.Key,
+		ACL:                       in.ACL,
+		BucketKeyEnabled:          in.BucketKeyEnabled,
+		ChecksumAlgorithm:         in.ChecksumAlgorithm,
+		ExpectedBucketOwner:       in.ExpectedBucketOwner,
+		GrantFullControl:          in.GrantFullControl,
+		GrantRead:                 in.GrantRead,
+		GrantReadACP:              in.GrantReadACP,
+		GrantWriteACP:             in.GrantWriteACP,
+		ObjectLockLegalHoldStatus: in.ObjectLockLegalHoldStatus,
+		ObjectLockMode:            in.ObjectLockMode,
+		ObjectLockRetainUntilDate: in.ObjectLockRetainUntilDate,
+		RequestPayer:              in.RequestPayer,
+		SSECustomerAlgorithm:      in.SSECustomerAlgorithm,
+		SSECustomerKey:            in.SSECustomerKey,
+		SSECustomerKeyMD5:         in.SSECustomerKeyMD5,
+		SSEKMSEncryptionContext:   in.SSEKMSEncryptionContext,
+		SSEKMSKeyId:               in.SSEKMSKeyId,
+		ServerSideEncryption:      in.ServerSideEncryption,
+		StorageClass:              in.StorageClass,
+		WebsiteRedirectLocation:   in.WebsiteRedirectLocation,
+	}
+	if strings.EqualFold(aws.StringValue(in.MetadataDirective), s3.MetadataDirectiveReplace) {
+		create.CacheControl = in.CacheControl
+		create.ContentDisposition = in.ContentDisposition
+		create.ContentEncoding = in.ContentEncoding
+		create.ContentLanguage = in.ContentLanguage
+		create.ContentType = in.ContentType
+		create.Expires = in.Expires
+		create.Metadata = in.Metadata
+	} else {
+		create.CacheControl = head.CacheControl
+		create.ContentDisposition = head.ContentDisposition
+		create.ContentEncoding = head.ContentEncoding
+		create.ContentLanguage = head.ContentLanguage
+		create.ContentType = head.ContentType
+		create.Expires = parseExpires(head.Expires)
+		create.Metadata = head.Metadata
+	}
+	if strings.EqualFold(aws.StringValue(in.TaggingDirective), s3.TaggingDirectiveReplace) {
+		create.Tagging = in.Tagging
+	} else {
+		out, err := srcSvc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+			Bucket:              aws.String(src.bucket),
+			Key:                 aws.String(src.key),
+			VersionId:           head.VersionId,
+			RequestPayer:        in.RequestPayer,
+			ExpectedBucketOwner: in.ExpectedSourceBucketOwner,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(out.TagSet) > 0 {
+			tags := make(url.Values, len(out.TagSet))
+			for _, tag := range out.TagSet {
+				tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+			}
+			create.Tagging = aws.String(tags.Encode())
+		}
+	}
+
+	upload, err := svc.CreateMultipartUploadWithContext(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := t.uploadPartCopies(ctx, svc, in, src, head, upload.UploadId)
+	if err == nil {
+		var out *s3.CompleteMultipartUploadOutput
+		out, err = svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:               in.Bucket,
+			Key:                  in.Key,
+			UploadId:             upload.UploadId,
+			MultipartUpload:      &s3.CompletedMultipartUpload{Parts: parts},
+			ExpectedBucketOwner:  in.ExpectedBucketOwner,
+			RequestPayer:         in.RequestPayer,
+			SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+			SSECustomerKey:       in.SSECustomerKey,
+			SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		})
+		if err == nil {
+			return out, nil
+		}
+	}
+
+	// the request may be canceled, so abort the upload with another context.
+	abortCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	svc.AbortMultipartUploadWithContext(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:              in.Bucket,
+		Key:                 in.Key,
+		UploadId:            upload.UploadId,
+		ExpectedBucketOwner: in.ExpectedBucketOwner,
+		RequestPayer:        in.RequestPayer,
+	})
+	return nil, err
+}
+
+// uploadPartCopies copies the parts of the object in parallel.
+// The parts are pinned to the ETag of the source, so they are copied from the same object.
+func (t *Transport) uploadPartCopies(ctx context.Context, svc s3iface.S3API, in *s3.CopyObjectInput, src objectRef, head *s3.HeadObjectOutput, uploadID *string) ([]*s3.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size := aws.Int64Value(head.ContentLength)
+	partSize := t.multipartCopyPartSize(size)
+	parts := make([]*s3.CompletedPart, (size+partSize-1)/partSize)
+	src.versionID = aws.StringValue(head.VersionId)
+	copySource := aws.String(src.String())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	indexes := make(chan int)
+	for i := 0; i < t.multipartCopyConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				start := int64(i) * partSize
+				end := start + partSize - 1
+				if end >= size {
+					end = size - 1
+				}
+				out, err := svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+					Bucket:                         in.Bucket,
+					Key:                            in.Key,
+					UploadId:                       uploadID,
+					PartNumber:                     aws.Int64(int64(i + 1)),
+					CopySource:                     copySource,
+					CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					CopySourceIfMatch:              head.ETag,
+					CopySourceSSECustomerAlgorithm: in.CopySourceSSECustomerAlgorithm,
+					CopySourceSSECustomerKey:       in.CopySourceSSECustomerKey,
+					CopySourceSSECustomerKeyMD5:    in.CopySourceSSECustomerKeyMD5,
+					SSECustomerAlgorithm:           in.SSECustomerAlgorithm,
+					SSECustomerKey:                 in.SSECustomerKey,
+					SSECustomerKeyMD5:              in.SSECustomerKeyMD5,
+					RequestPayer:                   in.RequestPayer,
+					ExpectedBucketOwner:            in.ExpectedBucketOwner,
+					ExpectedSourceBucketOwner:      in.ExpectedSourceBucketOwner,
+				})
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					var etag *string
+					if out.CopyPartResult != nil {
+						etag = out.CopyPartResult.ETag
+					}
+					parts[i] = &s3.CompletedPart{
+						ETag:       etag,
+						PartNumber: aws.Int64(int64(i + 1)),
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+LOOP:
+	for i := range parts {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
@@ -0,0 +1,374 @@
+package s3protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestParseCopySource(t *testing.T) {
+	tests := []struct {
+		in   string
+		want objectRef
+	}{
+		{"bucket/key", objectRef{bucket: "bucket", key: "key"}},
+		{"/bucket/dir/a%20b.txt", objectRef{bucket: "bucket", key: "dir/a b.txt"}},
+		{"bucket/key?versionId=foo%2Bbar", objectRef{bucket: "bucket", key: "key", versionID: "foo+bar"}},
+	}
+	for _, tt := range tests {
+		got, err := parseCopySource(tt.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: want %#v, got %#v", tt.in, tt.want, got)
+		}
+	}
+
+	for _, in := range []string{"", "bucket", "bucket/", "/key"} {
+		if _, err := parseCopySource(in); err == nil {
+			t.Errorf("%q: want error, got nil", in)
+		}
+	}
+
+	src := objectRef{bucket: "bucket", key: "dir/a b+c.txt", versionID: "v1"}
+	if got, want := src.String(), "bucket/dir/a%20b+c.txt?versionId=v1"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestRoundTrip_CopyObject(t *testing.T) {
+	var copied *s3.CopyObjectInput
+	dest := &s3mock{
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			copied = in
+			return &s3.CopyObjectOutput{
+				CopyObjectResult:    &s3.CopyObjectResult{ETag: aws.String(`"0123456789abcdef"`)},
+				CopySourceVersionId: aws.String("v1"),
+			}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(9)}, nil
+		},
+	}
+	s3 := newTestTransport(dest, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/copied-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Copy-Source", "bucket-name/object-key")
+	req.Header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	req.Header.Set("X-Amz-Meta-Foo", "bar")
+	req.Header.Set("X-Amz-Tagging-Directive", "REPLACE")
+	req.Header.Set("X-Amz-Tagging", "a=1")
+	req.Header.Set("X-Amz-Copy-Source-If-Match", `"0123456789abcdef"`)
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<CopyObjectResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><ETag>&#34;0123456789abcdef&#34;</ETag></CopyObjectResult>`
+	if string(body) != want {
+		t.Errorf("want %s, got %s", want, body)
+	}
+	if got := resp.Header.Get("X-Amz-Copy-Source-Version-Id"); got != "v1" {
+		t.Errorf("unexpected x-amz-copy-source-version-id: want %q, got %q", "v1", got)
+	}
+	if aws.StringValue(copied.Bucket) != "bucket-name" || aws.StringValue(copied.Key) != "copied-key" {
+		t.Errorf("unexpected destination: %s/%s", aws.StringValue(copied.Bucket), aws.StringValue(copied.Key))
+	}
+	if aws.StringValue(copied.CopySource) != "bucket-name/object-key" {
+		t.Errorf("unexpected copy source: %q", aws.StringValue(copied.CopySource))
+	}
+	if aws.StringValue(copied.MetadataDirective) != "REPLACE" || aws.StringValue(copied.Metadata["Foo"]) != "bar" {
+		t.Errorf("unexpected metadata: %q, %v", aws.StringValue(copied.MetadataDirective), copied.Metadata)
+	}
+	if aws.StringValue(copied.TaggingDirective) != "REPLACE" || aws.StringValue(copied.Tagging) != "a=1" {
+		t.Errorf("unexpected tagging: %q, %q", aws.StringValue(copied.TaggingDirective), aws.StringValue(copied.Tagging))
+	}
+	if aws.StringValue(copied.CopySourceIfMatch) != `"0123456789abcdef"` {
+		t.Errorf("unexpected x-amz-copy-source-if-match: %q", aws.StringValue(copied.CopySourceIfMatch))
+	}
+}
+
+func TestRoundTrip_COPY(t *testing.T) {
+	var copied *s3.CopyObjectInput
+	var head *s3.HeadObjectInput
+	src := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			head = in
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(9)}, nil
+		},
+	}
+	dest := &s3mock{
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			copied = in
+			return &s3.CopyObjectOutput{
+				CopyObjectResult: &s3.CopyObjectResult{ETag: aws.String(`"0123456789abcdef"`)},
+			}, nil
+		},
+	}
+	// the buckets are in the different regions.
+	s3 := newTestTransport(src, "source-bucket")
+	s3.s3.Store("destination-bucket", &s3api{svc: dest})
+
+	req, err := http.NewRequest(MethodCopy, "s3://source-bucket/dir/a%20b.txt?versionId=v1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Destination", "s3://destination-bucket/copied-key")
+	req.Header.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	req.Header.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key", "source-key")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	if aws.StringValue(head.Bucket) != "source-bucket" || aws.StringValue(head.Key) != "dir/a b.txt" || aws.StringValue(head.VersionId) != "v1" {
+		t.Errorf("unexpected source: %v", head)
+	}
+	if aws.StringValue(head.SSECustomerKey) != "source-key" {
+		t.Errorf("unexpected SSE-C key of the source: %q", aws.StringValue(head.SSECustomerKey))
+	}
+	if aws.StringValue(copied.Bucket) != "destination-bucket" || aws.StringValue(copied.Key) != "copied-key" {
+		t.Errorf("unexpected destination: %s/%s", aws.StringValue(copied.Bucket), aws.StringValue(copied.Key))
+	}
+	if want := "source-bucket/dir/a%20b.txt?versionId=v1"; aws.StringValue(copied.CopySource) != want {
+		t.Errorf("unexpected copy source: want %q, got %q", want, aws.StringValue(copied.CopySource))
+	}
+	if aws.StringValue(copied.CopySourceSSECustomerKey) != "source-key" {
+		t.Errorf("unexpected SSE-C key of the source: %q", aws.StringValue(copied.CopySourceSSECustomerKey))
+	}
+
+	// the relative destination is in the same bucket.
+	req, err = http.NewRequest(MethodCopy, "s3://source-bucket/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Destination", "/copied-key")
+	src.copyObjectWithContext = dest.copyObjectWithContext
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if aws.StringValue(copied.Bucket) != "source-bucket" || aws.StringValue(copied.Key) != "copied-key" {
+		t.Errorf("unexpected destination: %s/%s", aws.StringValue(copied.Bucket), aws.StringValue(copied.Key))
+	}
+
+	// the destination is missing.
+	req, err = http.NewRequest(MethodCopy, "s3://source-bucket/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestRoundTrip_CopyPreconditionFailed(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			aerr := awserr.New("NotModified", "Not Modified", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusNotModified, "request-id")
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			t.Error("CopyObject must not be called")
+			return &s3.CopyObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/copied-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Copy-Source", "bucket-name/object-key")
+	req.Header.Set("X-Amz-Copy-Source-If-None-Match", `"0123456789abcdef"`)
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusPreconditionFailed, resp.StatusCode)
+	}
+}
+
+type multipartCopyTestObject struct {
+	mu        sync.Mutex
+	create    *s3.CreateMultipartUploadInput
+	parts     []*s3.UploadPartCopyInput
+	completed []*s3.CompletedPart
+	aborted   bool
+	fail      bool
+}
+
+func (obj *multipartCopyTestObject) mock() *s3mock {
+	return &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(10),
+				ContentType:   aws.String("text/plain"),
+				ETag:          aws.String(`"source-etag"`),
+				VersionId:     aws.String("v1"),
+				Metadata:      map[string]*string{"Foo": aws.String("bar")},
+			}, nil
+		},
+		getObjectTaggingWithContext: func(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []*s3.Tag{{Key: aws.String("a"), Value: aws.String("1")}},
+			}, nil
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			panic("CopyObject must not be called")
+		},
+		createMultipartUploadWithContext: func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+			obj.create = in
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+		},
+		uploadPartCopyWithContext: func(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error) {
+			obj.mu.Lock()
+			defer obj.mu.Unlock()
+			obj.parts = append(obj.parts, in)
+			if obj.fail && aws.Int64Value(in.PartNumber) == 2 {
+				aerr := awserr.New("InternalError", "We encountered an internal error. Please try again.", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusInternalServerError, "request-id")
+			}
+			return &s3.UploadPartCopyOutput{
+				CopyPartResult: &s3.CopyPartResult{ETag: aws.String("etag-" + aws.StringValue(in.CopySourceRange))},
+			}, nil
+		},
+		completeMultipartUploadWithContext: func(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+			obj.completed = in.MultipartUpload.Parts
+			return &s3.CompleteMultipartUploadOutput{
+				ETag:      aws.String(`"multipart-etag-3"`),
+				VersionId: aws.String("v2"),
+			}, nil
+		},
+		abortMultipartUploadWithContext: func(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+			obj.aborted = true
+			return &s3.AbortMultipartUploadOutput{}, nil
+		},
+	}
+}
+
+func TestRoundTrip_MultipartCopy(t *testing.T) {
+	obj := &multipartCopyTestObject{}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+	s3.MultipartCopyThreshold = 5
+	s3.MultipartCopyPartSize = 4
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/copied-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Copy-Source", "bucket-name/object-key")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"ETag":"\"multipart-etag-3\""}`; string(body) != want {
+		t.Errorf("want %s, got %s", want, body)
+	}
+	if got := resp.Header.Get("X-Amz-Version-Id"); got != "v2" {
+		t.Errorf("unexpected x-amz-version-id: want %q, got %q", "v2", got)
+	}
+	if got := resp.Header.Get("X-Amz-Copy-Source-Version-Id"); got != "v1" {
+		t.Errorf("unexpected x-amz-copy-source-version-id: want %q, got %q", "v1", got)
+	}
+
+	// the metadata and the tags are copied.
+	if aws.StringValue(obj.create.ContentType) != "text/plain" || aws.StringValue(obj.create.Metadata["Foo"]) != "bar" {
+		t.Errorf("unexpected metadata: %v", obj.create)
+	}
+	if aws.StringValue(obj.create.Tagging) != "a=1" {
+		t.Errorf("unexpected tagging: %q", aws.StringValue(obj.create.Tagging))
+	}
+
+	sort.Slice(obj.parts, func(i, j int) bool {
+		return aws.Int64Value(obj.parts[i].PartNumber) < aws.Int64Value(obj.parts[j].PartNumber)
+	})
+	ranges := []string{"bytes=0-3", "bytes=4-7", "bytes=8-9"}
+	if len(obj.parts) != len(ranges) {
+		t.Fatalf("unexpected parts: want %d, got %d", len(ranges), len(obj.parts))
+	}
+	for i, part := range obj.parts {
+		if aws.StringValue(part.CopySourceRange) != ranges[i] {
+			t.Errorf("part %d: unexpected range: want %q, got %q", i+1, ranges[i], aws.StringValue(part.CopySourceRange))
+		}
+		if aws.StringValue(part.CopySource) != "bucket-name/object-key?versionId=v1" {
+			t.Errorf("part %d: unexpected copy source: %q", i+1, aws.StringValue(part.CopySource))
+		}
+		if aws.StringValue(part.CopySourceIfMatch) != `"source-etag"` {
+			t.Errorf("part %d: unexpected x-amz-copy-source-if-match: %q", i+1, aws.StringValue(part.CopySourceIfMatch))
+		}
+	}
+	for i, part := range obj.completed {
+		if aws.Int64Value(part.PartNumber) != int64(i+1) || aws.StringValue(part.ETag) != "etag-"+ranges[i] {
+			t.Errorf("unexpected completed part: %v", part)
+		}
+	}
+	if obj.aborted {
+		t.Error("the upload must not be aborted")
+	}
+}
+
+func TestRoundTrip_MultipartCopyAbort(t *testing.T) {
+	obj := &multipartCopyTestObject{fail: true}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+	s3.MultipartCopyThreshold = 5
+	s3.MultipartCopyPartSize = 4
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/copied-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Copy-Source", "bucket-name/object-key")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+	if !obj.aborted {
+		t.Error("the upload must be aborted")
+	}
+	if obj.completed != nil {
+		t.Error("the upload must not be completed")
+	}
+}
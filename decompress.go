@@ -0,0 +1,111 @@
+package s3protocol
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// the default decoders for Decompress.
+var defaultDecoders = map[string]func(r io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": zlib.NewReader,
+}
+
+// the content codings for DecompressBySuffix.
+// zstd and br have no default decoders; they are decoded only if Decoders has them.
+var suffixEncodings = map[string]string{
+	".gz":  "gzip",
+	".zst": "zstd",
+	".br":  "br",
+}
+
+func (t *Transport) decoder(encoding string) (func(r io.Reader) (io.ReadCloser, error), bool) {
+	if dec, ok := t.Decoders[encoding]; ok {
+		return dec, true
+	}
+	dec, ok := defaultDecoders[encoding]
+	return dec, ok
+}
+
+// decompress applies Decompress to fn.
+func (t *Transport) decompress(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+			// the caller asks for the encoded form.
+			return fn(req)
+		}
+
+		resp, err := fn(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+
+		encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+		bySuffix := false
+		if encoding == "" && t.DecompressBySuffix {
+			encoding = suffixEncodings[path.Ext(req.URL.Path)]
+			bySuffix = encoding != ""
+		}
+		if encoding == "" || encoding == "identity" {
+			return resp, nil
+		}
+		dec, ok := t.decoder(encoding)
+		if !ok {
+			// unknown encodings and multiple encodings are passed through with Content-Encoding,
+			// so the caller can tell the body is still encoded.
+			if bySuffix {
+				resp.Header.Set("Content-Encoding", encoding)
+			}
+			return resp, nil
+		}
+
+		resp.Body = &decompressBody{
+			body: resp.Body,
+			dec:  dec,
+		}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		return resp, nil
+	}
+}
+
+// decompressBody lazily decompresses the body on the first Read,
+// so the errors of the decoder are reported by Read.
+type decompressBody struct {
+	body io.ReadCloser
+	dec  func(r io.Reader) (io.ReadCloser, error)
+	zr   io.ReadCloser
+	err  error
+}
+
+// Read implements io.Reader.
+func (b *decompressBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.zr == nil {
+		zr, err := b.dec(b.body)
+		if err != nil {
+			b.err = err
+			return 0, err
+		}
+		b.zr = zr
+	}
+	return b.zr.Read(p)
+}
+
+// Close implements io.Closer.
+func (b *decompressBody) Close() error {
+	if b.zr != nil {
+		b.zr.Close()
+	}
+	return b.body.Close()
+}
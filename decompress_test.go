@@ -0,0 +1,211 @@
+package s3protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newDecompressTestTransport(data []byte, encoding *string) *Transport {
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				ContentEncoding: encoding,
+				ContentLength:   aws.Int64(int64(len(data))),
+				Body:            ioutil.NopCloser(bytes.NewReader(data)),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Decompress = true
+	return s3
+}
+
+func TestDecompress(t *testing.T) {
+	s3 := newDecompressTestTransport(gzipBytes(t, "Hello S3!"), aws.String("gzip"))
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", got)
+	}
+	if !resp.Uncompressed {
+		t.Error("Uncompressed must be true")
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("unexpected content length: want %d, got %d", -1, resp.ContentLength)
+	}
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("unexpected header: %v", resp.Header)
+	}
+}
+
+func TestDecompress_AcceptEncoding(t *testing.T) {
+	data := gzipBytes(t, "Hello S3!")
+	s3 := newDecompressTestTransport(data, aws.String("gzip"))
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the encoded form must be returned")
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("want %q, got %q", "gzip", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestDecompress_Suffix(t *testing.T) {
+	s3 := newDecompressTestTransport(gzipBytes(t, "Hello S3!"), nil)
+
+	// the suffix is ignored by default.
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key.gz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Uncompressed {
+		t.Error("Uncompressed must be false")
+	}
+
+	s3.DecompressBySuffix = true
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", got)
+	}
+}
+
+func TestDecompress_Decoders(t *testing.T) {
+	s3 := newDecompressTestTransport([]byte("!3S olleH"), aws.String("reverse"))
+	s3.Decoders = map[string]func(r io.Reader) (io.ReadCloser, error){
+		"reverse": func(r io.Reader) (io.ReadCloser, error) {
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+				data[i], data[j] = data[j], data[i]
+			}
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", got)
+	}
+}
+
+func TestDecompress_Corrupted(t *testing.T) {
+	s3 := newDecompressTestTransport([]byte("Hello S3! Hello S3!"), aws.String("gzip"))
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != gzip.ErrHeader {
+		t.Errorf("want gzip.ErrHeader, got %v", err)
+	}
+}
+
+func TestDecompress_SuffixWithoutDecoder(t *testing.T) {
+	data := []byte("zstd frame")
+	s3 := newDecompressTestTransport(data, nil)
+	s3.DecompressBySuffix = true
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key.zst", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the encoded form must be returned")
+	}
+	if resp.Uncompressed {
+		t.Error("Uncompressed must be false")
+	}
+	// the caller can tell that the body is still encoded.
+	if got := resp.Header.Get("Content-Encoding"); got != "zstd" {
+		t.Errorf("unexpected Content-Encoding: want %q, got %q", "zstd", got)
+	}
+}
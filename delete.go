@@ -0,0 +1,387 @@
+package s3protocol
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// maxDeleteObjects is the maximum number of the keys of a DeleteObjects request.
+const maxDeleteObjects = 1000
+
+// ObjectIdentifier is an object to delete by DeleteObjects.
+type ObjectIdentifier struct {
+	Key       string `xml:"Key" json:"Key"`
+	VersionID string `xml:"VersionId,omitempty" json:"VersionId,omitempty"`
+}
+
+// DeletedObject is an object deleted by DeleteObjects.
+type DeletedObject struct {
+	Key                   string `xml:"Key" json:"Key"`
+	VersionID             string `xml:"VersionId,omitempty" json:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty" json:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty" json:"DeleteMarkerVersionId,omitempty"`
+}
+
+// DeleteError is an object that DeleteObjects failed to delete.
+type DeleteError struct {
+	Key       string `xml:"Key" json:"Key"`
+	VersionID string `xml:"VersionId,omitempty" json:"VersionId,omitempty"`
+	Code      string `xml:"Code" json:"Code"`
+	Message   string `xml:"Message,omitempty" json:"Message,omitempty"`
+}
+
+// DeleteResult is the result of DeleteObjects and DeletePrefix.
+type DeleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult" json:"-"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty" json:"-"`
+	Deleted []DeletedObject `xml:"Deleted" json:"Deleted,omitempty"`
+	Errors  []DeleteError   `xml:"Error" json:"Errors,omitempty"`
+}
+
+// DeleteOptions is the options of DeleteObjects and DeletePrefix.
+type DeleteOptions struct {
+	// Quiet omits the deleted objects from the result, and only the errors are reported.
+	Quiet bool
+
+	// MFA is the value of the x-amz-mfa header, the serial number and the code of the MFA device separated by a space.
+	// It is required for deleting the versions in the bucket with MFA delete enabled.
+	MFA string
+
+	// BypassGovernanceRetention deletes the objects locked in the governance mode.
+	BypassGovernanceRetention bool
+
+	// AllVersions makes DeletePrefix delete all the versions and the delete markers
+	// listed by ListObjectVersions, instead of only the current versions listed by ListObjectsV2.
+	// It has no effect on DeleteObjects.
+	AllVersions bool
+}
+
+// deleteRequest is the request body of POST ?delete exchanged in JSON or XML.
+type deleteRequest struct {
+	XMLName xml.Name           `xml:"Delete" json:"-"`
+	Objects []ObjectIdentifier `xml:"Object" json:"Objects"`
+	Quiet   bool               `xml:"Quiet" json:"Quiet"`
+}
+
+func (t *Transport) deleteConcurrency() int {
+	if t.Concurrency > 1 {
+		return t.Concurrency
+	}
+	return s3manager.DefaultUploadConcurrency
+}
+
+// parseBucketURL parses the url in the form of s3://[BUCKET_NAME]/[PREFIX], and returns the bucket and the prefix.
+func parseBucketURL(rawurl string) (string, string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" {
+		return "", "", fmt.Errorf("s3protocol: unsupported protocol scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("s3protocol: invalid bucket url %q", rawurl)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+func newDeleteObjectsInputFromOptions(bucket string, opts *DeleteOptions) *s3.DeleteObjectsInput {
+	in := &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+	}
+	if opts != nil {
+		in.MFA = nilIfEmpty(opts.MFA)
+		if opts.BypassGovernanceRetention {
+			in.BypassGovernanceRetention = aws.Bool(true)
+		}
+	}
+	return in
+}
+
+// DeleteObjects deletes the objects in the bucket of rawurl, such as s3://[BUCKET_NAME]/.
+// The objects are split into the DeleteObjects requests of 1,000 keys, and they are sent concurrently.
+// The objects that failed to be deleted are reported in the Errors of the result,
+// and the error is returned only if all the requests failed.
+// If the first requests as many as Concurrency all failed, the rest of the objects are not sent.
+func (t *Transport) DeleteObjects(ctx context.Context, rawurl string, objects []ObjectIdentifier, opts *DeleteOptions) (*DeleteResult, error) {
+	bucket, _, err := parseBucketURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := t.getBucketClient(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	quiet := opts != nil && opts.Quiet
+	return t.deleteObjectList(ctx, svc, newDeleteObjectsInputFromOptions(bucket, opts), objects, quiet)
+}
+
+// DeletePrefix deletes all the objects whose keys start with the prefix of rawurl, such as s3://[BUCKET_NAME]/[PREFIX].
+// The objects are listed by ListObjectsV2, and each page is deleted while listing the next page.
+// In the versioned bucket, this only creates the delete markers and keeps all the versions,
+// unless AllVersions of opts is set.
+// If the listing fails, the objects deleted so far are returned together with the error.
+// If the deletes keep failing, e.g. with AccessDenied, the listing is stopped and the error is returned.
+func (t *Transport) DeletePrefix(ctx context.Context, rawurl string, opts *DeleteOptions) (*DeleteResult, error) {
+	bucket, prefix, err := parseBucketURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := t.getBucketClient(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	quiet := opts != nil && opts.Quiet
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	batches := make(chan []*s3.ObjectIdentifier)
+	send := func(batch []*s3.ObjectIdentifier) bool {
+		if len(batch) == 0 {
+			return true
+		}
+		select {
+		case batches <- batch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	var listErr error
+	go func() {
+		defer close(batches)
+		if opts != nil && opts.AllVersions {
+			listErr = svc.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+				Bucket:  aws.String(bucket),
+				Prefix:  aws.String(prefix),
+				MaxKeys: aws.Int64(maxDeleteObjects),
+			}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+				batch := make([]*s3.ObjectIdentifier, 0, len(page.Versions)+len(page.DeleteMarkers))
+				for _, v := range page.Versions {
+					batch = append(batch, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+				}
+				for _, v := range page.DeleteMarkers {
+					batch = append(batch, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+				}
+				return send(batch)
+			})
+			return
+		}
+		listErr = svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucket),
+			Prefix:  aws.String(prefix),
+			MaxKeys: aws.Int64(maxDeleteObjects),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			batch := make([]*s3.ObjectIdentifier, 0, len(page.Contents))
+			for _, obj := range page.Contents {
+				batch = append(batch, &s3.ObjectIdentifier{Key: obj.Key})
+			}
+			return send(batch)
+		})
+	}()
+
+	result, err := t.deleteBatches(ctx, cancel, svc, newDeleteObjectsInputFromOptions(bucket, opts), batches, quiet)
+	if err != nil {
+		// the listing is canceled if the deletes are failing.
+		return result, err
+	}
+	if listErr != nil {
+		// report the objects deleted before the listing failed.
+		return result, listErr
+	}
+	return result, nil
+}
+
+// deleteObjects handles POST s3://[BUCKET_NAME]/?delete.
+func (t *Transport) deleteObjects(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	var body deleteRequest
+	if err := decodeRequest(req, &body); err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+	if len(body.Objects) == 0 {
+		return textResponse(http.StatusBadRequest, nil, "s3protocol: no objects to delete\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newDeleteObjectsInput(req)
+	in.Bucket = &host
+	result, err := t.deleteObjectList(ctx, svc, in, body.Objects, body.Quiet)
+	if err != nil {
+		return handleError(nil, err)
+	}
+	result.Xmlns = s3Namespace
+	return encodeResponse(req, http.StatusOK, nil, result)
+}
+
+// deleteObjectList splits the objects into the batches and deletes them.
+func (t *Transport) deleteObjectList(ctx context.Context, svc s3iface.S3API, in *s3.DeleteObjectsInput, objects []ObjectIdentifier, quiet bool) (*DeleteResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan []*s3.ObjectIdentifier)
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(objects); start += maxDeleteObjects {
+			end := start + maxDeleteObjects
+			if end > len(objects) {
+				end = len(objects)
+			}
+			batch := make([]*s3.ObjectIdentifier, 0, end-start)
+			for _, obj := range objects[start:end] {
+				batch = append(batch, &s3.ObjectIdentifier{
+					Key:       aws.String(obj.Key),
+					VersionId: nilIfEmpty(obj.VersionID),
+				})
+			}
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return t.deleteBatches(ctx, cancel, svc, in, batches, quiet)
+}
+
+// deleteBatches deletes the batches concurrently.
+// The failed request is reported as the errors of all the objects in the batch,
+// and the error is returned if all the requests failed.
+// If as many requests as the concurrency failed before any succeeded, the deletes are regarded as failing:
+// abort is called to stop producing the batches, and the rest of the batches are not deleted.
+// The requests are always sent without Quiet, because the deleted keys are needed for purging the caches;
+// the deleted objects are dropped from the result if quiet is set.
+func (t *Transport) deleteBatches(ctx context.Context, abort context.CancelFunc, svc s3iface.S3API, in *s3.DeleteObjectsInput, batches <-chan []*s3.ObjectIdentifier, quiet bool) (*DeleteResult, error) {
+	type indexedBatch struct {
+		index   int
+		objects []*s3.ObjectIdentifier
+	}
+	type batchResult struct {
+		index  int
+		result DeleteResult
+	}
+
+	indexed := make(chan indexedBatch)
+	go func() {
+		defer close(indexed)
+		var i int
+		for batch := range batches {
+			indexed <- indexedBatch{index: i, objects: batch}
+			i++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var results []batchResult
+	var firstErr error
+	var succeeded, aborted bool
+	var failures int
+	for i := 0; i < t.deleteConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range indexed {
+				req := *in
+				req.Delete = &s3.Delete{
+					Objects: batch.objects,
+					Quiet:   aws.Bool(false),
+				}
+				out, err := svc.DeleteObjectsWithContext(ctx, &req)
+				r := batchResult{index: batch.index}
+				if err != nil {
+					code, message := errorCode(err), err.Error()
+					for _, obj := range batch.objects {
+						r.result.Errors = append(r.result.Errors, DeleteError{
+							Key:       aws.StringValue(obj.Key),
+							VersionID: aws.StringValue(obj.VersionId),
+							Code:      code,
+							Message:   message,
+						})
+					}
+				} else {
+					for _, v := range out.Deleted {
+						t.invalidate(aws.StringValue(in.Bucket), aws.StringValue(v.Key))
+						if quiet {
+							continue
+						}
+						r.result.Deleted = append(r.result.Deleted, DeletedObject{
+							Key:                   aws.StringValue(v.Key),
+							VersionID:             aws.StringValue(v.VersionId),
+							DeleteMarker:          aws.BoolValue(v.DeleteMarker),
+							DeleteMarkerVersionID: aws.StringValue(v.DeleteMarkerVersionId),
+						})
+					}
+					for _, v := range out.Errors {
+						r.result.Errors = append(r.result.Errors, DeleteError{
+							Key:       aws.StringValue(v.Key),
+							VersionID: aws.StringValue(v.VersionId),
+							Code:      aws.StringValue(v.Code),
+							Message:   aws.StringValue(v.Message),
+						})
+					}
+				}
+
+				mu.Lock()
+				results = append(results, r)
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					failures++
+					if !succeeded && !aborted && failures >= t.deleteConcurrency() {
+						// e.g. AccessDenied; the rest of the batches would fail in the same way.
+						aborted = true
+						abort()
+					}
+				} else {
+					succeeded = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil && !succeeded {
+		return nil, firstErr
+	}
+
+	// report the results in the order of the batches.
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].index < results[j].index
+	})
+	var result DeleteResult
+	for _, r := range results {
+		result.Deleted = append(result.Deleted, r.result.Deleted...)
+		result.Errors = append(result.Errors, r.result.Errors...)
+	}
+	if aborted {
+		// some requests in flight succeeded after aborting.
+		return &result, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
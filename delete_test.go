@@ -0,0 +1,344 @@
+package s3protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRoundTrip_DeleteObjects(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	mock := &s3mock{
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			if aws.StringValue(in.MFA) != "serial 123456" {
+				t.Errorf("unexpected x-amz-mfa: %q", aws.StringValue(in.MFA))
+			}
+			mu.Lock()
+			sizes = append(sizes, len(in.Delete.Objects))
+			mu.Unlock()
+
+			var out s3.DeleteObjectsOutput
+			for _, obj := range in.Delete.Objects {
+				if aws.StringValue(obj.Key) == "key-5" {
+					out.Errors = append(out.Errors, &s3.Error{
+						Key:     obj.Key,
+						Code:    aws.String("AccessDenied"),
+						Message: aws.String("Access Denied"),
+					})
+					continue
+				}
+				out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key, VersionId: obj.VersionId})
+			}
+			return &out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	var body strings.Builder
+	body.WriteString("<Delete>")
+	for i := 0; i < 2500; i++ {
+		fmt.Fprintf(&body, "<Object><Key>key-%d</Key></Object>", i)
+	}
+	body.WriteString("<Quiet>false</Quiet></Delete>")
+	req, err := http.NewRequest(http.MethodPost, "s3://bucket-name/?delete", strings.NewReader(body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Amz-Mfa", "serial 123456")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	sort.Ints(sizes)
+	if fmt.Sprint(sizes) != "[500 1000 1000]" {
+		t.Errorf("unexpected batches: %v", sizes)
+	}
+	var result DeleteResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Deleted) != 2499 || result.Deleted[0].Key != "key-0" || result.Deleted[2498].Key != "key-2499" {
+		t.Errorf("unexpected deleted objects: %d", len(result.Deleted))
+	}
+	if len(result.Errors) != 1 || result.Errors[0] != (DeleteError{Key: "key-5", Code: "AccessDenied", Message: "Access Denied"}) {
+		t.Errorf("unexpected errors: %v", result.Errors)
+	}
+}
+
+func TestDeleteObjects(t *testing.T) {
+	mock := &s3mock{
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			// the deleted keys are needed for purging the caches.
+			if aws.BoolValue(in.Delete.Quiet) {
+				t.Error("quiet mode must not be sent")
+			}
+			if aws.StringValue(in.Delete.Objects[0].Key) == "denied" {
+				aerr := awserr.New("AccessDenied", "Access Denied", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+			}
+			var out s3.DeleteObjectsOutput
+			for _, obj := range in.Delete.Objects {
+				out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key, VersionId: obj.VersionId})
+			}
+			return &out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	objects := make([]ObjectIdentifier, 0, 1500)
+	for i := 0; i < 1000; i++ {
+		objects = append(objects, ObjectIdentifier{Key: fmt.Sprintf("key-%d", i), VersionID: "v1"})
+	}
+	objects = append(objects, ObjectIdentifier{Key: "denied"})
+	for i := 1; i < 500; i++ {
+		objects = append(objects, ObjectIdentifier{Key: fmt.Sprintf("denied-%d", i)})
+	}
+
+	// the failed request is reported as the errors of the batch.
+	result, err := s3.DeleteObjects(context.Background(), "s3://bucket-name/", objects, &DeleteOptions{Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Deleted) != 0 {
+		t.Errorf("unexpected deleted objects: %v", result.Deleted)
+	}
+	if len(result.Errors) != 500 || result.Errors[0].Key != "denied" || result.Errors[0].Code != "AccessDenied" {
+		t.Errorf("unexpected errors: %d", len(result.Errors))
+	}
+
+	// all the requests failed.
+	_, err = s3.DeleteObjects(context.Background(), "s3://bucket-name/", objects[1000:], &DeleteOptions{Quiet: true})
+	if rerr, ok := awsRequestFailure(err); !ok || rerr.StatusCode() != http.StatusForbidden {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDeleteObjects_QuietInvalidate(t *testing.T) {
+	var heads int
+	var deleted bool
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			heads++
+			if deleted {
+				aerr := awserr.New("NotFound", "not found", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+			}
+			return &s3.HeadObjectOutput{ContentType: aws.String("text/plain")}, nil
+		},
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			deleted = true
+			var out s3.DeleteObjectsOutput
+			for _, obj := range in.Delete.Objects {
+				out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key})
+			}
+			return &out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.HeadCache = &HeadCache{}
+	head := func() int {
+		req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := head(); code != http.StatusOK {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusOK, code)
+	}
+	result, err := s3.DeleteObjects(context.Background(), "s3://bucket-name/", []ObjectIdentifier{{Key: "object-key"}}, &DeleteOptions{Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Deleted) != 0 {
+		t.Errorf("unexpected deleted objects: %v", result.Deleted)
+	}
+
+	// the cached response is purged even in the quiet mode.
+	if code := head(); code != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, code)
+	}
+	if heads != 2 {
+		t.Errorf("unexpected HeadObject count: want %d, got %d", 2, heads)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	var list *s3.ListObjectsV2Input
+	var mu sync.Mutex
+	var deleted []string
+	mock := &s3mock{
+		listObjectsV2PagesWithContext: func(ctx context.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+			list = in
+			pages := []*s3.ListObjectsV2Output{
+				{Contents: []*s3.Object{{Key: aws.String("dir/a")}, {Key: aws.String("dir/b")}}},
+				{Contents: []*s3.Object{{Key: aws.String("dir/c")}}},
+			}
+			for i, page := range pages {
+				if !fn(page, i == len(pages)-1) {
+					break
+				}
+			}
+			return nil
+		},
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			var out s3.DeleteObjectsOutput
+			mu.Lock()
+			for _, obj := range in.Delete.Objects {
+				deleted = append(deleted, aws.StringValue(obj.Key))
+				out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key})
+			}
+			mu.Unlock()
+			return &out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	result, err := s3.DeletePrefix(context.Background(), "s3://bucket-name/dir/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(list.Prefix) != "dir/" {
+		t.Errorf("unexpected prefix: %q", aws.StringValue(list.Prefix))
+	}
+	sort.Strings(deleted)
+	if strings.Join(deleted, ",") != "dir/a,dir/b,dir/c" {
+		t.Errorf("unexpected deleted keys: %v", deleted)
+	}
+	if len(result.Deleted) != 3 || result.Deleted[0].Key != "dir/a" || result.Deleted[2].Key != "dir/c" {
+		t.Errorf("unexpected result: %v", result.Deleted)
+	}
+}
+
+func TestDeletePrefix_AllVersions(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	mock := &s3mock{
+		listObjectVersionsPagesWithContext: func(ctx context.Context, in *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool, _ ...request.Option) error {
+			if aws.StringValue(in.Prefix) != "dir/" {
+				t.Errorf("unexpected prefix: %q", aws.StringValue(in.Prefix))
+			}
+			fn(&s3.ListObjectVersionsOutput{
+				Versions: []*s3.ObjectVersion{
+					{Key: aws.String("dir/a"), VersionId: aws.String("v2")},
+					{Key: aws.String("dir/a"), VersionId: aws.String("v1")},
+				},
+				DeleteMarkers: []*s3.DeleteMarkerEntry{
+					{Key: aws.String("dir/b"), VersionId: aws.String("v3")},
+				},
+			}, true)
+			return nil
+		},
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			var out s3.DeleteObjectsOutput
+			mu.Lock()
+			for _, obj := range in.Delete.Objects {
+				deleted = append(deleted, aws.StringValue(obj.Key)+"@"+aws.StringValue(obj.VersionId))
+				out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key, VersionId: obj.VersionId})
+			}
+			mu.Unlock()
+			return &out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	result, err := s3.DeletePrefix(context.Background(), "s3://bucket-name/dir/", &DeleteOptions{AllVersions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(deleted)
+	if strings.Join(deleted, ",") != "dir/a@v1,dir/a@v2,dir/b@v3" {
+		t.Errorf("unexpected deleted versions: %v", deleted)
+	}
+	if len(result.Deleted) != 3 {
+		t.Errorf("unexpected result: %v", result.Deleted)
+	}
+}
+
+func TestDeletePrefix_ListError(t *testing.T) {
+	listErr := errors.New("list failed")
+	mock := &s3mock{
+		listObjectsV2PagesWithContext: func(ctx context.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+			fn(&s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: aws.String("dir/a")}}}, false)
+			return listErr
+		},
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			var out s3.DeleteObjectsOutput
+			for _, obj := range in.Delete.Objects {
+				out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key})
+			}
+			return &out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	// the objects deleted before the failure are reported.
+	result, err := s3.DeletePrefix(context.Background(), "s3://bucket-name/dir/", nil)
+	if err != listErr {
+		t.Errorf("want %v, got %v", listErr, err)
+	}
+	if result == nil || len(result.Deleted) != 1 || result.Deleted[0].Key != "dir/a" {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
+
+func TestDeletePrefix_DeleteFailing(t *testing.T) {
+	var pages int32
+	mock := &s3mock{
+		listObjectsV2PagesWithContext: func(ctx context.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+			for i := 0; i < 1000; i++ {
+				atomic.AddInt32(&pages, 1)
+				page := &s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: aws.String(fmt.Sprintf("dir/%d", i))}}}
+				if !fn(page, false) {
+					return ctx.Err()
+				}
+			}
+			return nil
+		},
+		deleteObjectsWithContext: func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+			aerr := awserr.New("AccessDenied", "Access Denied", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	_, err := s3.DeletePrefix(context.Background(), "s3://bucket-name/dir/", nil)
+	if errorCode(err) != "AccessDenied" {
+		t.Errorf("want AccessDenied, got %v", err)
+	}
+
+	// the listing is stopped without paging through the whole prefix.
+	if n := atomic.LoadInt32(&pages); n >= 1000 {
+		t.Errorf("unexpected page count: %d", n)
+	}
+}
@@ -24,5 +24,8 @@ To access the noncurrent version of an object, use a uri like s3://[BUCKET_NAME]
 For example,
 
 	resp, err := c.Get("s3://shogo82148-s3protocol/example.txt?versionId=null")
+
+The other S3 APIs, such as tagging, ACLs, copy, compose and bulk deletes, are also mapped to the HTTP methods and query parameters.
+See https://github.com/shogo82148/s3protocol#readme for the full list.
 */
 package s3protocol
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -154,219 +156,1498 @@ func newHeadObjectInput(req *http.Request) *s3.HeadObjectInput {
 	return &in
 }
 
+func newPutObjectInput(req *http.Request) *s3.PutObjectInput {
+	var in s3.PutObjectInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Acl"]; ok && len(v) > 0 {
+		in.ACL = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"]; ok && len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err == nil {
+			in.BucketKeyEnabled = aws.Bool(b)
+		}
+	}
+	if v, ok := header["Cache-Control"]; ok && len(v) > 0 {
+		in.CacheControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Checksum-Crc32"]; ok && len(v) > 0 {
+		in.ChecksumCRC32 = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Checksum-Crc32c"]; ok && len(v) > 0 {
+		in.ChecksumCRC32C = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Checksum-Sha1"]; ok && len(v) > 0 {
+		in.ChecksumSHA1 = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Checksum-Sha256"]; ok && len(v) > 0 {
+		in.ChecksumSHA256 = aws.String(v[0])
+	}
+	if v, ok := header["Content-Disposition"]; ok && len(v) > 0 {
+		in.ContentDisposition = aws.String(v[0])
+	}
+	if v, ok := header["Content-Encoding"]; ok && len(v) > 0 {
+		in.ContentEncoding = aws.String(v[0])
+	}
+	if v, ok := header["Content-Language"]; ok && len(v) > 0 {
+		in.ContentLanguage = aws.String(v[0])
+	}
+	if v, ok := header["Content-Length"]; ok && len(v) > 0 {
+		i, err := strconv.ParseInt(v[0], 10, 64)
+		if err == nil {
+			in.ContentLength = aws.Int64(i)
+		}
+	}
+	if v, ok := header["Content-Md5"]; ok && len(v) > 0 {
+		in.ContentMD5 = aws.String(v[0])
+	}
+	if v, ok := header["Content-Type"]; ok && len(v) > 0 {
+		in.ContentType = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["Expires"]; ok && len(v) > 0 {
+		t, err := http.ParseTime(v[0])
+		if err == nil {
+			in.Expires = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Grant-Full-Control"]; ok && len(v) > 0 {
+		in.GrantFullControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read"]; ok && len(v) > 0 {
+		in.GrantRead = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read-Acp"]; ok && len(v) > 0 {
+		in.GrantReadACP = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write-Acp"]; ok && len(v) > 0 {
+		in.GrantWriteACP = aws.String(v[0])
+	}
+	for k, v := range header {
+		if len(v) == 0 || !strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			continue
+		}
+		if in.Metadata == nil {
+			in.Metadata = make(map[string]*string)
+		}
+		in.Metadata[k[len("x-amz-meta-"):]] = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Legal-Hold"]; ok && len(v) > 0 {
+		in.ObjectLockLegalHoldStatus = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Mode"]; ok && len(v) > 0 {
+		in.ObjectLockMode = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Retain-Until-Date"]; ok && len(v) > 0 {
+		t, err := time.Parse(time.RFC3339, v[0])
+		if err == nil {
+			in.ObjectLockRetainUntilDate = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Algorithm"]; ok && len(v) > 0 {
+		in.SSECustomerAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key"]; ok && len(v) > 0 {
+		in.SSECustomerKey = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key-Md5"]; ok && len(v) > 0 {
+		in.SSECustomerKeyMD5 = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Context"]; ok && len(v) > 0 {
+		in.SSEKMSEncryptionContext = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"]; ok && len(v) > 0 {
+		in.SSEKMSKeyId = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption"]; ok && len(v) > 0 {
+		in.ServerSideEncryption = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Storage-Class"]; ok && len(v) > 0 {
+		in.StorageClass = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Tagging"]; ok && len(v) > 0 {
+		in.Tagging = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Website-Redirect-Location"]; ok && len(v) > 0 {
+		in.WebsiteRedirectLocation = aws.String(v[0])
+	}
+	return &in
+}
+
+func newDeleteObjectInput(req *http.Request) *s3.DeleteObjectInput {
+	var in s3.DeleteObjectInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Bypass-Governance-Retention"]; ok && len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err == nil {
+			in.BypassGovernanceRetention = aws.Bool(b)
+		}
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Mfa"]; ok && len(v) > 0 {
+		in.MFA = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newRestoreObjectInput(req *http.Request) *s3.RestoreObjectInput {
+	var in s3.RestoreObjectInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetObjectTaggingInput(req *http.Request) *s3.GetObjectTaggingInput {
+	var in s3.GetObjectTaggingInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newPutObjectTaggingInput(req *http.Request) *s3.PutObjectTaggingInput {
+	var in s3.PutObjectTaggingInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newDeleteObjectTaggingInput(req *http.Request) *s3.DeleteObjectTaggingInput {
+	var in s3.DeleteObjectTaggingInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetObjectAttributesInput(req *http.Request) *s3.GetObjectAttributesInput {
+	var in s3.GetObjectAttributesInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Max-Parts"]; ok && len(v) > 0 {
+		i, err := strconv.ParseInt(v[0], 10, 64)
+		if err == nil {
+			in.MaxParts = aws.Int64(i)
+		}
+	}
+	if v, ok := header["X-Amz-Object-Attributes"]; ok && len(v) > 0 {
+		for _, s := range strings.Split(strings.Join(v, ","), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				in.ObjectAttributes = append(in.ObjectAttributes, aws.String(s))
+			}
+		}
+	}
+	if v, ok := header["X-Amz-Part-Number-Marker"]; ok && len(v) > 0 {
+		i, err := strconv.ParseInt(v[0], 10, 64)
+		if err == nil {
+			in.PartNumberMarker = aws.Int64(i)
+		}
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Algorithm"]; ok && len(v) > 0 {
+		in.SSECustomerAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key"]; ok && len(v) > 0 {
+		in.SSECustomerKey = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key-Md5"]; ok && len(v) > 0 {
+		in.SSECustomerKeyMD5 = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetObjectRetentionInput(req *http.Request) *s3.GetObjectRetentionInput {
+	var in s3.GetObjectRetentionInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newPutObjectRetentionInput(req *http.Request) *s3.PutObjectRetentionInput {
+	var in s3.PutObjectRetentionInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Bypass-Governance-Retention"]; ok && len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err == nil {
+			in.BypassGovernanceRetention = aws.Bool(b)
+		}
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetObjectLegalHoldInput(req *http.Request) *s3.GetObjectLegalHoldInput {
+	var in s3.GetObjectLegalHoldInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newPutObjectLegalHoldInput(req *http.Request) *s3.PutObjectLegalHoldInput {
+	var in s3.PutObjectLegalHoldInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetObjectAclInput(req *http.Request) *s3.GetObjectAclInput {
+	var in s3.GetObjectAclInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newPutObjectAclInput(req *http.Request) *s3.PutObjectAclInput {
+	var in s3.PutObjectAclInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		query = make(url.Values)
+	}
+	if v, ok := header["X-Amz-Acl"]; ok && len(v) > 0 {
+		in.ACL = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Full-Control"]; ok && len(v) > 0 {
+		in.GrantFullControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read"]; ok && len(v) > 0 {
+		in.GrantRead = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read-Acp"]; ok && len(v) > 0 {
+		in.GrantReadACP = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write"]; ok && len(v) > 0 {
+		in.GrantWrite = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write-Acp"]; ok && len(v) > 0 {
+		in.GrantWriteACP = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := query["versionId"]; ok && len(v) > 0 {
+		in.VersionId = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketAclInput(req *http.Request) *s3.GetBucketAclInput {
+	var in s3.GetBucketAclInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newPutBucketAclInput(req *http.Request) *s3.PutBucketAclInput {
+	var in s3.PutBucketAclInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Acl"]; ok && len(v) > 0 {
+		in.ACL = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Full-Control"]; ok && len(v) > 0 {
+		in.GrantFullControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read"]; ok && len(v) > 0 {
+		in.GrantRead = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read-Acp"]; ok && len(v) > 0 {
+		in.GrantReadACP = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write"]; ok && len(v) > 0 {
+		in.GrantWrite = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write-Acp"]; ok && len(v) > 0 {
+		in.GrantWriteACP = aws.String(v[0])
+	}
+	return &in
+}
+
+func newHeadBucketInput(req *http.Request) *s3.HeadBucketInput {
+	var in s3.HeadBucketInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketLocationInput(req *http.Request) *s3.GetBucketLocationInput {
+	var in s3.GetBucketLocationInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketVersioningInput(req *http.Request) *s3.GetBucketVersioningInput {
+	var in s3.GetBucketVersioningInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketPolicyInput(req *http.Request) *s3.GetBucketPolicyInput {
+	var in s3.GetBucketPolicyInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketLifecycleConfigurationInput(req *http.Request) *s3.GetBucketLifecycleConfigurationInput {
+	var in s3.GetBucketLifecycleConfigurationInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketCorsInput(req *http.Request) *s3.GetBucketCorsInput {
+	var in s3.GetBucketCorsInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketEncryptionInput(req *http.Request) *s3.GetBucketEncryptionInput {
+	var in s3.GetBucketEncryptionInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketTaggingInput(req *http.Request) *s3.GetBucketTaggingInput {
+	var in s3.GetBucketTaggingInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetBucketOwnershipControlsInput(req *http.Request) *s3.GetBucketOwnershipControlsInput {
+	var in s3.GetBucketOwnershipControlsInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newGetPublicAccessBlockInput(req *http.Request) *s3.GetPublicAccessBlockInput {
+	var in s3.GetPublicAccessBlockInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	return &in
+}
+
+func newCopyObjectInput(req *http.Request) *s3.CopyObjectInput {
+	var in s3.CopyObjectInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Acl"]; ok && len(v) > 0 {
+		in.ACL = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"]; ok && len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err == nil {
+			in.BucketKeyEnabled = aws.Bool(b)
+		}
+	}
+	if v, ok := header["Cache-Control"]; ok && len(v) > 0 {
+		in.CacheControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["Content-Disposition"]; ok && len(v) > 0 {
+		in.ContentDisposition = aws.String(v[0])
+	}
+	if v, ok := header["Content-Encoding"]; ok && len(v) > 0 {
+		in.ContentEncoding = aws.String(v[0])
+	}
+	if v, ok := header["Content-Language"]; ok && len(v) > 0 {
+		in.ContentLanguage = aws.String(v[0])
+	}
+	if v, ok := header["Content-Type"]; ok && len(v) > 0 {
+		in.ContentType = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Copy-Source"]; ok && len(v) > 0 {
+		in.CopySource = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Copy-Source-If-Match"]; ok && len(v) > 0 {
+		in.CopySourceIfMatch = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Copy-Source-If-Modified-Since"]; ok && len(v) > 0 {
+		t, err := http.ParseTime(v[0])
+		if err == nil {
+			in.CopySourceIfModifiedSince = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Copy-Source-If-None-Match"]; ok && len(v) > 0 {
+		in.CopySourceIfNoneMatch = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Copy-Source-If-Unmodified-Since"]; ok && len(v) > 0 {
+		t, err := http.ParseTime(v[0])
+		if err == nil {
+			in.CopySourceIfUnmodifiedSince = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm"]; ok && len(v) > 0 {
+		in.CopySourceSSECustomerAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"]; ok && len(v) > 0 {
+		in.CopySourceSSECustomerKey = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5"]; ok && len(v) > 0 {
+		in.CopySourceSSECustomerKeyMD5 = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Source-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedSourceBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["Expires"]; ok && len(v) > 0 {
+		t, err := http.ParseTime(v[0])
+		if err == nil {
+			in.Expires = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Grant-Full-Control"]; ok && len(v) > 0 {
+		in.GrantFullControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read"]; ok && len(v) > 0 {
+		in.GrantRead = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read-Acp"]; ok && len(v) > 0 {
+		in.GrantReadACP = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write-Acp"]; ok && len(v) > 0 {
+		in.GrantWriteACP = aws.String(v[0])
+	}
+	for k, v := range header {
+		if len(v) == 0 || !strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			continue
+		}
+		if in.Metadata == nil {
+			in.Metadata = make(map[string]*string)
+		}
+		in.Metadata[k[len("x-amz-meta-"):]] = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Metadata-Directive"]; ok && len(v) > 0 {
+		in.MetadataDirective = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Legal-Hold"]; ok && len(v) > 0 {
+		in.ObjectLockLegalHoldStatus = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Mode"]; ok && len(v) > 0 {
+		in.ObjectLockMode = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Retain-Until-Date"]; ok && len(v) > 0 {
+		t, err := time.Parse(time.RFC3339, v[0])
+		if err == nil {
+			in.ObjectLockRetainUntilDate = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Algorithm"]; ok && len(v) > 0 {
+		in.SSECustomerAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key"]; ok && len(v) > 0 {
+		in.SSECustomerKey = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key-Md5"]; ok && len(v) > 0 {
+		in.SSECustomerKeyMD5 = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Context"]; ok && len(v) > 0 {
+		in.SSEKMSEncryptionContext = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"]; ok && len(v) > 0 {
+		in.SSEKMSKeyId = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption"]; ok && len(v) > 0 {
+		in.ServerSideEncryption = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Storage-Class"]; ok && len(v) > 0 {
+		in.StorageClass = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Tagging"]; ok && len(v) > 0 {
+		in.Tagging = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Tagging-Directive"]; ok && len(v) > 0 {
+		in.TaggingDirective = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Website-Redirect-Location"]; ok && len(v) > 0 {
+		in.WebsiteRedirectLocation = aws.String(v[0])
+	}
+	return &in
+}
+
+func newCreateMultipartUploadInput(req *http.Request) *s3.CreateMultipartUploadInput {
+	var in s3.CreateMultipartUploadInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Acl"]; ok && len(v) > 0 {
+		in.ACL = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"]; ok && len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err == nil {
+			in.BucketKeyEnabled = aws.Bool(b)
+		}
+	}
+	if v, ok := header["Cache-Control"]; ok && len(v) > 0 {
+		in.CacheControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["Content-Disposition"]; ok && len(v) > 0 {
+		in.ContentDisposition = aws.String(v[0])
+	}
+	if v, ok := header["Content-Encoding"]; ok && len(v) > 0 {
+		in.ContentEncoding = aws.String(v[0])
+	}
+	if v, ok := header["Content-Language"]; ok && len(v) > 0 {
+		in.ContentLanguage = aws.String(v[0])
+	}
+	if v, ok := header["Content-Type"]; ok && len(v) > 0 {
+		in.ContentType = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["Expires"]; ok && len(v) > 0 {
+		t, err := http.ParseTime(v[0])
+		if err == nil {
+			in.Expires = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Grant-Full-Control"]; ok && len(v) > 0 {
+		in.GrantFullControl = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read"]; ok && len(v) > 0 {
+		in.GrantRead = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Read-Acp"]; ok && len(v) > 0 {
+		in.GrantReadACP = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Grant-Write-Acp"]; ok && len(v) > 0 {
+		in.GrantWriteACP = aws.String(v[0])
+	}
+	for k, v := range header {
+		if len(v) == 0 || !strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			continue
+		}
+		if in.Metadata == nil {
+			in.Metadata = make(map[string]*string)
+		}
+		in.Metadata[k[len("x-amz-meta-"):]] = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Legal-Hold"]; ok && len(v) > 0 {
+		in.ObjectLockLegalHoldStatus = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Mode"]; ok && len(v) > 0 {
+		in.ObjectLockMode = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Object-Lock-Retain-Until-Date"]; ok && len(v) > 0 {
+		t, err := time.Parse(time.RFC3339, v[0])
+		if err == nil {
+			in.ObjectLockRetainUntilDate = aws.Time(t)
+		}
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Algorithm"]; ok && len(v) > 0 {
+		in.SSECustomerAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key"]; ok && len(v) > 0 {
+		in.SSECustomerKey = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Customer-Key-Md5"]; ok && len(v) > 0 {
+		in.SSECustomerKeyMD5 = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Context"]; ok && len(v) > 0 {
+		in.SSEKMSEncryptionContext = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"]; ok && len(v) > 0 {
+		in.SSEKMSKeyId = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Server-Side-Encryption"]; ok && len(v) > 0 {
+		in.ServerSideEncryption = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Storage-Class"]; ok && len(v) > 0 {
+		in.StorageClass = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Tagging"]; ok && len(v) > 0 {
+		in.Tagging = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Website-Redirect-Location"]; ok && len(v) > 0 {
+		in.WebsiteRedirectLocation = aws.String(v[0])
+	}
+	return &in
+}
+
+func newDeleteObjectsInput(req *http.Request) *s3.DeleteObjectsInput {
+	var in s3.DeleteObjectsInput
+	header := req.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	if v, ok := header["X-Amz-Bypass-Governance-Retention"]; ok && len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err == nil {
+			in.BypassGovernanceRetention = aws.Bool(b)
+		}
+	}
+	if v, ok := header["X-Amz-Sdk-Checksum-Algorithm"]; ok && len(v) > 0 {
+		in.ChecksumAlgorithm = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Expected-Bucket-Owner"]; ok && len(v) > 0 {
+		in.ExpectedBucketOwner = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Mfa"]; ok && len(v) > 0 {
+		in.MFA = aws.String(v[0])
+	}
+	if v, ok := header["X-Amz-Request-Payer"]; ok && len(v) > 0 {
+		in.RequestPayer = aws.String(v[0])
+	}
+	return &in
+}
+
 func makeHeaderFromGetObjectOutput(out *s3.GetObjectOutput) http.Header {
 	header := make(http.Header)
 	if out == nil {
 		return header
 	}
-	if out.AcceptRanges != nil {
-		header.Set("Accept-Ranges", aws.StringValue(out.AcceptRanges))
+	if out.AcceptRanges != nil {
+		header.Set("Accept-Ranges", aws.StringValue(out.AcceptRanges))
+	}
+	if out.BucketKeyEnabled != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", strconv.FormatBool(aws.BoolValue(out.BucketKeyEnabled)))
+	}
+	if out.CacheControl != nil {
+		header.Set("Cache-Control", aws.StringValue(out.CacheControl))
+	}
+	if out.ChecksumCRC32 != nil {
+		header.Set("X-Amz-Checksum-Crc32", aws.StringValue(out.ChecksumCRC32))
+	}
+	if out.ChecksumCRC32C != nil {
+		header.Set("X-Amz-Checksum-Crc32c", aws.StringValue(out.ChecksumCRC32C))
+	}
+	if out.ChecksumSHA1 != nil {
+		header.Set("X-Amz-Checksum-Sha1", aws.StringValue(out.ChecksumSHA1))
+	}
+	if out.ChecksumSHA256 != nil {
+		header.Set("X-Amz-Checksum-Sha256", aws.StringValue(out.ChecksumSHA256))
+	}
+	if out.ContentDisposition != nil {
+		header.Set("Content-Disposition", aws.StringValue(out.ContentDisposition))
+	}
+	if out.ContentEncoding != nil {
+		header.Set("Content-Encoding", aws.StringValue(out.ContentEncoding))
+	}
+	if out.ContentLanguage != nil {
+		header.Set("Content-Language", aws.StringValue(out.ContentLanguage))
+	}
+	if out.ContentLength != nil {
+		header.Set("Content-Length", strconv.FormatInt(aws.Int64Value(out.ContentLength), 10))
+	}
+	if out.ContentRange != nil {
+		header.Set("Content-Range", aws.StringValue(out.ContentRange))
+	}
+	if out.ContentType != nil {
+		header.Set("Content-Type", aws.StringValue(out.ContentType))
+	}
+	if out.DeleteMarker != nil {
+		header.Set("X-Amz-Delete-Marker", strconv.FormatBool(aws.BoolValue(out.DeleteMarker)))
+	}
+	if out.ETag != nil {
+		header.Set("Etag", aws.StringValue(out.ETag))
+	}
+	if out.Expiration != nil {
+		header.Set("X-Amz-Expiration", aws.StringValue(out.Expiration))
+	}
+	if out.Expires != nil {
+		header.Set("Expires", aws.StringValue(out.Expires))
+	}
+	if out.LastModified != nil {
+		header.Set("Last-Modified", out.LastModified.Format(http.TimeFormat))
+	}
+	if out.MissingMeta != nil {
+		header.Set("X-Amz-Missing-Meta", strconv.FormatInt(aws.Int64Value(out.MissingMeta), 10))
+	}
+	if out.ObjectLockLegalHoldStatus != nil {
+		header.Set("X-Amz-Object-Lock-Legal-Hold", aws.StringValue(out.ObjectLockLegalHoldStatus))
+	}
+	if out.ObjectLockMode != nil {
+		header.Set("X-Amz-Object-Lock-Mode", aws.StringValue(out.ObjectLockMode))
+	}
+	if out.ObjectLockRetainUntilDate != nil {
+		header.Set("X-Amz-Object-Lock-Retain-Until-Date", out.ObjectLockRetainUntilDate.UTC().Format(time.RFC3339))
+	}
+	if out.PartsCount != nil {
+		header.Set("X-Amz-Mp-Parts-Count", strconv.FormatInt(aws.Int64Value(out.PartsCount), 10))
+	}
+	if out.ReplicationStatus != nil {
+		header.Set("X-Amz-Replication-Status", aws.StringValue(out.ReplicationStatus))
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	if out.Restore != nil {
+		header.Set("X-Amz-Restore", aws.StringValue(out.Restore))
+	}
+	if out.SSECustomerAlgorithm != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", aws.StringValue(out.SSECustomerAlgorithm))
+	}
+	if out.SSECustomerKeyMD5 != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", aws.StringValue(out.SSECustomerKeyMD5))
+	}
+	if out.SSEKMSKeyId != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", aws.StringValue(out.SSEKMSKeyId))
+	}
+	if out.ServerSideEncryption != nil {
+		header.Set("X-Amz-Server-Side-Encryption", aws.StringValue(out.ServerSideEncryption))
+	}
+	if out.StorageClass != nil {
+		header.Set("X-Amz-Storage-Class", aws.StringValue(out.StorageClass))
+	}
+	if out.TagCount != nil {
+		header.Set("X-Amz-Tagging-Count", strconv.FormatInt(aws.Int64Value(out.TagCount), 10))
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	if out.WebsiteRedirectLocation != nil {
+		header.Set("X-Amz-Website-Redirect-Location", aws.StringValue(out.WebsiteRedirectLocation))
+	}
+	return header
+}
+
+func makeHeaderFromHeadObjectOutput(out *s3.HeadObjectOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.AcceptRanges != nil {
+		header.Set("Accept-Ranges", aws.StringValue(out.AcceptRanges))
+	}
+	if out.ArchiveStatus != nil {
+		header.Set("X-Amz-Archive-Status", aws.StringValue(out.ArchiveStatus))
+	}
+	if out.BucketKeyEnabled != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", strconv.FormatBool(aws.BoolValue(out.BucketKeyEnabled)))
+	}
+	if out.CacheControl != nil {
+		header.Set("Cache-Control", aws.StringValue(out.CacheControl))
+	}
+	if out.ChecksumCRC32 != nil {
+		header.Set("X-Amz-Checksum-Crc32", aws.StringValue(out.ChecksumCRC32))
+	}
+	if out.ChecksumCRC32C != nil {
+		header.Set("X-Amz-Checksum-Crc32c", aws.StringValue(out.ChecksumCRC32C))
+	}
+	if out.ChecksumSHA1 != nil {
+		header.Set("X-Amz-Checksum-Sha1", aws.StringValue(out.ChecksumSHA1))
+	}
+	if out.ChecksumSHA256 != nil {
+		header.Set("X-Amz-Checksum-Sha256", aws.StringValue(out.ChecksumSHA256))
+	}
+	if out.ContentDisposition != nil {
+		header.Set("Content-Disposition", aws.StringValue(out.ContentDisposition))
+	}
+	if out.ContentEncoding != nil {
+		header.Set("Content-Encoding", aws.StringValue(out.ContentEncoding))
+	}
+	if out.ContentLanguage != nil {
+		header.Set("Content-Language", aws.StringValue(out.ContentLanguage))
+	}
+	if out.ContentLength != nil {
+		header.Set("Content-Length", strconv.FormatInt(aws.Int64Value(out.ContentLength), 10))
+	}
+	if out.ContentType != nil {
+		header.Set("Content-Type", aws.StringValue(out.ContentType))
+	}
+	if out.DeleteMarker != nil {
+		header.Set("X-Amz-Delete-Marker", strconv.FormatBool(aws.BoolValue(out.DeleteMarker)))
+	}
+	if out.ETag != nil {
+		header.Set("Etag", aws.StringValue(out.ETag))
+	}
+	if out.Expiration != nil {
+		header.Set("X-Amz-Expiration", aws.StringValue(out.Expiration))
+	}
+	if out.Expires != nil {
+		header.Set("Expires", aws.StringValue(out.Expires))
+	}
+	if out.LastModified != nil {
+		header.Set("Last-Modified", out.LastModified.Format(http.TimeFormat))
+	}
+	if out.MissingMeta != nil {
+		header.Set("X-Amz-Missing-Meta", strconv.FormatInt(aws.Int64Value(out.MissingMeta), 10))
+	}
+	if out.ObjectLockLegalHoldStatus != nil {
+		header.Set("X-Amz-Object-Lock-Legal-Hold", aws.StringValue(out.ObjectLockLegalHoldStatus))
+	}
+	if out.ObjectLockMode != nil {
+		header.Set("X-Amz-Object-Lock-Mode", aws.StringValue(out.ObjectLockMode))
+	}
+	if out.ObjectLockRetainUntilDate != nil {
+		header.Set("X-Amz-Object-Lock-Retain-Until-Date", out.ObjectLockRetainUntilDate.UTC().Format(time.RFC3339))
+	}
+	if out.PartsCount != nil {
+		header.Set("X-Amz-Mp-Parts-Count", strconv.FormatInt(aws.Int64Value(out.PartsCount), 10))
+	}
+	if out.ReplicationStatus != nil {
+		header.Set("X-Amz-Replication-Status", aws.StringValue(out.ReplicationStatus))
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	if out.Restore != nil {
+		header.Set("X-Amz-Restore", aws.StringValue(out.Restore))
+	}
+	if out.SSECustomerAlgorithm != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", aws.StringValue(out.SSECustomerAlgorithm))
+	}
+	if out.SSECustomerKeyMD5 != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", aws.StringValue(out.SSECustomerKeyMD5))
+	}
+	if out.SSEKMSKeyId != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", aws.StringValue(out.SSEKMSKeyId))
+	}
+	if out.ServerSideEncryption != nil {
+		header.Set("X-Amz-Server-Side-Encryption", aws.StringValue(out.ServerSideEncryption))
+	}
+	if out.StorageClass != nil {
+		header.Set("X-Amz-Storage-Class", aws.StringValue(out.StorageClass))
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	if out.WebsiteRedirectLocation != nil {
+		header.Set("X-Amz-Website-Redirect-Location", aws.StringValue(out.WebsiteRedirectLocation))
+	}
+	return header
+}
+
+func makeHeaderFromPutObjectOutput(out *s3.PutObjectOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.BucketKeyEnabled != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", strconv.FormatBool(aws.BoolValue(out.BucketKeyEnabled)))
+	}
+	if out.ChecksumCRC32 != nil {
+		header.Set("X-Amz-Checksum-Crc32", aws.StringValue(out.ChecksumCRC32))
+	}
+	if out.ChecksumCRC32C != nil {
+		header.Set("X-Amz-Checksum-Crc32c", aws.StringValue(out.ChecksumCRC32C))
+	}
+	if out.ChecksumSHA1 != nil {
+		header.Set("X-Amz-Checksum-Sha1", aws.StringValue(out.ChecksumSHA1))
+	}
+	if out.ChecksumSHA256 != nil {
+		header.Set("X-Amz-Checksum-Sha256", aws.StringValue(out.ChecksumSHA256))
+	}
+	if out.ETag != nil {
+		header.Set("Etag", aws.StringValue(out.ETag))
+	}
+	if out.Expiration != nil {
+		header.Set("X-Amz-Expiration", aws.StringValue(out.Expiration))
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	if out.SSECustomerAlgorithm != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", aws.StringValue(out.SSECustomerAlgorithm))
+	}
+	if out.SSECustomerKeyMD5 != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", aws.StringValue(out.SSECustomerKeyMD5))
+	}
+	if out.SSEKMSEncryptionContext != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Context", aws.StringValue(out.SSEKMSEncryptionContext))
+	}
+	if out.SSEKMSKeyId != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", aws.StringValue(out.SSEKMSKeyId))
+	}
+	if out.ServerSideEncryption != nil {
+		header.Set("X-Amz-Server-Side-Encryption", aws.StringValue(out.ServerSideEncryption))
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	return header
+}
+
+func makeHeaderFromDeleteObjectOutput(out *s3.DeleteObjectOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.DeleteMarker != nil {
+		header.Set("X-Amz-Delete-Marker", strconv.FormatBool(aws.BoolValue(out.DeleteMarker)))
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	return header
+}
+
+func makeHeaderFromRestoreObjectOutput(out *s3.RestoreObjectOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	if out.RestoreOutputPath != nil {
+		header.Set("X-Amz-Restore-Output-Path", aws.StringValue(out.RestoreOutputPath))
+	}
+	return header
+}
+
+func makeHeaderFromGetObjectTaggingOutput(out *s3.GetObjectTaggingOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	return header
+}
+
+func makeHeaderFromPutObjectTaggingOutput(out *s3.PutObjectTaggingOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	return header
+}
+
+func makeHeaderFromDeleteObjectTaggingOutput(out *s3.DeleteObjectTaggingOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	return header
+}
+
+func makeHeaderFromGetObjectAttributesOutput(out *s3.GetObjectAttributesOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.DeleteMarker != nil {
+		header.Set("X-Amz-Delete-Marker", strconv.FormatBool(aws.BoolValue(out.DeleteMarker)))
+	}
+	if out.LastModified != nil {
+		header.Set("Last-Modified", out.LastModified.Format(http.TimeFormat))
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	if out.VersionId != nil {
+		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
+	}
+	return header
+}
+
+func makeHeaderFromGetObjectRetentionOutput(out *s3.GetObjectRetentionOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	return header
+}
+
+func makeHeaderFromPutObjectRetentionOutput(out *s3.PutObjectRetentionOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
+	}
+	return header
+}
+
+func makeHeaderFromGetObjectLegalHoldOutput(out *s3.GetObjectLegalHoldOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
+	}
+	return header
+}
+
+func makeHeaderFromPutObjectLegalHoldOutput(out *s3.PutObjectLegalHoldOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.BucketKeyEnabled != nil {
-		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", strconv.FormatBool(aws.BoolValue(out.BucketKeyEnabled)))
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
 	}
-	if out.CacheControl != nil {
-		header.Set("Cache-Control", aws.StringValue(out.CacheControl))
+	return header
+}
+
+func makeHeaderFromGetObjectAclOutput(out *s3.GetObjectAclOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ChecksumCRC32 != nil {
-		header.Set("X-Amz-Checksum-Crc32", aws.StringValue(out.ChecksumCRC32))
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
 	}
-	if out.ChecksumCRC32C != nil {
-		header.Set("X-Amz-Checksum-Crc32c", aws.StringValue(out.ChecksumCRC32C))
+	return header
+}
+
+func makeHeaderFromPutObjectAclOutput(out *s3.PutObjectAclOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ChecksumSHA1 != nil {
-		header.Set("X-Amz-Checksum-Sha1", aws.StringValue(out.ChecksumSHA1))
+	if out.RequestCharged != nil {
+		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
 	}
-	if out.ChecksumSHA256 != nil {
-		header.Set("X-Amz-Checksum-Sha256", aws.StringValue(out.ChecksumSHA256))
+	return header
+}
+
+func makeHeaderFromGetBucketAclOutput(out *s3.GetBucketAclOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ContentDisposition != nil {
-		header.Set("Content-Disposition", aws.StringValue(out.ContentDisposition))
+	return header
+}
+
+func makeHeaderFromPutBucketAclOutput(out *s3.PutBucketAclOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ContentEncoding != nil {
-		header.Set("Content-Encoding", aws.StringValue(out.ContentEncoding))
+	return header
+}
+
+func makeHeaderFromHeadBucketOutput(out *s3.HeadBucketOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ContentLanguage != nil {
-		header.Set("Content-Language", aws.StringValue(out.ContentLanguage))
+	if out.AccessPointAlias != nil {
+		header.Set("X-Amz-Access-Point-Alias", strconv.FormatBool(aws.BoolValue(out.AccessPointAlias)))
 	}
-	if out.ContentLength != nil {
-		header.Set("Content-Length", strconv.FormatInt(aws.Int64Value(out.ContentLength), 10))
+	if out.BucketLocationName != nil {
+		header.Set("X-Amz-Bucket-Location-Name", aws.StringValue(out.BucketLocationName))
 	}
-	if out.ContentRange != nil {
-		header.Set("Content-Range", aws.StringValue(out.ContentRange))
+	if out.BucketLocationType != nil {
+		header.Set("X-Amz-Bucket-Location-Type", aws.StringValue(out.BucketLocationType))
 	}
-	if out.ContentType != nil {
-		header.Set("Content-Type", aws.StringValue(out.ContentType))
+	if out.BucketRegion != nil {
+		header.Set("X-Amz-Bucket-Region", aws.StringValue(out.BucketRegion))
 	}
-	if out.DeleteMarker != nil {
-		header.Set("X-Amz-Delete-Marker", strconv.FormatBool(aws.BoolValue(out.DeleteMarker)))
+	return header
+}
+
+func makeHeaderFromGetBucketLocationOutput(out *s3.GetBucketLocationOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ETag != nil {
-		header.Set("Etag", aws.StringValue(out.ETag))
+	return header
+}
+
+func makeHeaderFromGetBucketVersioningOutput(out *s3.GetBucketVersioningOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.Expiration != nil {
-		header.Set("X-Amz-Expiration", aws.StringValue(out.Expiration))
+	return header
+}
+
+func makeHeaderFromGetBucketPolicyOutput(out *s3.GetBucketPolicyOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.Expires != nil {
-		header.Set("Expires", aws.StringValue(out.Expires))
+	return header
+}
+
+func makeHeaderFromGetBucketLifecycleConfigurationOutput(out *s3.GetBucketLifecycleConfigurationOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.LastModified != nil {
-		header.Set("Last-Modified", out.LastModified.Format(http.TimeFormat))
+	return header
+}
+
+func makeHeaderFromGetBucketCorsOutput(out *s3.GetBucketCorsOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.MissingMeta != nil {
-		header.Set("X-Amz-Missing-Meta", strconv.FormatInt(aws.Int64Value(out.MissingMeta), 10))
+	return header
+}
+
+func makeHeaderFromGetBucketEncryptionOutput(out *s3.GetBucketEncryptionOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ObjectLockLegalHoldStatus != nil {
-		header.Set("X-Amz-Object-Lock-Legal-Hold", aws.StringValue(out.ObjectLockLegalHoldStatus))
+	return header
+}
+
+func makeHeaderFromGetBucketTaggingOutput(out *s3.GetBucketTaggingOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ObjectLockMode != nil {
-		header.Set("X-Amz-Object-Lock-Mode", aws.StringValue(out.ObjectLockMode))
+	return header
+}
+
+func makeHeaderFromGetBucketOwnershipControlsOutput(out *s3.GetBucketOwnershipControlsOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ObjectLockRetainUntilDate != nil {
-		header.Set("X-Amz-Object-Lock-Retain-Until-Date", out.ObjectLockRetainUntilDate.Format(http.TimeFormat))
+	return header
+}
+
+func makeHeaderFromGetPublicAccessBlockOutput(out *s3.GetPublicAccessBlockOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.PartsCount != nil {
-		header.Set("X-Amz-Mp-Parts-Count", strconv.FormatInt(aws.Int64Value(out.PartsCount), 10))
+	return header
+}
+
+func makeHeaderFromCopyObjectOutput(out *s3.CopyObjectOutput) http.Header {
+	header := make(http.Header)
+	if out == nil {
+		return header
 	}
-	if out.ReplicationStatus != nil {
-		header.Set("X-Amz-Replication-Status", aws.StringValue(out.ReplicationStatus))
+	if out.BucketKeyEnabled != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", strconv.FormatBool(aws.BoolValue(out.BucketKeyEnabled)))
+	}
+	if out.CopySourceVersionId != nil {
+		header.Set("X-Amz-Copy-Source-Version-Id", aws.StringValue(out.CopySourceVersionId))
+	}
+	if out.Expiration != nil {
+		header.Set("X-Amz-Expiration", aws.StringValue(out.Expiration))
 	}
 	if out.RequestCharged != nil {
 		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
 	}
-	if out.Restore != nil {
-		header.Set("X-Amz-Restore", aws.StringValue(out.Restore))
-	}
 	if out.SSECustomerAlgorithm != nil {
 		header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", aws.StringValue(out.SSECustomerAlgorithm))
 	}
 	if out.SSECustomerKeyMD5 != nil {
 		header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", aws.StringValue(out.SSECustomerKeyMD5))
 	}
+	if out.SSEKMSEncryptionContext != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Context", aws.StringValue(out.SSEKMSEncryptionContext))
+	}
 	if out.SSEKMSKeyId != nil {
 		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", aws.StringValue(out.SSEKMSKeyId))
 	}
 	if out.ServerSideEncryption != nil {
 		header.Set("X-Amz-Server-Side-Encryption", aws.StringValue(out.ServerSideEncryption))
 	}
-	if out.StorageClass != nil {
-		header.Set("X-Amz-Storage-Class", aws.StringValue(out.StorageClass))
-	}
-	if out.TagCount != nil {
-		header.Set("X-Amz-Tagging-Count", strconv.FormatInt(aws.Int64Value(out.TagCount), 10))
-	}
 	if out.VersionId != nil {
 		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
 	}
-	if out.WebsiteRedirectLocation != nil {
-		header.Set("X-Amz-Website-Redirect-Location", aws.StringValue(out.WebsiteRedirectLocation))
-	}
 	return header
 }
 
-func makeHeaderFromHeadObjectOutput(out *s3.HeadObjectOutput) http.Header {
+func makeHeaderFromCompleteMultipartUploadOutput(out *s3.CompleteMultipartUploadOutput) http.Header {
 	header := make(http.Header)
 	if out == nil {
 		return header
 	}
-	if out.AcceptRanges != nil {
-		header.Set("Accept-Ranges", aws.StringValue(out.AcceptRanges))
-	}
-	if out.ArchiveStatus != nil {
-		header.Set("X-Amz-Archive-Status", aws.StringValue(out.ArchiveStatus))
-	}
 	if out.BucketKeyEnabled != nil {
 		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", strconv.FormatBool(aws.BoolValue(out.BucketKeyEnabled)))
 	}
-	if out.CacheControl != nil {
-		header.Set("Cache-Control", aws.StringValue(out.CacheControl))
-	}
-	if out.ChecksumCRC32 != nil {
-		header.Set("X-Amz-Checksum-Crc32", aws.StringValue(out.ChecksumCRC32))
-	}
-	if out.ChecksumCRC32C != nil {
-		header.Set("X-Amz-Checksum-Crc32c", aws.StringValue(out.ChecksumCRC32C))
-	}
-	if out.ChecksumSHA1 != nil {
-		header.Set("X-Amz-Checksum-Sha1", aws.StringValue(out.ChecksumSHA1))
-	}
-	if out.ChecksumSHA256 != nil {
-		header.Set("X-Amz-Checksum-Sha256", aws.StringValue(out.ChecksumSHA256))
-	}
-	if out.ContentDisposition != nil {
-		header.Set("Content-Disposition", aws.StringValue(out.ContentDisposition))
-	}
-	if out.ContentEncoding != nil {
-		header.Set("Content-Encoding", aws.StringValue(out.ContentEncoding))
-	}
-	if out.ContentLanguage != nil {
-		header.Set("Content-Language", aws.StringValue(out.ContentLanguage))
-	}
-	if out.ContentLength != nil {
-		header.Set("Content-Length", strconv.FormatInt(aws.Int64Value(out.ContentLength), 10))
-	}
-	if out.ContentType != nil {
-		header.Set("Content-Type", aws.StringValue(out.ContentType))
-	}
-	if out.DeleteMarker != nil {
-		header.Set("X-Amz-Delete-Marker", strconv.FormatBool(aws.BoolValue(out.DeleteMarker)))
-	}
-	if out.ETag != nil {
-		header.Set("Etag", aws.StringValue(out.ETag))
-	}
 	if out.Expiration != nil {
 		header.Set("X-Amz-Expiration", aws.StringValue(out.Expiration))
 	}
-	if out.Expires != nil {
-		header.Set("Expires", aws.StringValue(out.Expires))
-	}
-	if out.LastModified != nil {
-		header.Set("Last-Modified", out.LastModified.Format(http.TimeFormat))
-	}
-	if out.MissingMeta != nil {
-		header.Set("X-Amz-Missing-Meta", strconv.FormatInt(aws.Int64Value(out.MissingMeta), 10))
-	}
-	if out.ObjectLockLegalHoldStatus != nil {
-		header.Set("X-Amz-Object-Lock-Legal-Hold", aws.StringValue(out.ObjectLockLegalHoldStatus))
-	}
-	if out.ObjectLockMode != nil {
-		header.Set("X-Amz-Object-Lock-Mode", aws.StringValue(out.ObjectLockMode))
-	}
-	if out.ObjectLockRetainUntilDate != nil {
-		header.Set("X-Amz-Object-Lock-Retain-Until-Date", out.ObjectLockRetainUntilDate.Format(http.TimeFormat))
-	}
-	if out.PartsCount != nil {
-		header.Set("X-Amz-Mp-Parts-Count", strconv.FormatInt(aws.Int64Value(out.PartsCount), 10))
-	}
-	if out.ReplicationStatus != nil {
-		header.Set("X-Amz-Replication-Status", aws.StringValue(out.ReplicationStatus))
-	}
 	if out.RequestCharged != nil {
 		header.Set("X-Amz-Request-Charged", aws.StringValue(out.RequestCharged))
 	}
-	if out.Restore != nil {
-		header.Set("X-Amz-Restore", aws.StringValue(out.Restore))
-	}
-	if out.SSECustomerAlgorithm != nil {
-		header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", aws.StringValue(out.SSECustomerAlgorithm))
-	}
-	if out.SSECustomerKeyMD5 != nil {
-		header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", aws.StringValue(out.SSECustomerKeyMD5))
-	}
 	if out.SSEKMSKeyId != nil {
 		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", aws.StringValue(out.SSEKMSKeyId))
 	}
 	if out.ServerSideEncryption != nil {
 		header.Set("X-Amz-Server-Side-Encryption", aws.StringValue(out.ServerSideEncryption))
 	}
-	if out.StorageClass != nil {
-		header.Set("X-Amz-Storage-Class", aws.StringValue(out.StorageClass))
-	}
 	if out.VersionId != nil {
 		header.Set("X-Amz-Version-Id", aws.StringValue(out.VersionId))
 	}
-	if out.WebsiteRedirectLocation != nil {
-		header.Set("X-Amz-Website-Redirect-Location", aws.StringValue(out.WebsiteRedirectLocation))
-	}
 	return header
 }
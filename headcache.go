@@ -0,0 +1,189 @@
+package s3protocol
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	defaultHeadCacheTTL         = time.Minute
+	defaultHeadCacheNegativeTTL = 5 * time.Second
+	defaultHeadCacheMaxEntries  = 10000
+)
+
+// HeadCache caches the responses of HEAD requests.
+// It also caches 404 Not Found responses for a short time, so existence checks of missing keys don't hit S3.
+// The entries of an object are invalidated when the object is written or deleted through the same Transport.
+// The zero value is a valid cache with the default configuration.
+type HeadCache struct {
+	// TTL is how long the metadata of existing objects is cached.
+	// If TTL is zero, one minute is used.
+	TTL time.Duration
+
+	// NegativeTTL is how long 404 Not Found responses are cached.
+	// If NegativeTTL is zero, five seconds is used.
+	// If NegativeTTL is negative, 404 Not Found responses are not cached.
+	NegativeTTL time.Duration
+
+	// MaxEntries is the maximum number of the entries.
+	// If MaxEntries is zero, 10000 is used.
+	MaxEntries int
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[headCacheKey]*list.Element
+
+	// gen is incremented on every invalidation.
+	// responses fetched before the invalidation are not stored.
+	gen uint64
+}
+
+type headCacheKey struct {
+	bucket    string
+	key       string
+	versionID string
+}
+
+type headCacheEntry struct {
+	key        headCacheKey
+	statusCode int
+	header     http.Header
+	expires    time.Time
+}
+
+// isHeadCacheable reports whether the response of the request can be stored in the cache.
+func isHeadCacheable(in *s3.HeadObjectInput) bool {
+	return in.Range == nil && in.PartNumber == nil &&
+		in.IfMatch == nil && in.IfNoneMatch == nil && in.IfModifiedSince == nil && in.IfUnmodifiedSince == nil &&
+		in.SSECustomerKey == nil && in.ChecksumMode == nil
+}
+
+func (c *HeadCache) ttl(statusCode int) (time.Duration, bool) {
+	switch statusCode {
+	case http.StatusOK:
+		if c.TTL > 0 {
+			return c.TTL, true
+		}
+		return defaultHeadCacheTTL, true
+	case http.StatusNotFound:
+		if c.NegativeTTL > 0 {
+			return c.NegativeTTL, true
+		}
+		if c.NegativeTTL == 0 {
+			return defaultHeadCacheNegativeTTL, true
+		}
+	}
+	return 0, false
+}
+
+func (c *HeadCache) maxEntries() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return defaultHeadCacheMaxEntries
+}
+
+func (c *HeadCache) headObject(in *s3.HeadObjectInput, fetch func(in *s3.HeadObjectInput) (*http.Response, error)) (*http.Response, error) {
+	key := headCacheKey{
+		bucket:    aws.StringValue(in.Bucket),
+		key:       aws.StringValue(in.Key),
+		versionID: aws.StringValue(in.VersionId),
+	}
+
+	c.mu.Lock()
+	c.init()
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*headCacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.ll.MoveToFront(e)
+			resp := entry.response()
+			c.mu.Unlock()
+			return resp, nil
+		}
+		c.removeLocked(key)
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	resp, err := fetch(in)
+	if err != nil {
+		return nil, err
+	}
+	ttl, ok := c.ttl(resp.StatusCode)
+	if !ok {
+		return resp, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		// the object may be modified while fetching.
+		return resp, nil
+	}
+	c.removeLocked(key)
+	c.entries[key] = c.ll.PushFront(&headCacheEntry{
+		key:        key,
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		expires:    time.Now().Add(ttl),
+	})
+	for c.ll.Len() > c.maxEntries() {
+		c.removeLocked(c.ll.Back().Value.(*headCacheEntry).key)
+	}
+	return resp, nil
+}
+
+func (c *HeadCache) init() {
+	if c.ll == nil {
+		c.ll = list.New()
+		c.entries = make(map[headCacheKey]*list.Element)
+	}
+}
+
+func (c *HeadCache) removeLocked(key headCacheKey) {
+	if e, ok := c.entries[key]; ok {
+		c.ll.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// Purge removes all versions of the object from the cache.
+func (c *HeadCache) Purge(bucket, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	c.gen++
+	for k := range c.entries {
+		if k.bucket == bucket && k.key == key {
+			c.removeLocked(k)
+		}
+	}
+}
+
+// Flush removes all entries from the cache.
+func (c *HeadCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.ll = nil
+	c.entries = nil
+}
+
+func (entry *headCacheEntry) response() *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", entry.statusCode, http.StatusText(entry.statusCode)),
+		StatusCode: entry.statusCode,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     entry.header.Clone(),
+		Body:       http.NoBody,
+		Close:      true,
+	}
+}
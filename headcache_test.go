@@ -0,0 +1,174 @@
+package s3protocol
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type headCacheTestObject struct {
+	exists bool
+	count  int
+}
+
+func (obj *headCacheTestObject) mock() *s3mock {
+	return &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			obj.count++
+			if !obj.exists {
+				aerr := awserr.New("NotFound", "not found", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+			}
+			return &s3.HeadObjectOutput{
+				ContentType: aws.String("image/png"),
+			}, nil
+		},
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			obj.exists = true
+			return &s3.PutObjectOutput{}, nil
+		},
+		deleteObjectWithContext: func(ctx context.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+			obj.exists = false
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}
+}
+
+func newHeadCacheTestClient(obj *headCacheTestObject, cache *HeadCache) *http.Client {
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+	s3.HeadCache = cache
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	return &http.Client{Transport: tr}
+}
+
+func headStatus(t *testing.T, c *http.Client, url string) int {
+	t.Helper()
+	resp, err := c.Head(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHeadCache(t *testing.T) {
+	obj := &headCacheTestObject{exists: true}
+	c := newHeadCacheTestClient(obj, &HeadCache{})
+
+	for i := 0; i < 3; i++ {
+		resp, err := c.Head("s3://bucket-name/object-key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if resp.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("want %s, got %s", "image/png", resp.Header.Get("Content-Type"))
+		}
+	}
+	if obj.count != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, obj.count)
+	}
+}
+
+func TestHeadCache_Negative(t *testing.T) {
+	obj := &headCacheTestObject{exists: false}
+	c := newHeadCacheTestClient(obj, &HeadCache{})
+
+	for i := 0; i < 3; i++ {
+		if got := headStatus(t, c, "s3://bucket-name/object-key"); got != http.StatusNotFound {
+			t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, got)
+		}
+	}
+	if obj.count != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, obj.count)
+	}
+}
+
+func TestHeadCache_NegativeDisabled(t *testing.T) {
+	obj := &headCacheTestObject{exists: false}
+	c := newHeadCacheTestClient(obj, &HeadCache{NegativeTTL: -1})
+
+	for i := 0; i < 3; i++ {
+		headStatus(t, c, "s3://bucket-name/object-key")
+	}
+	if obj.count != 3 {
+		t.Errorf("unexpected request count: want %d, got %d", 3, obj.count)
+	}
+}
+
+func TestHeadCache_Expires(t *testing.T) {
+	obj := &headCacheTestObject{exists: true}
+	c := newHeadCacheTestClient(obj, &HeadCache{TTL: time.Millisecond})
+
+	headStatus(t, c, "s3://bucket-name/object-key")
+	time.Sleep(10 * time.Millisecond)
+	headStatus(t, c, "s3://bucket-name/object-key")
+	if obj.count != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, obj.count)
+	}
+}
+
+func TestHeadCache_Invalidate(t *testing.T) {
+	obj := &headCacheTestObject{exists: false}
+	c := newHeadCacheTestClient(obj, &HeadCache{TTL: time.Hour, NegativeTTL: time.Hour})
+
+	if got := headStatus(t, c, "s3://bucket-name/object-key"); got != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, got)
+	}
+
+	// PUT invalidates the negative entry.
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := headStatus(t, c, "s3://bucket-name/object-key"); got != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, got)
+	}
+
+	// DELETE invalidates the positive entry.
+	req, err = http.NewRequest(http.MethodDelete, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := headStatus(t, c, "s3://bucket-name/object-key"); got != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, got)
+	}
+
+	if obj.count != 3 {
+		t.Errorf("unexpected request count: want %d, got %d", 3, obj.count)
+	}
+}
+
+func TestHeadCache_Flush(t *testing.T) {
+	obj := &headCacheTestObject{exists: true}
+	cache := &HeadCache{}
+	c := newHeadCacheTestClient(obj, cache)
+
+	headStatus(t, c, "s3://bucket-name/object-key")
+	cache.Flush()
+	headStatus(t, c, "s3://bucket-name/object-key")
+	if obj.count != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, obj.count)
+	}
+}
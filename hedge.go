@@ -0,0 +1,259 @@
+package s3protocol
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgeMaxRatio = 0.05
+
+	// the number of the latency samples for the percentile-based delay.
+	hedgeSamples = 1000
+
+	// the minimum number of the samples before the percentile-based delay is used.
+	hedgeMinSamples = 20
+
+	// the maximum number of the hedges that can be sent in a burst.
+	hedgeMaxBurst = 10
+
+	// the number of the observations between the computations of the percentile-based delay.
+	hedgeRecomputeInterval = 50
+)
+
+// HedgePolicy is the policy for hedged GET and HEAD requests.
+// If the response of a request doesn't arrive within the delay,
+// a duplicate request is sent and the first response wins.
+// The loser is canceled.
+// The zero value is not useful; either Delay or Percentile should be set.
+type HedgePolicy struct {
+	// Delay is the fixed delay before sending a hedged request.
+	// If Percentile is set, Delay is used until enough latencies are observed.
+	// If both Delay and Percentile are zero, no hedged request is sent.
+	Delay time.Duration
+
+	// Percentile is the percentile of the observed time-to-first-byte latencies used as the delay.
+	// For example, 0.95 sends a hedged request if the response is slower than 95% of the recent responses.
+	// If Percentile is zero, Delay is used.
+	Percentile float64
+
+	// MaxRatio is the maximum ratio of the hedged requests to all requests.
+	// If MaxRatio is zero, 0.05 is used.
+	MaxRatio float64
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int     // the index of samples to be overwritten
+	budget  float64 // the number of hedged requests that can be sent
+	stats   HedgeStats
+
+	// the cached percentile-based delay, recomputed every hedgeRecomputeInterval observations.
+	delay    time.Duration
+	computed bool
+	observed int
+}
+
+// HedgeStats is the statistics of HedgePolicy.
+type HedgeStats struct {
+	// Requests is the number of the hedgeable requests.
+	Requests int64
+
+	// Hedges is the number of the hedged requests sent.
+	Hedges int64
+
+	// Wins is the number of the hedged requests that responded faster than the original ones.
+	Wins int64
+
+	// Throttled is the number of the hedged requests not sent because of MaxRatio.
+	Throttled int64
+}
+
+// Stats returns the statistics of the policy.
+func (p *HedgePolicy) Stats() HedgeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+func (p *HedgePolicy) maxRatio() float64 {
+	if p.MaxRatio > 0 {
+		return p.MaxRatio
+	}
+	return defaultHedgeMaxRatio
+}
+
+// start records a new request, and returns the delay before hedging.
+// It returns false if the request should not be hedged.
+func (p *HedgePolicy) start() (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Requests++
+	p.budget = math.Min(hedgeMaxBurst, p.budget+p.maxRatio())
+
+	if p.Percentile > 0 && len(p.samples) >= hedgeMinSamples {
+		if !p.computed || p.observed >= hedgeRecomputeInterval {
+			p.delay = p.percentileLocked()
+			p.computed = true
+			p.observed = 0
+		}
+		return p.delay, true
+	}
+	if p.Delay > 0 {
+		return p.Delay, true
+	}
+	return 0, false
+}
+
+// percentileLocked returns the Percentile of the samples.
+func (p *HedgePolicy) percentileLocked() time.Duration {
+	sorted := make([]time.Duration, len(p.samples))
+	copy(sorted, p.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p.Percentile*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// allow consumes the budget for a hedged request.
+func (p *HedgePolicy) allow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.budget < 1 {
+		p.stats.Throttled++
+		return false
+	}
+	p.budget--
+	p.stats.Hedges++
+	return true
+}
+
+// observe records the latency of the original request.
+// If the hedged request wins, d is the time until the hedged response, a lower bound of the latency of the original request.
+func (p *HedgePolicy) observe(d time.Duration, hedged bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if hedged {
+		p.stats.Wins++
+	}
+	p.observed++
+	if len(p.samples) < hedgeSamples {
+		p.samples = append(p.samples, d)
+		return
+	}
+	p.samples[p.next] = d
+	p.next = (p.next + 1) % hedgeSamples
+}
+
+type hedgeResult struct {
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+	hedged bool
+	end    time.Time
+}
+
+// hedge applies the Hedge policy to fn.
+func (t *Transport) hedge(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		p := t.Hedge
+		delay, ok := p.start()
+		if !ok {
+			return fn(req)
+		}
+
+		ch := make(chan hedgeResult, 2)
+		var cancels [2]context.CancelFunc
+		call := func(hedged bool) {
+			ctx, cancel := context.WithCancel(req.Context())
+			if hedged {
+				cancels[1] = cancel
+			} else {
+				cancels[0] = cancel
+			}
+			go func() {
+				resp, err := fn(req.WithContext(ctx))
+				ch <- hedgeResult{
+					resp:   resp,
+					err:    err,
+					cancel: cancel,
+					hedged: hedged,
+					end:    time.Now(),
+				}
+			}()
+		}
+		start := time.Now()
+		call(false)
+		inflight := 1
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				if p.allow() {
+					call(true)
+					inflight++
+				}
+			case r := <-ch:
+				inflight--
+				if r.err != nil && inflight > 0 {
+					// wait for the other one.
+					r.cancel()
+					continue
+				}
+				if inflight > 0 {
+					// cancel the loser.
+					if r.hedged {
+						cancels[0]()
+					} else {
+						cancels[1]()
+					}
+					go func() {
+						r := <-ch
+						if r.resp != nil {
+							r.resp.Body.Close()
+						}
+					}()
+				}
+				if r.err != nil {
+					r.cancel()
+					return nil, r.err
+				}
+				// the latency is measured from the start of the original request even if the hedged request wins,
+				// otherwise the delay would be biased toward the latencies of the hedged requests.
+				p.observe(r.end.Sub(start), r.hedged)
+				if r.resp.Body == nil || r.resp.Body == http.NoBody {
+					r.cancel()
+				} else {
+					r.resp.Body = &cancelBody{
+						ReadCloser: r.resp.Body,
+						cancel:     r.cancel,
+					}
+				}
+				return r.resp, nil
+			}
+		}
+	}
+}
+
+// cancelBody cancels the request when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,154 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestHedge(t *testing.T) {
+	var count int32
+	canceled := make(chan struct{})
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				// the first request is stuck.
+				<-ctx.Done()
+				close(canceled)
+				return nil, ctx.Err()
+			}
+			return &s3.GetObjectOutput{
+				ContentLength: aws.Int64(9),
+				Body:          ioutil.NopCloser(bytes.NewReader([]byte("Hello S3!"))),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Hedge = &HedgePolicy{Delay: 10 * time.Millisecond, MaxRatio: 1}
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", got)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("the loser is not canceled")
+	}
+
+	stats := s3.Hedge.Stats()
+	if stats.Requests != 1 || stats.Hedges != 1 || stats.Wins != 1 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+
+	// the latency is measured from the start of the original request, not from the hedged one.
+	s3.Hedge.mu.Lock()
+	samples := s3.Hedge.samples
+	s3.Hedge.mu.Unlock()
+	if len(samples) != 1 || samples[0] < 10*time.Millisecond {
+		t.Errorf("unexpected samples: %v", samples)
+	}
+}
+
+func TestHedge_Fast(t *testing.T) {
+	var count int32
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			atomic.AddInt32(&count, 1)
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Hedge = &HedgePolicy{Delay: time.Hour}
+
+	req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(&count); got != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, got)
+	}
+	if stats := s3.Hedge.Stats(); stats.Hedges != 0 {
+		t.Errorf("unexpected hedges: want %d, got %d", 0, stats.Hedges)
+	}
+}
+
+func TestHedge_MaxRatio(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			time.Sleep(5 * time.Millisecond)
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Hedge = &HedgePolicy{Delay: time.Nanosecond, MaxRatio: 0.25}
+
+	for i := 0; i < 8; i++ {
+		req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	stats := s3.Hedge.Stats()
+	if stats.Hedges != 2 {
+		t.Errorf("unexpected hedges: want %d, got %d", 2, stats.Hedges)
+	}
+	if stats.Throttled != 6 {
+		t.Errorf("unexpected throttled: want %d, got %d", 6, stats.Throttled)
+	}
+}
+
+func TestHedgePolicy_Percentile(t *testing.T) {
+	p := &HedgePolicy{Delay: time.Second, Percentile: 0.9}
+	if d, _ := p.start(); d != time.Second {
+		t.Errorf("want %s before enough samples, got %s", time.Second, d)
+	}
+	for i := 1; i <= 100; i++ {
+		p.observe(time.Duration(i)*time.Millisecond, false)
+	}
+	if d, _ := p.start(); d != 90*time.Millisecond {
+		t.Errorf("want %s, got %s", 90*time.Millisecond, d)
+	}
+
+	// the delay is cached until enough new samples are observed.
+	for i := 0; i < hedgeRecomputeInterval-1; i++ {
+		p.observe(time.Second, false)
+	}
+	if d, _ := p.start(); d != 90*time.Millisecond {
+		t.Errorf("want %s, got %s", 90*time.Millisecond, d)
+	}
+	p.observe(time.Second, false)
+	if d, _ := p.start(); d != time.Second {
+		t.Errorf("want %s, got %s", time.Second, d)
+	}
+}
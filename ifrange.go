@@ -0,0 +1,66 @@
+package s3protocol
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// getObjectIfRange gets the range of the object only if the If-Range validator matches,
+// otherwise it gets the full object.
+// S3 doesn't support If-Range, so the validator is sent as If-Match or If-Unmodified-Since.
+func (t *Transport) getObjectIfRange(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput, ifRange string) (*http.Response, error) {
+	full := *in
+	full.Range = nil
+	partial := *in
+
+	if strings.HasPrefix(ifRange, `"`) {
+		// the entity tag validator.
+		if in.IfMatch != nil {
+			if aws.StringValue(in.IfMatch) != ifRange {
+				// the object can't match both validators.
+				return t.doGetObject(ctx, svc, &full)
+			}
+		}
+		partial.IfMatch = aws.String(ifRange)
+		resp, err := t.doGetObject(ctx, svc, &partial)
+		if err != nil || resp.StatusCode != http.StatusPreconditionFailed {
+			return resp, err
+		}
+		resp.Body.Close()
+		return t.doGetObject(ctx, svc, &full)
+	}
+
+	// the HTTP-date validator.
+	// weak entity tags and invalid dates never match.
+	date, err := http.ParseTime(ifRange)
+	if err != nil {
+		return t.doGetObject(ctx, svc, &full)
+	}
+	if in.IfUnmodifiedSince == nil || date.Before(*in.IfUnmodifiedSince) {
+		partial.IfUnmodifiedSince = aws.Time(date)
+	}
+	resp, err := t.doGetObject(ctx, svc, &partial)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		resp.Body.Close()
+		return t.doGetObject(ctx, svc, &full)
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp, nil
+	}
+
+	// If-Unmodified-Since also passes older objects, but If-Range needs the exact match.
+	lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil || !lastModified.Equal(date) {
+		resp.Body.Close()
+		return t.doGetObject(ctx, svc, &full)
+	}
+	return resp, nil
+}
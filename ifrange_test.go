@@ -0,0 +1,85 @@
+package s3protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRoundTrip_IfRange(t *testing.T) {
+	data := []byte("Hello S3!")
+	lastModified := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	get := getObjectFromBytes(data, `"etag"`)
+	var count int
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+			count++
+			if in.IfUnmodifiedSince != nil && lastModified.After(*in.IfUnmodifiedSince) {
+				aerr := awserr.New("PreconditionFailed", "precondition failed", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusPreconditionFailed, "request-id")
+			}
+			out, err := get(ctx, in, opts...)
+			if err != nil {
+				return nil, err
+			}
+			out.LastModified = aws.Time(lastModified)
+			return out, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	tests := []struct {
+		ifRange string
+		status  int
+		body    string
+		count   int
+	}{
+		// the validator matches
+		{`"etag"`, http.StatusPartialContent, "S3!", 1},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", http.StatusPartialContent, "S3!", 1},
+
+		// the object is modified
+		{`"old-etag"`, http.StatusOK, "Hello S3!", 2},
+		{"Wed, 21 Oct 2015 07:27:00 GMT", http.StatusOK, "Hello S3!", 2},
+
+		// the object is older than the validator
+		{"Wed, 21 Oct 2015 07:29:00 GMT", http.StatusOK, "Hello S3!", 2},
+
+		// weak entity tags never match
+		{`W/"etag"`, http.StatusOK, "Hello S3!", 1},
+	}
+	for _, tt := range tests {
+		count = 0
+		req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=6-8")
+		req.Header.Set("If-Range", tt.ifRange)
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("If-Range %s: unexpected status: want %d, got %d", tt.ifRange, tt.status, resp.StatusCode)
+		}
+		if string(body) != tt.body {
+			t.Errorf("If-Range %s: want %q, got %q", tt.ifRange, tt.body, body)
+		}
+		if count != tt.count {
+			t.Errorf("If-Range %s: unexpected request count: want %d, got %d", tt.ifRange, tt.count, count)
+		}
+	}
+}
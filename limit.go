@@ -0,0 +1,254 @@
+package s3protocol
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueueDelayHeader is the response header that reports how long the request waited for the Limits.
+// The value is formatted by time.Duration.String.
+const QueueDelayHeader = "X-S3protocol-Queue-Delay"
+
+// Limit is a concurrency and rate limit of the requests for a bucket or a prefix.
+// When S3 responds with 503 Slow Down, the limit is halved,
+// and then it grows back additively with successful responses (AIMD).
+type Limit struct {
+	// Bucket is the bucket name that the limit applies to.
+	// If Bucket is empty, the limit applies to all buckets together.
+	Bucket string
+
+	// Prefix is the key prefix that the limit applies to.
+	// If Prefix is empty, the limit applies to the whole bucket.
+	Prefix string
+
+	// MaxConcurrency is the maximum number of the in-flight requests.
+	// A GET request is in flight until its response body is closed.
+	// If MaxConcurrency is zero, the concurrency is not limited.
+	MaxConcurrency int
+
+	// RequestsPerSecond is the rate of the token bucket.
+	// If RequestsPerSecond is zero, the rate is not limited.
+	RequestsPerSecond float64
+
+	// Burst is the size of the token bucket.
+	// If Burst is zero, the integer part of RequestsPerSecond is used (at least 1).
+	Burst int
+}
+
+func (l *Limit) match(bucket, key string) bool {
+	return (l.Bucket == "" || l.Bucket == bucket) && strings.HasPrefix(key, l.Prefix)
+}
+
+type limiter struct {
+	cfg Limit
+
+	mu      sync.Mutex
+	active  int
+	window  float64 // the current concurrency limit
+	rate    float64 // the current rate limit
+	tokens  float64
+	last    time.Time
+	waiters []chan struct{}
+}
+
+func newLimiter(cfg Limit) *limiter {
+	l := &limiter{
+		cfg:    cfg,
+		window: float64(cfg.MaxConcurrency),
+		rate:   cfg.RequestsPerSecond,
+		tokens: float64(burst(cfg)),
+		last:   time.Now(),
+	}
+	return l
+}
+
+func burst(cfg Limit) int {
+	if cfg.Burst > 0 {
+		return cfg.Burst
+	}
+	if cfg.RequestsPerSecond >= 1 {
+		return int(cfg.RequestsPerSecond)
+	}
+	return 1
+}
+
+func (l *limiter) refillLocked(now time.Time) {
+	if l.rate <= 0 {
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if max := float64(burst(l.cfg)); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+}
+
+// acquire waits for a slot of the limiter.
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.refillLocked(now)
+		okConcurrency := l.cfg.MaxConcurrency <= 0 || l.active < int(l.window)
+		okRate := l.cfg.RequestsPerSecond <= 0 || l.tokens >= 1
+		if okConcurrency && okRate {
+			l.active++
+			if l.cfg.RequestsPerSecond > 0 {
+				l.tokens--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+
+		// wait for the next token, or a released slot.
+		d := time.Hour
+		if okConcurrency {
+			d = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		timer := time.NewTimer(d)
+		ch := make(chan struct{})
+		l.waiters = append(l.waiters, ch)
+		l.mu.Unlock()
+
+		select {
+		case <-ch:
+			timer.Stop()
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.mu.Lock()
+			for i, w := range l.waiters {
+				if w == ch {
+					l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+					break
+				}
+			}
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// release releases the slot, and adjusts the limits by the status code of the response.
+// The status code zero means that the request is aborted before getting the response.
+func (l *limiter) release(statusCode int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+
+	l.refillLocked(time.Now())
+	switch {
+	case statusCode == http.StatusServiceUnavailable:
+		// multiplicative decrease
+		if l.cfg.MaxConcurrency > 0 {
+			l.window = math.Max(1, l.window/2)
+		}
+		if l.cfg.RequestsPerSecond > 0 {
+			l.rate = math.Max(math.Min(1, l.cfg.RequestsPerSecond), l.rate/2)
+		}
+	case statusCode >= 200 && statusCode < 500:
+		// additive increase
+		if l.cfg.MaxConcurrency > 0 {
+			l.window = math.Min(float64(l.cfg.MaxConcurrency), l.window+1/l.window)
+		}
+		if l.cfg.RequestsPerSecond > 0 {
+			l.rate = math.Min(l.cfg.RequestsPerSecond, l.rate+1/l.rate)
+		}
+	}
+
+	// wake up the waiters to recheck the slots.
+	for _, w := range l.waiters {
+		close(w)
+	}
+	l.waiters = nil
+}
+
+func (t *Transport) initLimiters() {
+	t.limitersOnce.Do(func() {
+		t.limiters = make([]*limiter, 0, len(t.Limits))
+		for _, cfg := range t.Limits {
+			t.limiters = append(t.limiters, newLimiter(cfg))
+		}
+	})
+}
+
+// limit applies the Limits to fn.
+func (t *Transport) limit(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		t.initLimiters()
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		path := strings.TrimPrefix(req.URL.Path, "/")
+
+		// acquire the slots in the order of Limits to avoid deadlocks.
+		ctx := req.Context()
+		start := time.Now()
+		var acquired []*limiter
+		for _, l := range t.limiters {
+			if !l.cfg.match(host, path) {
+				continue
+			}
+			if err := l.acquire(ctx); err != nil {
+				for _, l := range acquired {
+					l.release(0)
+				}
+				return nil, err
+			}
+			acquired = append(acquired, l)
+		}
+		delay := time.Since(start)
+		release := func(statusCode int) {
+			for _, l := range acquired {
+				l.release(statusCode)
+			}
+		}
+
+		resp, err := fn(req)
+		if err != nil {
+			release(0)
+			return nil, err
+		}
+		if len(acquired) == 0 {
+			return resp, nil
+		}
+		resp.Header.Set(QueueDelayHeader, delay.String())
+		if resp.Body == nil || resp.Body == http.NoBody {
+			release(resp.StatusCode)
+			return resp, nil
+		}
+		resp.Body = &releaseBody{
+			ReadCloser: resp.Body,
+			statusCode: resp.StatusCode,
+			release:    release,
+		}
+		return resp, nil
+	}
+}
+
+// releaseBody releases the slots when the body is read through or closed.
+type releaseBody struct {
+	io.ReadCloser
+	statusCode int
+	release    func(statusCode int)
+	once       sync.Once
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(func() { b.release(b.statusCode) })
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(func() { b.release(b.statusCode) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,143 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestLimit_Concurrency(t *testing.T) {
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body: ioutil.NopCloser(bytes.NewReader([]byte("Hello S3!"))),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Limits = []Limit{{Bucket: "bucket-name", MaxConcurrency: 1}}
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp1, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp1.Header.Get(QueueDelayHeader) == "" {
+		t.Errorf("%s header is missing", QueueDelayHeader)
+	}
+
+	// the second request waits until the first body is closed.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s3.RoundTrip(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("want context.DeadlineExceeded, got %v", err)
+	}
+
+	resp1.Body.Close()
+	resp2, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+}
+
+func TestLimit_Prefix(t *testing.T) {
+	l := Limit{Bucket: "bucket-name", Prefix: "hot/"}
+	if !l.match("bucket-name", "hot/object-key") {
+		t.Error("hot/object-key must match")
+	}
+	if l.match("bucket-name", "cold/object-key") {
+		t.Error("cold/object-key must not match")
+	}
+	l = Limit{Prefix: "hot/"}
+	if !l.match("other-bucket", "hot/object-key") {
+		t.Error("the limit without bucket must match all buckets")
+	}
+}
+
+func TestLimit_Rate(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Limits = []Limit{{RequestsPerSecond: 20, Burst: 1}}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// the first request consumes the burst, and the others wait for 50ms each.
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("requests are not rate limited: %s", d)
+	}
+}
+
+func TestLimit_SlowDown(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			aerr := awserr.New("SlowDown", "Please reduce your request rate.", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusServiceUnavailable, "request-id")
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Limits = []Limit{{MaxConcurrency: 8, RequestsPerSecond: 1000}}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("unexpected status: want %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+		}
+	}
+
+	l := s3.limiters[0]
+	l.mu.Lock()
+	window, rate := l.window, l.rate
+	l.mu.Unlock()
+	if window != 2 {
+		t.Errorf("unexpected window: want %v, got %v", 2, window)
+	}
+	if rate != 250 {
+		t.Errorf("unexpected rate: want %v, got %v", 250, rate)
+	}
+
+	// successful responses grow the window additively.
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.release(http.StatusOK)
+	l.mu.Lock()
+	window = l.window
+	l.mu.Unlock()
+	if window != 2.5 {
+		t.Errorf("unexpected window: want %v, got %v", 2.5, window)
+	}
+}
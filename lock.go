@@ -0,0 +1,198 @@
+package s3protocol
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// retention is the retention settings of the object exchanged in JSON or XML.
+//
+// JSON:
+//
+//	{"Mode": "GOVERNANCE", "RetainUntilDate": "2006-01-02T15:04:05Z"}
+//
+// XML:
+//
+//	<Retention><Mode>GOVERNANCE</Mode><RetainUntilDate>2006-01-02T15:04:05Z</RetainUntilDate></Retention>
+type retention struct {
+	XMLName         xml.Name   `xml:"Retention" json:"-"`
+	Xmlns           string     `xml:"xmlns,attr,omitempty" json:"-"`
+	Mode            string     `xml:"Mode,omitempty" json:"Mode,omitempty"`
+	RetainUntilDate *time.Time `xml:"RetainUntilDate,omitempty" json:"RetainUntilDate,omitempty"`
+}
+
+// legalHold is the legal hold status of the object exchanged in JSON or XML.
+//
+// JSON:
+//
+//	{"Status": "ON"}
+//
+// XML:
+//
+//	<LegalHold><Status>ON</Status></LegalHold>
+type legalHold struct {
+	XMLName xml.Name `xml:"LegalHold" json:"-"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty" json:"-"`
+	Status  string   `xml:"Status" json:"Status"`
+}
+
+func (t *Transport) getObjectRetention(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetObjectRetentionInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	out, err := svc.GetObjectRetentionWithContext(ctx, in)
+	header := makeHeaderFromGetObjectRetentionOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	body := retention{
+		Xmlns: s3Namespace,
+	}
+	if r := out.Retention; r != nil {
+		body.Mode = aws.StringValue(r.Mode)
+		if r.RetainUntilDate != nil {
+			date := r.RetainUntilDate.UTC()
+			body.RetainUntilDate = &date
+		}
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+func (t *Transport) putObjectRetention(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	var body retention
+	if err := decodeRequest(req, &body); err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newPutObjectRetentionInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	in.Retention = &s3.ObjectLockRetention{}
+	if body.Mode != "" {
+		in.Retention.Mode = aws.String(body.Mode)
+	}
+	if body.RetainUntilDate != nil {
+		in.Retention.RetainUntilDate = aws.Time(*body.RetainUntilDate)
+	}
+	out, err := svc.PutObjectRetentionWithContext(ctx, in)
+	header := makeHeaderFromPutObjectRetentionOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
+
+func (t *Transport) getObjectLegalHold(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetObjectLegalHoldInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	out, err := svc.GetObjectLegalHoldWithContext(ctx, in)
+	header := makeHeaderFromGetObjectLegalHoldOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	body := legalHold{
+		Xmlns: s3Namespace,
+	}
+	if out.LegalHold != nil {
+		body.Status = aws.StringValue(out.LegalHold.Status)
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+func (t *Transport) putObjectLegalHold(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	var body legalHold
+	if err := decodeRequest(req, &body); err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newPutObjectLegalHoldInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	in.LegalHold = &s3.ObjectLockLegalHold{
+		Status: aws.String(body.Status),
+	}
+	out, err := svc.PutObjectLegalHoldWithContext(ctx, in)
+	header := makeHeaderFromPutObjectLegalHoldOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
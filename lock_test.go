@@ -0,0 +1,265 @@
+package s3protocol
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type lockedTestObject struct {
+	retention *s3.ObjectLockRetention
+	legalHold *s3.ObjectLockLegalHold
+	bypass    bool
+}
+
+func (obj *lockedTestObject) mock() *s3mock {
+	return &s3mock{
+		getObjectRetentionWithContext: func(ctx context.Context, in *s3.GetObjectRetentionInput, _ ...request.Option) (*s3.GetObjectRetentionOutput, error) {
+			if obj.retention == nil {
+				aerr := awserr.New("NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+			}
+			return &s3.GetObjectRetentionOutput{Retention: obj.retention}, nil
+		},
+		putObjectRetentionWithContext: func(ctx context.Context, in *s3.PutObjectRetentionInput, _ ...request.Option) (*s3.PutObjectRetentionOutput, error) {
+			obj.retention = in.Retention
+			obj.bypass = aws.BoolValue(in.BypassGovernanceRetention)
+			return &s3.PutObjectRetentionOutput{}, nil
+		},
+		getObjectLegalHoldWithContext: func(ctx context.Context, in *s3.GetObjectLegalHoldInput, _ ...request.Option) (*s3.GetObjectLegalHoldOutput, error) {
+			return &s3.GetObjectLegalHoldOutput{LegalHold: obj.legalHold}, nil
+		},
+		putObjectLegalHoldWithContext: func(ctx context.Context, in *s3.PutObjectLegalHoldInput, _ ...request.Option) (*s3.PutObjectLegalHoldOutput, error) {
+			obj.legalHold = in.LegalHold
+			return &s3.PutObjectLegalHoldOutput{}, nil
+		},
+		deleteObjectWithContext: func(ctx context.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+			obj.bypass = aws.BoolValue(in.BypassGovernanceRetention)
+			if obj.retention != nil && !obj.bypass {
+				aerr := awserr.New("AccessDenied", "Access Denied because object protected by object lock.", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+			}
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}
+}
+
+func TestRoundTrip_Retention(t *testing.T) {
+	obj := &lockedTestObject{}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+
+	// no retention
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?retention", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorCodeHeader); got != "NoSuchObjectLockConfiguration" {
+		t.Errorf("unexpected error code: %q", got)
+	}
+
+	// put retention in XML
+	body := `<Retention><Mode>GOVERNANCE</Mode><RetainUntilDate>2030-01-02T15:04:05Z</RetainUntilDate></Retention>`
+	req, err = http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?retention", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Bypass-Governance-Retention", "true")
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	until := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	if aws.StringValue(obj.retention.Mode) != "GOVERNANCE" || !aws.TimeValue(obj.retention.RetainUntilDate).Equal(until) {
+		t.Errorf("unexpected retention: %v", obj.retention)
+	}
+	if !obj.bypass {
+		t.Error("want bypassing governance retention")
+	}
+
+	// get retention in JSON
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?retention", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Mode":"GOVERNANCE","RetainUntilDate":"2030-01-02T15:04:05Z"}`; string(data) != want {
+		t.Errorf("want %s, got %s", want, data)
+	}
+
+	// the locked object can't be deleted
+	req, err = http.NewRequest(http.MethodDelete, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorCodeHeader); got != "ObjectLocked" {
+		t.Errorf("unexpected error code: want %q, got %q", "ObjectLocked", got)
+	}
+
+	// bypass governance retention
+	req, err = http.NewRequest(http.MethodDelete, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Bypass-Governance-Retention", "true")
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+}
+
+func TestRoundTrip_LegalHold(t *testing.T) {
+	obj := &lockedTestObject{}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?legal-hold", strings.NewReader(`{"Status":"ON"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if aws.StringValue(obj.legalHold.Status) != "ON" {
+		t.Errorf("unexpected legal hold: %v", obj.legalHold)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?legal-hold", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<LegalHold xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Status>ON</Status></LegalHold>`
+	if string(data) != want {
+		t.Errorf("want %s, got %s", want, data)
+	}
+}
+
+func TestRoundTrip_PUTWithObjectLock(t *testing.T) {
+	var got *s3.PutObjectInput
+	until := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	mock := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			got = in
+			return &s3.PutObjectOutput{}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ObjectLockMode:            aws.String(s3.ObjectLockModeCompliance),
+				ObjectLockRetainUntilDate: aws.Time(until),
+				ObjectLockLegalHoldStatus: aws.String(s3.ObjectLockLegalHoldStatusOff),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Object-Lock-Mode", "COMPLIANCE")
+	req.Header.Set("X-Amz-Object-Lock-Retain-Until-Date", "2030-01-02T15:04:05Z")
+	req.Header.Set("X-Amz-Object-Lock-Legal-Hold", "ON")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if aws.StringValue(got.ObjectLockMode) != "COMPLIANCE" {
+		t.Errorf("unexpected lock mode: %q", aws.StringValue(got.ObjectLockMode))
+	}
+	if !aws.TimeValue(got.ObjectLockRetainUntilDate).Equal(until) {
+		t.Errorf("unexpected retain until date: %v", got.ObjectLockRetainUntilDate)
+	}
+	if aws.StringValue(got.ObjectLockLegalHoldStatus) != "ON" {
+		t.Errorf("unexpected legal hold: %q", aws.StringValue(got.ObjectLockLegalHoldStatus))
+	}
+
+	req, err = http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Amz-Object-Lock-Retain-Until-Date"); got != "2030-01-02T15:04:05Z" {
+		t.Errorf("unexpected retain until date: want %q, got %q", "2030-01-02T15:04:05Z", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		// the message of S3 for the locked objects.
+		{awserr.New("AccessDenied", "Access Denied because object protected by object lock.", nil), "ObjectLocked"},
+		{awserr.New("AccessDenied", "Object Lock configuration denies the deletion", nil), "ObjectLocked"},
+
+		// other denials are reported as is.
+		{awserr.New("AccessDenied", "Access Denied", nil), "AccessDenied"},
+		{awserr.New("AccessDenied", "The bucket does not allow ACLs", nil), "AccessDenied"},
+		{awserr.New("InvalidRequest", "Bucket is missing Object Lock Configuration", nil), "InvalidRequest"},
+		{awserr.New("NoSuchKey", "The specified key does not exist.", nil), "NoSuchKey"},
+		{errors.New("plain error"), ""},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("%v: want %q, got %q", tt.err, tt.want, got)
+		}
+	}
+}
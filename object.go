@@ -0,0 +1,388 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Object is a random access reader for an S3 object.
+// It implements io.ReadSeekCloser and io.ReaderAt.
+// All reads are pinned to the ETag and the version id of the object at the time of Open,
+// so they fail with 412 Precondition Failed if the object is modified.
+// Read and ReadAt aren't bound to any context; use ReadAtContext to cancel a read.
+type Object struct {
+	svc    s3iface.S3API
+	bucket string
+	key    string
+
+	etag      *string
+	versionID *string
+	size      int64
+	header    http.Header
+
+	cache *BlockCache
+
+	// lastBlock is the index of the last block read via the cache.
+	// it is used for detecting sequential reading.
+	lastBlock int64
+
+	// the state of sequential reading.
+	off  int64
+	body io.ReadCloser
+}
+
+var (
+	_ io.ReadSeekCloser = (*Object)(nil)
+	_ io.ReaderAt       = (*Object)(nil)
+)
+
+// Open opens the object specified by the url for random access reading.
+// The url is in the form of s3://[BUCKET_NAME]/[OBJECT_NAME]?versionId=[VERSION_ID].
+// ctx is used only for opening the object, and not for the reads after that.
+func (t *Transport) Open(ctx context.Context, rawurl string) (*Object, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "s3" {
+		return nil, fmt.Errorf("s3protocol: unsupported protocol scheme %q", req.URL.Scheme)
+	}
+	return t.open(req)
+}
+
+func (t *Transport) open(req *http.Request) (*Object, error) {
+	bucket := req.URL.Host
+	key := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	in := newHeadObjectInput(req)
+	in.Bucket = aws.String(bucket)
+	in.Key = aws.String(key)
+	out, err := svc.HeadObjectWithContext(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.newObject(svc, in, out), nil
+}
+
+// newObject returns the Object of the response of HeadObject.
+func (t *Transport) newObject(svc s3iface.S3API, in *s3.HeadObjectInput, out *s3.HeadObjectOutput) *Object {
+	versionID := out.VersionId
+	if versionID == nil {
+		versionID = in.VersionId
+	}
+	return &Object{
+		svc:       svc,
+		bucket:    aws.StringValue(in.Bucket),
+		key:       aws.StringValue(in.Key),
+		etag:      out.ETag,
+		versionID: versionID,
+		size:      aws.Int64Value(out.ContentLength),
+		header:    makeHeaderFromHeadObjectOutput(out),
+		cache:     t.BlockCache,
+		lastBlock: -1,
+	}
+}
+
+// isBlockCacheable reports whether the ranged GetObject request can be served from BlockCache.
+func isBlockCacheable(in *s3.GetObjectInput) bool {
+	return in.Range != nil && in.PartNumber == nil &&
+		in.SSECustomerKey == nil && in.ChecksumMode == nil &&
+		in.ResponseCacheControl == nil && in.ResponseContentDisposition == nil && in.ResponseContentEncoding == nil &&
+		in.ResponseContentLanguage == nil && in.ResponseContentType == nil && in.ResponseExpires == nil
+}
+
+// getObjectBlocks serves the ranged GetObject request from BlockCache.
+// The object is pinned by HeadObject with the conditions of the request,
+// and the range is assembled from the cached blocks.
+// The first block is loaded before returning, so the errors of the object are reported as the response.
+func (t *Transport) getObjectBlocks(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput) (*http.Response, error) {
+	headIn := &s3.HeadObjectInput{
+		Bucket:              in.Bucket,
+		Key:                 in.Key,
+		VersionId:           in.VersionId,
+		IfMatch:             in.IfMatch,
+		IfNoneMatch:         in.IfNoneMatch,
+		IfModifiedSince:     in.IfModifiedSince,
+		IfUnmodifiedSince:   in.IfUnmodifiedSince,
+		RequestPayer:        in.RequestPayer,
+		ExpectedBucketOwner: in.ExpectedBucketOwner,
+	}
+	head, err := svc.HeadObjectWithContext(ctx, headIn)
+	if err != nil {
+		return handleError(makeHeaderFromHeadObjectOutput(head), err)
+	}
+	size := aws.Int64Value(head.ContentLength)
+	start, end, err := parseByteRange(aws.StringValue(in.Range), size)
+	if err != nil || start == end {
+		// let S3 report the unsatisfiable or malformed range.
+		return t.getObjectUncached(ctx, svc, in)
+	}
+
+	obj := t.newObject(svc, headIn, head)
+	bs := t.BlockCache.blockSize()
+	idx := start / bs
+	data, err := obj.block(ctx, idx)
+	if err != nil {
+		if isArchived(err) {
+			return t.archivedObject(ctx, svc, in, err)
+		}
+		return handleError(nil, err)
+	}
+	first := data[start-idx*bs:]
+	if int64(len(first)) > end-start {
+		first = first[:end-start]
+	}
+	rest := start + int64(len(first))
+	rd := readerAtFunc(func(p []byte, off int64) (int, error) {
+		return obj.ReadAtContext(ctx, p, off)
+	})
+	body := io.MultiReader(bytes.NewReader(first), io.NewSectionReader(rd, rest, end-rest))
+
+	header := obj.header.Clone()
+	header.Set("Content-Length", strconv.FormatInt(end-start, 10))
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	return &http.Response{
+		Status:        "206 Partial Content",
+		StatusCode:    http.StatusPartialContent,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		Header:        header,
+		Body:          ioutil.NopCloser(body),
+		ContentLength: end - start,
+		Close:         true,
+	}, nil
+}
+
+// Size returns the size of the object in bytes.
+func (obj *Object) Size() int64 {
+	return obj.size
+}
+
+// Header returns the response header of HeadObject.
+func (obj *Object) Header() http.Header {
+	return obj.header
+}
+
+// getRange gets the object in the range [start, end).
+// If end is negative, it gets the object until the end.
+func (obj *Object) getRange(ctx context.Context, start, end int64) (io.ReadCloser, error) {
+	in := &s3.GetObjectInput{
+		Bucket:    aws.String(obj.bucket),
+		Key:       aws.String(obj.key),
+		IfMatch:   obj.etag,
+		VersionId: obj.versionID,
+	}
+	if end < 0 {
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-", start))
+	} else {
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-%d", start, end-1))
+	}
+	out, err := obj.svc.GetObjectWithContext(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Read implements io.Reader.
+func (obj *Object) Read(p []byte) (int, error) {
+	if obj.off >= obj.size {
+		return 0, io.EOF
+	}
+	if obj.cache != nil {
+		n, err := obj.readAtCached(context.Background(), p, obj.off)
+		obj.off += int64(n)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
+	}
+	if obj.body == nil {
+		body, err := obj.getRange(context.Background(), obj.off, -1)
+		if err != nil {
+			return 0, err
+		}
+		obj.body = body
+	}
+
+	n, err := obj.body.Read(p)
+	obj.off += int64(n)
+	if err == io.EOF {
+		obj.body.Close()
+		obj.body = nil
+		if obj.off < obj.size {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (obj *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += obj.off
+	case io.SeekEnd:
+		offset += obj.size
+	default:
+		return 0, errors.New("s3protocol: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("s3protocol: negative position")
+	}
+	if offset != obj.off && obj.body != nil {
+		obj.body.Close()
+		obj.body = nil
+	}
+	obj.off = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+// It is safe to call ReadAt in parallel.
+func (obj *Object) ReadAt(p []byte, off int64) (int, error) {
+	return obj.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext is same as ReadAt, but the requests are made with ctx.
+func (obj *Object) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("s3protocol: negative offset")
+	}
+	if off >= obj.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > obj.size {
+		end = obj.size
+	}
+	if end == off {
+		return 0, nil
+	}
+	if obj.cache != nil {
+		return obj.readAtCached(ctx, p, off)
+	}
+
+	body, err := obj.getRange(ctx, off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-off])
+	if err == nil && end == obj.size && int64(len(p)) > end-off {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (obj *Object) readAtCached(ctx context.Context, p []byte, off int64) (int, error) {
+	bs := obj.cache.blockSize()
+	end := off + int64(len(p))
+	if end > obj.size {
+		end = obj.size
+	}
+	obj.readahead(off/bs, (end-1)/bs)
+
+	n := 0
+	for off < end {
+		idx := off / bs
+		data, err := obj.block(ctx, idx)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:end-off+int64(n)], data[off-idx*bs:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the idx-th block of the object.
+func (obj *Object) block(ctx context.Context, idx int64) ([]byte, error) {
+	key := obj.blockKey(idx)
+	return obj.cache.load(ctx, key, func(ctx context.Context) ([]byte, error) {
+		bs := obj.cache.blockSize()
+		start := idx * bs
+		end := start + bs
+		if end > obj.size {
+			end = obj.size
+		}
+		body, err := obj.getRange(ctx, start, end)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		data := make([]byte, end-start)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	})
+}
+
+// readerAtFunc is an adapter to use the function as io.ReaderAt.
+type readerAtFunc func(p []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(p []byte, off int64) (int, error) {
+	return f(p, off)
+}
+
+func (obj *Object) blockKey(idx int64) blockKey {
+	return blockKey{
+		bucket:    obj.bucket,
+		key:       obj.key,
+		versionID: aws.StringValue(obj.versionID),
+		etag:      aws.StringValue(obj.etag),
+		index:     idx,
+	}
+}
+
+// readahead fetches the blocks after last in background, if the reading looks sequential.
+// The fetches aren't bound to the context of the read, because they outlive it.
+func (obj *Object) readahead(first, last int64) {
+	prev := atomic.SwapInt64(&obj.lastBlock, last)
+	if obj.cache.Readahead <= 0 || (first != prev && first != prev+1) {
+		return
+	}
+	bs := obj.cache.blockSize()
+	for i := last + 1; i <= last+int64(obj.cache.Readahead) && i*bs < obj.size; i++ {
+		if obj.cache.contains(obj.blockKey(i)) {
+			continue
+		}
+		go obj.block(context.Background(), i)
+	}
+}
+
+// Close implements io.Closer.
+func (obj *Object) Close() error {
+	if obj.body != nil {
+		err := obj.body.Close()
+		obj.body = nil
+		return err
+	}
+	return nil
+}
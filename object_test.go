@@ -0,0 +1,150 @@
+package s3protocol
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func newObjectMock(data []byte, etag string) *s3mock {
+	return &s3mock{
+		getObjectWithContext: getObjectFromBytes(data, etag),
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ETag:          aws.String(etag),
+				ContentLength: aws.Int64(int64(len(data))),
+			}, nil
+		},
+	}
+}
+
+func TestOpen_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "Hello S3!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := newTestTransport(newObjectMock(buf.Bytes(), `"etag"`), "bucket-name")
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/archive.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	zr, err := zip.NewReader(obj, obj.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 {
+		t.Fatalf("unexpected file count: want %d, got %d", 1, len(zr.File))
+	}
+	r, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", string(got))
+	}
+}
+
+func TestOpen_Seek(t *testing.T) {
+	data := []byte("0123456789")
+	tr := newTestTransport(newObjectMock(data, `"etag"`), "bucket-name")
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	if _, err := obj.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "6789" {
+		t.Errorf("want %q, got %q", "6789", string(got))
+	}
+
+	if _, err := obj.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 3)
+	if _, err := io.ReadFull(obj, p); err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "234" {
+		t.Errorf("want %q, got %q", "234", string(p))
+	}
+
+	// ReadAt doesn't change the offset.
+	p = make([]byte, 5)
+	n, err := obj.ReadAt(p, 7)
+	if err != io.EOF {
+		t.Errorf("want io.EOF, got %v", err)
+	}
+	if string(p[:n]) != "789" {
+		t.Errorf("want %q, got %q", "789", string(p[:n]))
+	}
+	pos, err := obj.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 5 {
+		t.Errorf("unexpected position: want %d, got %d", 5, pos)
+	}
+}
+
+func TestOpen_Modified(t *testing.T) {
+	data := []byte("0123456789")
+	mock := newObjectMock(data, `"etag"`)
+	tr := newTestTransport(mock, "bucket-name")
+	obj, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	mock.getObjectWithContext = getObjectFromBytes(data, `"modified"`)
+	_, err = obj.ReadAt(make([]byte, 1), 0)
+	if rerr, ok := awsRequestFailure(err); !ok || rerr.StatusCode() != http.StatusPreconditionFailed {
+		t.Errorf("want precondition failed, got %v", err)
+	}
+}
+
+func TestOpen_NotFound(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			aerr := awserr.New("NotFound", "not found", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+		},
+	}
+	tr := newTestTransport(mock, "bucket-name")
+	_, err := tr.Open(context.Background(), "s3://bucket-name/object-key")
+	if rerr, ok := awsRequestFailure(err); !ok || rerr.StatusCode() != http.StatusNotFound {
+		t.Errorf("want not found, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package s3protocol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func (t *Transport) partSize() int64 {
+	if t.PartSize > 0 {
+		return t.PartSize
+	}
+	return s3manager.DefaultDownloadPartSize
+}
+
+func (t *Transport) parallelThreshold() int64 {
+	if t.ParallelThreshold > 0 {
+		return t.ParallelThreshold
+	}
+	return t.partSize()
+}
+
+// getObjectParallel gets the first ParallelThreshold bytes of the object,
+// and then gets the rest of the object in parallel if it is larger than ParallelThreshold.
+func (t *Transport) getObjectParallel(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput) (*http.Response, error) {
+	first := *in
+	first.Range = aws.String(fmt.Sprintf("bytes=0-%d", t.parallelThreshold()-1))
+	out, err := svc.GetObjectWithContext(ctx, &first)
+	if rerr, ok := awsRequestFailure(err); ok && rerr.StatusCode() == http.StatusRequestedRangeNotSatisfiable {
+		// the object is empty, so the range is not satisfiable.
+		// fall back to the single request.
+		out, err = svc.GetObjectWithContext(ctx, in)
+	}
+	header := makeHeaderFromGetObjectOutput(out)
+	if err != nil {
+		if isArchived(err) {
+			return t.archivedObject(ctx, svc, in, err)
+		}
+		return handleError(header, err)
+	}
+
+	body := out.Body
+	size := aws.Int64Value(out.ContentLength)
+	if total, ok := contentRangeSize(out.ContentRange); ok {
+		header.Del("Content-Range")
+		if total > size {
+			rest := *in
+			rest.IfMatch = out.ETag
+			rest.IfNoneMatch = nil
+			rest.IfModifiedSince = nil
+			rest.IfUnmodifiedSince = nil
+			body = newParallelReader(ctx, svc, &rest, out.Body, size, total, t.partSize(), t.Concurrency)
+			size = total
+		}
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		Header:        header,
+		Body:          body,
+		ContentLength: size,
+		Close:         true,
+	}, nil
+}
+
+// contentRangeSize returns the complete length of the object from the Content-Range header.
+// e.g. "bytes 0-99/1234" returns 1234.
+func contentRangeSize(contentRange *string) (int64, bool) {
+	if contentRange == nil {
+		return 0, false
+	}
+	idx := strings.LastIndexByte(*contentRange, '/')
+	if idx < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt((*contentRange)[idx+1:], 10, 64)
+	if err != nil {
+		// the complete length is unknown ("*").
+		return 0, false
+	}
+	return size, true
+}
+
+type chunk struct {
+	buf  []byte
+	off  int
+	err  error
+	done chan struct{}
+}
+
+// parallelReader reads the object from concurrent ranged GetObject requests,
+// and returns the data in order.
+type parallelReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	svc    s3iface.S3API
+	in     *s3.GetObjectInput
+
+	// first is the body of the first response.
+	first io.ReadCloser
+
+	// chunks are the downloading chunks in order.
+	chunks chan *chunk
+
+	// pool is the buffer pool.
+	// it limits the number of the buffers to the concurrency.
+	pool chan []byte
+
+	// completed is true if all chunks are dispatched.
+	completed bool
+
+	cur  *chunk
+	err  error
+	once sync.Once
+}
+
+func newParallelReader(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput, first io.ReadCloser, start, total, partSize int64, concurrency int) *parallelReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{
+		ctx:    ctx,
+		cancel: cancel,
+		svc:    svc,
+		in:     in,
+		first:  first,
+		chunks: make(chan *chunk, concurrency),
+		pool:   make(chan []byte, concurrency),
+	}
+	for i := 0; i < concurrency; i++ {
+		r.pool <- nil
+	}
+	go r.dispatch(start, total, partSize)
+	return r
+}
+
+func (r *parallelReader) dispatch(start, total, partSize int64) {
+	defer close(r.chunks)
+	for pos := start; pos < total; pos += partSize {
+		var buf []byte
+		select {
+		case buf = <-r.pool:
+		case <-r.ctx.Done():
+			return
+		}
+
+		end := pos + partSize
+		if end > total {
+			end = total
+		}
+		if int64(cap(buf)) < partSize {
+			buf = make([]byte, partSize)
+		}
+		c := &chunk{
+			buf:  buf[:end-pos],
+			done: make(chan struct{}),
+		}
+		go r.download(c, pos, end)
+
+		select {
+		case r.chunks <- c:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+	r.completed = true
+}
+
+func (r *parallelReader) download(c *chunk, start, end int64) {
+	defer close(c.done)
+
+	in := *r.in
+	in.Range = aws.String(fmt.Sprintf("bytes=%d-%d", start, end-1))
+	out, err := r.svc.GetObjectWithContext(r.ctx, &in)
+	if err != nil {
+		c.err = err
+		return
+	}
+	defer out.Body.Close()
+	_, c.err = io.ReadFull(out.Body, c.buf)
+}
+
+// Read implements io.Reader.
+func (r *parallelReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.first != nil {
+		n, err := r.first.Read(p)
+		if err == io.EOF {
+			r.first.Close()
+			r.first = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			r.err = err
+			return n, err
+		}
+	}
+
+	if r.cur == nil {
+		c, ok := <-r.chunks
+		if !ok {
+			if !r.completed {
+				r.err = r.ctx.Err()
+				return 0, r.err
+			}
+			r.err = io.EOF
+			return 0, io.EOF
+		}
+		<-c.done
+		if c.err != nil {
+			r.err = c.err
+			return 0, c.err
+		}
+		r.cur = c
+	}
+
+	n := copy(p, r.cur.buf[r.cur.off:])
+	r.cur.off += n
+	if r.cur.off >= len(r.cur.buf) {
+		// return the buffer into the pool.
+		r.pool <- r.cur.buf
+		r.cur = nil
+	}
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (r *parallelReader) Close() error {
+	r.once.Do(func() {
+		r.cancel()
+		if r.first != nil {
+			r.first.Close()
+		}
+	})
+	return nil
+}
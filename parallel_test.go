@@ -0,0 +1,199 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// getObjectFromBytes returns a mock of GetObjectWithContext that serves data with the range support.
+func getObjectFromBytes(data []byte, etag string) func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	return func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+		if in.IfMatch != nil && aws.StringValue(in.IfMatch) != etag {
+			aerr := awserr.New("PreconditionFailed", "precondition failed", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusPreconditionFailed, "request-id")
+		}
+		if in.Range == nil {
+			return &s3.GetObjectOutput{
+				ETag:          aws.String(etag),
+				ContentLength: aws.Int64(int64(len(data))),
+				Body:          ioutil.NopCloser(bytes.NewReader(data)),
+			}, nil
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(aws.StringValue(in.Range), "bytes=%d-%d", &start, &end); err != nil {
+			// open-ended range, e.g. "bytes=100-"
+			if _, err := fmt.Sscanf(aws.StringValue(in.Range), "bytes=%d-", &start); err != nil {
+				return nil, err
+			}
+			end = int64(len(data)) - 1
+		}
+		if start >= int64(len(data)) {
+			aerr := awserr.New("InvalidRange", "the requested range is not satisfiable", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusRequestedRangeNotSatisfiable, "request-id")
+		}
+		if end >= int64(len(data)) {
+			end = int64(len(data)) - 1
+		}
+		return &s3.GetObjectOutput{
+			ETag:          aws.String(etag),
+			ContentLength: aws.Int64(end - start + 1),
+			ContentRange:  aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(data))),
+			Body:          ioutil.NopCloser(bytes.NewReader(data[start : end+1])),
+		}, nil
+	}
+}
+
+func TestRoundTrip_Parallel(t *testing.T) {
+	data := make([]byte, 95)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	var count int32
+	get := getObjectFromBytes(data, `"etag"`)
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			atomic.AddInt32(&count, 1)
+			return get(ctx, in)
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Concurrency = 3
+	s3.PartSize = 10
+	s3.ParallelThreshold = 20
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.ContentLength != 95 {
+		t.Errorf("unexpected content length: want %d, got %d", 95, resp.ContentLength)
+	}
+	if resp.Header.Get("Content-Range") != "" {
+		t.Errorf("unexpected Content-Range: %q", resp.Header.Get("Content-Range"))
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("want %v, got %v", data, got)
+	}
+
+	// the first 20 bytes and the rest 75 bytes by 10 bytes.
+	if atomic.LoadInt32(&count) != 9 {
+		t.Errorf("unexpected request count: want %d, got %d", 9, count)
+	}
+}
+
+func TestRoundTrip_ParallelSmallObject(t *testing.T) {
+	data := []byte("Hello S3!")
+	mock := &s3mock{
+		getObjectWithContext: getObjectFromBytes(data, `"etag"`),
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Concurrency = 3
+	s3.PartSize = 10
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("want %q, got %q", data, got)
+	}
+	if resp.ContentLength != int64(len(data)) {
+		t.Errorf("unexpected content length: want %d, got %d", len(data), resp.ContentLength)
+	}
+}
+
+func TestRoundTrip_ParallelEmptyObject(t *testing.T) {
+	mock := &s3mock{
+		getObjectWithContext: getObjectFromBytes([]byte{}, `"etag"`),
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Concurrency = 3
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("want empty, got %q", got)
+	}
+}
+
+func TestRoundTrip_ParallelModified(t *testing.T) {
+	data := make([]byte, 95)
+	get := getObjectFromBytes(data, `"etag"`)
+	modified := getObjectFromBytes(data, `"modified"`)
+	var count int32
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				return get(ctx, in)
+			}
+			// the object is modified while downloading.
+			return modified(ctx, in)
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Concurrency = 3
+	s3.PartSize = 10
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", s3)
+	c := &http.Client{Transport: tr}
+
+	resp, err := c.Get("s3://bucket-name/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	_, err = ioutil.ReadAll(resp.Body)
+	var rerr awserr.RequestFailure
+	if !errors.As(err, &rerr) || rerr.StatusCode() != http.StatusPreconditionFailed {
+		t.Errorf("want precondition failed, got %v", err)
+	}
+}
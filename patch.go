@@ -0,0 +1,187 @@
+package s3protocol
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// mergeMetadata merges the changes into the user metadata.
+// The keys are case-insensitive, and the empty value removes the key.
+func mergeMetadata(metadata, changes map[string]*string) map[string]*string {
+	merged := make(map[string]*string, len(metadata)+len(changes))
+	for k, v := range metadata {
+		merged[strings.ToLower(k)] = v
+	}
+	for k, v := range changes {
+		k = strings.ToLower(k)
+		if aws.StringValue(v) == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// setCopyObjectGrants sets the grants to the x-amz-grant-* headers of the copy.
+// The default ACL, the full control of the owner, is left to S3,
+// so the copy works in the buckets with ACLs disabled.
+func setCopyObjectGrants(in *s3.CopyObjectInput, owner *s3.Owner, grants []*s3.Grant) {
+	ownerID := ""
+	if owner != nil {
+		ownerID = aws.StringValue(owner.ID)
+	}
+	if len(grants) == 0 || (len(grants) == 1 && grants[0].Grantee != nil &&
+		aws.StringValue(grants[0].Grantee.ID) == ownerID && aws.StringValue(grants[0].Permission) == s3.PermissionFullControl) {
+		return
+	}
+
+	values := make(map[string][]string)
+	for _, g := range grants {
+		if g.Grantee == nil {
+			continue
+		}
+		var v string
+		switch aws.StringValue(g.Grantee.Type) {
+		case s3.TypeCanonicalUser:
+			v = fmt.Sprintf("id=%q", aws.StringValue(g.Grantee.ID))
+		case s3.TypeGroup:
+			v = fmt.Sprintf("uri=%q", aws.StringValue(g.Grantee.URI))
+		case s3.TypeAmazonCustomerByEmail:
+			v = fmt.Sprintf("emailAddress=%q", aws.StringValue(g.Grantee.EmailAddress))
+		default:
+			continue
+		}
+		perm := aws.StringValue(g.Permission)
+		values[perm] = append(values[perm], v)
+	}
+	join := func(perm string) *string {
+		return nilIfEmpty(strings.Join(values[perm], ", "))
+	}
+	in.GrantFullControl = join(s3.PermissionFullControl)
+	in.GrantRead = join(s3.PermissionRead)
+	in.GrantReadACP = join(s3.PermissionReadAcp)
+	in.GrantWriteACP = join(s3.PermissionWriteAcp)
+}
+
+// patchObject updates the metadata of the object in place by copying the object to itself.
+// The headers of the request, such as Content-Type and x-amz-meta-*, are merged into the current metadata,
+// and the copy is pinned to the ETag of the object, which can be given by the If-Match header.
+// The content headers, the storage class, the encryption, the ACL and the Object Lock settings are preserved
+// unless the request overrides them.
+// The Object Lock settings are preserved only if HeadObject reports them,
+// which needs the s3:GetObjectRetention and s3:GetObjectLegalHold permissions.
+// It fails if the ACL of the object can't be read, rather than resetting the ACL.
+func (t *Transport) patchObject(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newCopyObjectInput(req)
+	src := objectRef{
+		bucket:    host,
+		key:       path,
+		versionID: req.URL.Query().Get("versionId"),
+	}
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(host),
+		Key:                  aws.String(path),
+		VersionId:            nilIfEmpty(src.versionID),
+		IfMatch:              nilIfEmpty(req.Header.Get("If-Match")),
+		SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		SSECustomerKey:       in.SSECustomerKey,
+		SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		RequestPayer:         in.RequestPayer,
+		ExpectedBucketOwner:  in.ExpectedBucketOwner,
+	})
+	if err != nil {
+		return handleError(nil, err)
+	}
+	src.versionID = aws.StringValue(head.VersionId)
+
+	in.Bucket = &host
+	in.Key = &path
+	in.CopySource = aws.String(src.String())
+	in.CopySourceIfMatch = head.ETag
+	in.CopySourceSSECustomerAlgorithm = in.SSECustomerAlgorithm
+	in.CopySourceSSECustomerKey = in.SSECustomerKey
+	in.CopySourceSSECustomerKeyMD5 = in.SSECustomerKeyMD5
+	in.ExpectedSourceBucketOwner = in.ExpectedBucketOwner
+	in.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	in.Metadata = mergeMetadata(head.Metadata, in.Metadata)
+	if in.CacheControl == nil {
+		in.CacheControl = head.CacheControl
+	}
+	if in.ContentDisposition == nil {
+		in.ContentDisposition = head.ContentDisposition
+	}
+	if in.ContentEncoding == nil {
+		in.ContentEncoding = head.ContentEncoding
+	}
+	if in.ContentLanguage == nil {
+		in.ContentLanguage = head.ContentLanguage
+	}
+	if in.ContentType == nil {
+		in.ContentType = head.ContentType
+	}
+	if in.Expires == nil {
+		in.Expires = parseExpires(head.Expires)
+	}
+	if in.StorageClass == nil {
+		in.StorageClass = head.StorageClass
+	}
+	if in.WebsiteRedirectLocation == nil {
+		in.WebsiteRedirectLocation = head.WebsiteRedirectLocation
+	}
+	if in.ObjectLockMode == nil && in.ObjectLockRetainUntilDate == nil {
+		in.ObjectLockMode = head.ObjectLockMode
+		in.ObjectLockRetainUntilDate = head.ObjectLockRetainUntilDate
+	}
+	if in.ObjectLockLegalHoldStatus == nil {
+		in.ObjectLockLegalHoldStatus = head.ObjectLockLegalHoldStatus
+	}
+	if in.ACL == nil && in.GrantFullControl == nil && in.GrantRead == nil && in.GrantReadACP == nil && in.GrantWriteACP == nil {
+		// keep the ACL, otherwise the copy is private.
+		acl, err := svc.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{
+			Bucket:              aws.String(host),
+			Key:                 aws.String(path),
+			VersionId:           nilIfEmpty(src.versionID),
+			RequestPayer:        in.RequestPayer,
+			ExpectedBucketOwner: in.ExpectedBucketOwner,
+		})
+		if err != nil && errorCode(err) != "NotImplemented" {
+			// some providers don't support ACLs, and the objects have no ACLs to keep in that case.
+			return handleError(nil, err)
+		}
+		if acl != nil {
+			setCopyObjectGrants(in, acl.Owner, acl.Grants)
+		}
+	}
+	if in.ServerSideEncryption == nil && in.SSECustomerAlgorithm == nil {
+		// keep the encryption, otherwise the default encryption of the bucket is applied.
+		in.ServerSideEncryption = head.ServerSideEncryption
+		in.SSEKMSKeyId = head.SSEKMSKeyId
+		in.BucketKeyEnabled = head.BucketKeyEnabled
+	}
+
+	header, result, err := t.doCopyObject(ctx, svc, svc, in, src, head)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	header.Set("ETag", result.ETag)
+	return encodeResponse(req, http.StatusOK, header, result)
+}
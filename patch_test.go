@@ -0,0 +1,258 @@
+package s3protocol
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRoundTrip_PatchObject(t *testing.T) {
+	var head *s3.HeadObjectInput
+	var copied *s3.CopyObjectInput
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			head = in
+			return &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(9),
+				ETag:          aws.String(`"0123456789abcdef"`),
+				VersionId:     aws.String("v1"),
+				ContentType:   aws.String("text/plain"),
+				CacheControl:  aws.String("no-cache"),
+				Metadata: map[string]*string{
+					"Foo": aws.String("foo"),
+					"Bar": aws.String("bar"),
+				},
+				ServerSideEncryption:      aws.String(s3.ServerSideEncryptionAwsKms),
+				SSEKMSKeyId:               aws.String("key-id"),
+				ObjectLockMode:            aws.String(s3.ObjectLockModeGovernance),
+				ObjectLockRetainUntilDate: aws.Time(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)),
+				ObjectLockLegalHoldStatus: aws.String(s3.ObjectLockLegalHoldStatusOn),
+			}, nil
+		},
+		getObjectAclWithContext: func(ctx context.Context, in *s3.GetObjectAclInput, _ ...request.Option) (*s3.GetObjectAclOutput, error) {
+			if aws.StringValue(in.VersionId) != "v1" {
+				t.Errorf("unexpected version id: %q", aws.StringValue(in.VersionId))
+			}
+			return &s3.GetObjectAclOutput{
+				Owner: &s3.Owner{ID: aws.String("owner-id")},
+				Grants: []*s3.Grant{
+					{
+						Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("owner-id")},
+						Permission: aws.String(s3.PermissionFullControl),
+					},
+					{
+						Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+						Permission: aws.String(s3.PermissionRead),
+					},
+				},
+			}, nil
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			copied = in
+			return &s3.CopyObjectOutput{
+				CopyObjectResult: &s3.CopyObjectResult{ETag: aws.String(`"fedcba9876543210"`)},
+				VersionId:        aws.String("v2"),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPatch, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Match", `"0123456789abcdef"`)
+	req.Header.Set("Content-Type", "text/html")
+	req.Header.Set("X-Amz-Storage-Class", "STANDARD_IA")
+	req.Header.Set("X-Amz-Meta-Foo", "updated")
+	req.Header.Set("X-Amz-Meta-Bar", "")
+	req.Header.Set("X-Amz-Meta-Baz", "baz")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got := resp.Header.Get("ETag"); got != `"fedcba9876543210"` {
+		t.Errorf("unexpected ETag: want %q, got %q", `"fedcba9876543210"`, got)
+	}
+	if got := resp.Header.Get("X-Amz-Version-Id"); got != "v2" {
+		t.Errorf("unexpected x-amz-version-id: want %q, got %q", "v2", got)
+	}
+
+	if aws.StringValue(head.IfMatch) != `"0123456789abcdef"` {
+		t.Errorf("unexpected If-Match: %q", aws.StringValue(head.IfMatch))
+	}
+	if aws.StringValue(copied.CopySource) != "bucket-name/object-key?versionId=v1" || aws.StringValue(copied.CopySourceIfMatch) != `"0123456789abcdef"` {
+		t.Errorf("unexpected copy source: %q, %q", aws.StringValue(copied.CopySource), aws.StringValue(copied.CopySourceIfMatch))
+	}
+	if aws.StringValue(copied.MetadataDirective) != "REPLACE" {
+		t.Errorf("unexpected metadata directive: %q", aws.StringValue(copied.MetadataDirective))
+	}
+	if aws.StringValue(copied.ContentType) != "text/html" || aws.StringValue(copied.CacheControl) != "no-cache" {
+		t.Errorf("unexpected content headers: %q, %q", aws.StringValue(copied.ContentType), aws.StringValue(copied.CacheControl))
+	}
+	if aws.StringValue(copied.StorageClass) != "STANDARD_IA" {
+		t.Errorf("unexpected storage class: %q", aws.StringValue(copied.StorageClass))
+	}
+	want := map[string]string{"foo": "updated", "baz": "baz"}
+	if got := aws.StringValueMap(copied.Metadata); len(got) != len(want) || got["foo"] != want["foo"] || got["baz"] != want["baz"] {
+		t.Errorf("unexpected metadata: want %v, got %v", want, got)
+	}
+	if aws.StringValue(copied.ServerSideEncryption) != "aws:kms" || aws.StringValue(copied.SSEKMSKeyId) != "key-id" {
+		t.Errorf("unexpected encryption: %q, %q", aws.StringValue(copied.ServerSideEncryption), aws.StringValue(copied.SSEKMSKeyId))
+	}
+
+	// the ACL and the Object Lock settings are kept.
+	if aws.StringValue(copied.GrantFullControl) != `id="owner-id"` || aws.StringValue(copied.GrantRead) != `uri="http://acs.amazonaws.com/groups/global/AllUsers"` {
+		t.Errorf("unexpected grants: %q, %q", aws.StringValue(copied.GrantFullControl), aws.StringValue(copied.GrantRead))
+	}
+	if aws.StringValue(copied.ObjectLockMode) != "GOVERNANCE" || copied.ObjectLockRetainUntilDate == nil || aws.StringValue(copied.ObjectLockLegalHoldStatus) != "ON" {
+		t.Errorf("unexpected object lock: %q, %v, %q",
+			aws.StringValue(copied.ObjectLockMode), copied.ObjectLockRetainUntilDate, aws.StringValue(copied.ObjectLockLegalHoldStatus))
+	}
+}
+
+func TestRoundTrip_PatchObjectAclDenied(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(9), ETag: aws.String(`"0123456789abcdef"`)}, nil
+		},
+		getObjectAclWithContext: func(ctx context.Context, in *s3.GetObjectAclInput, _ ...request.Option) (*s3.GetObjectAclOutput, error) {
+			aerr := awserr.New("AccessDenied", "Access Denied", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			t.Error("CopyObject must not be called")
+			return &s3.CopyObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	// the ACL is not reset if it can't be read.
+	req, err := http.NewRequest(http.MethodPatch, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/html")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestRoundTrip_PatchObjectMultipart(t *testing.T) {
+	var create *s3.CreateMultipartUploadInput
+	var parts int
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(30),
+				ETag:          aws.String(`"0123456789abcdef-2"`),
+				ContentType:   aws.String("text/plain"),
+				Metadata:      map[string]*string{"Foo": aws.String("foo")},
+			}, nil
+		},
+		getObjectTaggingWithContext: func(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{}, nil
+		},
+		getObjectAclWithContext: func(ctx context.Context, in *s3.GetObjectAclInput, _ ...request.Option) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Owner: &s3.Owner{ID: aws.String("owner-id")},
+				Grants: []*s3.Grant{{
+					Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("owner-id")},
+					Permission: aws.String(s3.PermissionFullControl),
+				}},
+			}, nil
+		},
+		createMultipartUploadWithContext: func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+			create = in
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+		},
+		uploadPartCopyWithContext: func(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error) {
+			if aws.StringValue(in.CopySourceIfMatch) != `"0123456789abcdef-2"` {
+				t.Errorf("unexpected x-amz-copy-source-if-match: %q", aws.StringValue(in.CopySourceIfMatch))
+			}
+			return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"part"`)}}, nil
+		},
+		completeMultipartUploadWithContext: func(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+			parts = len(in.MultipartUpload.Parts)
+			return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"new-etag-3"`), VersionId: aws.String("v2")}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.MultipartCopyThreshold = 20
+	s3.MultipartCopyPartSize = 10
+
+	req, err := http.NewRequest(http.MethodPatch, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Cache-Control", "max-age=3600")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got := resp.Header.Get("ETag"); got != `"new-etag-3"` {
+		t.Errorf("unexpected ETag: want %q, got %q", `"new-etag-3"`, got)
+	}
+	if got := resp.Header.Get("X-Amz-Version-Id"); got != "v2" {
+		t.Errorf("unexpected x-amz-version-id: want %q, got %q", "v2", got)
+	}
+	if aws.StringValue(create.CacheControl) != "max-age=3600" || aws.StringValue(create.ContentType) != "text/plain" || aws.StringValue(create.Metadata["foo"]) != "foo" {
+		t.Errorf("unexpected input: %v", create)
+	}
+	if parts != 3 {
+		t.Errorf("unexpected parts: want %d, got %d", 3, parts)
+	}
+
+	// the default ACL is left to S3, so the copy works in the buckets with ACLs disabled.
+	if create.GrantFullControl != nil || create.GrantRead != nil {
+		t.Errorf("unexpected grants: %q, %q", aws.StringValue(create.GrantFullControl), aws.StringValue(create.GrantRead))
+	}
+}
+
+func TestRoundTrip_PatchObjectPreconditionFailed(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			aerr := awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusPreconditionFailed, "request-id")
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			t.Error("CopyObject must not be called")
+			return &s3.CopyObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPatch, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Match", `"outdated"`)
+	req.Header.Set("Content-Type", "text/html")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusPreconditionFailed, resp.StatusCode)
+	}
+}
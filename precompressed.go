@@ -0,0 +1,197 @@
+package s3protocol
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPrecompressedTTL = time.Minute
+
+	// the maximum number of the missing siblings remembered.
+	precompressedMaxEntries = 10000
+)
+
+// precompressedEncoding is a content coding of the precompressed sibling objects.
+type precompressedEncoding struct {
+	encoding string
+	suffix   string
+}
+
+// the content codings of the precompressed sibling objects, in the order of preference.
+var precompressedEncodings = []precompressedEncoding{
+	{encoding: "br", suffix: ".br"},
+	{encoding: "gzip", suffix: ".gz"},
+}
+
+// missingCache remembers the sibling objects that don't exist.
+type missingCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // the expiry of the entries
+}
+
+func (c *missingCache) contains(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if now.After(expires) {
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+func (c *missingCache) add(key string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]time.Time)
+	}
+	if len(c.entries) >= precompressedMaxEntries {
+		now := time.Now()
+		for k, v := range c.entries {
+			if now.After(v) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= precompressedMaxEntries {
+			c.entries = make(map[string]time.Time)
+		}
+	}
+	c.entries[key] = expires
+}
+
+func (c *missingCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (t *Transport) precompressedTTL() time.Duration {
+	if t.PrecompressedTTL > 0 {
+		return t.PrecompressedTTL
+	}
+	return defaultPrecompressedTTL
+}
+
+// acceptedEncodings returns the precompressed encodings accepted by the Accept-Encoding header,
+// in the order of preference.
+func acceptedEncodings(acceptEncoding string) []precompressedEncoding {
+	qvalues := make(map[string]float64)
+	for _, v := range strings.Split(acceptEncoding, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		q := 1.0
+		if idx := strings.IndexByte(v, ';'); idx >= 0 {
+			param := strings.TrimSpace(v[idx+1:])
+			v = strings.TrimSpace(v[:idx])
+			if strings.HasPrefix(param, "q=") {
+				f, err := strconv.ParseFloat(param[len("q="):], 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		qvalues[strings.ToLower(v)] = q
+	}
+
+	var ret []precompressedEncoding
+	for _, enc := range precompressedEncodings {
+		q, ok := qvalues[enc.encoding]
+		if !ok {
+			q, ok = qvalues["*"]
+		}
+		if ok && q > 0 {
+			ret = append(ret, enc)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		qi, ok := qvalues[ret[i].encoding]
+		if !ok {
+			qi = qvalues["*"]
+		}
+		qj, ok := qvalues[ret[j].encoding]
+		if !ok {
+			qj = qvalues["*"]
+		}
+		return qi > qj
+	})
+	return ret
+}
+
+// precompressed applies Precompressed to fn.
+func (t *Transport) precompressed(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Range") != "" {
+			return fn(req)
+		}
+		query := req.URL.Query()
+		if _, ok := query["versionId"]; ok {
+			// the version id belongs to the plain object, not to the siblings.
+			return fn(req)
+		}
+		if _, ok := query["partNumber"]; ok {
+			return fn(req)
+		}
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		key := strings.TrimPrefix(req.URL.Path, "/")
+		for _, enc := range precompressedEncodings {
+			if strings.HasSuffix(key, enc.suffix) {
+				// the request is already for a precompressed object.
+				return fn(req)
+			}
+		}
+
+		now := time.Now()
+		for _, enc := range acceptedEncodings(req.Header.Get("Accept-Encoding")) {
+			cacheKey := host + "/" + key + enc.suffix
+			if t.missing.contains(cacheKey, now) {
+				continue
+			}
+
+			sibling := req.Clone(req.Context())
+			sibling.URL.Path = req.URL.Path + enc.suffix
+			sibling.URL.RawPath = ""
+			resp, err := fn(sibling)
+			if err != nil {
+				return nil, err
+			}
+			switch resp.StatusCode {
+			case http.StatusOK, http.StatusNotModified, http.StatusPreconditionFailed:
+				resp.Header.Set("Content-Encoding", enc.encoding)
+				if typ := mime.TypeByExtension(path.Ext(key)); typ != "" {
+					resp.Header.Set("Content-Type", typ)
+				}
+				resp.Header.Add("Vary", "Accept-Encoding")
+				resp.Request = req
+				return resp, nil
+			case http.StatusNotFound, http.StatusForbidden:
+				// S3 returns 403 Forbidden for missing objects without the s3:ListBucket permission.
+				t.missing.add(cacheKey, now.Add(t.precompressedTTL()))
+			}
+			resp.Body.Close()
+		}
+
+		resp, err := fn(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Header.Add("Vary", "Accept-Encoding")
+		return resp, nil
+	}
+}
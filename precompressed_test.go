@@ -0,0 +1,166 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func newPrecompressedTestTransport(objects map[string]string, keys *[]string) *Transport {
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			*keys = append(*keys, aws.StringValue(in.Key))
+			data, ok := objects[aws.StringValue(in.Key)]
+			if !ok {
+				aerr := awserr.New("NoSuchKey", "The specified key does not exist.", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+			}
+			return &s3.GetObjectOutput{
+				ContentType: aws.String("binary/octet-stream"),
+				Body:        ioutil.NopCloser(bytes.NewReader([]byte(data))),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Precompressed = true
+	return s3
+}
+
+func getWithAcceptEncoding(t *testing.T, s3 *Transport, url, acceptEncoding string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+func TestPrecompressed(t *testing.T) {
+	var keys []string
+	s3 := newPrecompressedTestTransport(map[string]string{
+		"app.js":    "plain",
+		"app.js.gz": "gzip",
+		"app.js.br": "br",
+	}, &keys)
+
+	resp, body := getWithAcceptEncoding(t, s3, "s3://bucket-name/app.js", "gzip, deflate, br")
+	if body != "br" {
+		t.Errorf("want %q, got %q", "br", body)
+	}
+	if got := resp.Header.Get("Content-Encoding"); got != "br" {
+		t.Errorf("unexpected Content-Encoding: want %q, got %q", "br", got)
+	}
+	if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("unexpected Vary: want %q, got %q", "Accept-Encoding", got)
+	}
+	if got, want := resp.Header.Get("Content-Type"), mime.TypeByExtension(".js"); got != want {
+		t.Errorf("unexpected Content-Type: want %q, got %q", want, got)
+	}
+
+	_, body = getWithAcceptEncoding(t, s3, "s3://bucket-name/app.js", "gzip;q=1.0, br;q=0.5")
+	if body != "gzip" {
+		t.Errorf("want %q, got %q", "gzip", body)
+	}
+
+	resp, body = getWithAcceptEncoding(t, s3, "s3://bucket-name/app.js", "identity")
+	if body != "plain" {
+		t.Errorf("want %q, got %q", "plain", body)
+	}
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("unexpected Content-Encoding: %q", got)
+	}
+	if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("unexpected Vary: want %q, got %q", "Accept-Encoding", got)
+	}
+}
+
+func TestPrecompressed_Missing(t *testing.T) {
+	var keys []string
+	s3 := newPrecompressedTestTransport(map[string]string{
+		"app.js": "plain",
+	}, &keys)
+
+	for i := 0; i < 2; i++ {
+		_, body := getWithAcceptEncoding(t, s3, "s3://bucket-name/app.js", "gzip, br")
+		if body != "plain" {
+			t.Errorf("want %q, got %q", "plain", body)
+		}
+	}
+
+	// the missing siblings are checked only once.
+	want := []string{"app.js.br", "app.js.gz", "app.js", "app.js"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpected requests: want %q, got %q", want, keys)
+	}
+}
+
+func TestPrecompressed_Version(t *testing.T) {
+	var keys []string
+	s3 := newPrecompressedTestTransport(map[string]string{
+		"app.js":    "plain",
+		"app.js.gz": "gzip",
+	}, &keys)
+
+	// the version id of the plain object is not used for the siblings.
+	for _, url := range []string{"s3://bucket-name/app.js?versionId=v1", "s3://bucket-name/app.js?partNumber=1"} {
+		resp, body := getWithAcceptEncoding(t, s3, url, "gzip")
+		if body != "plain" {
+			t.Errorf("want %q, got %q", "plain", body)
+		}
+		if got := resp.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("unexpected Content-Encoding: %q", got)
+		}
+	}
+
+	// the sibling is not remembered as missing.
+	_, body := getWithAcceptEncoding(t, s3, "s3://bucket-name/app.js", "gzip")
+	if body != "gzip" {
+		t.Errorf("want %q, got %q", "gzip", body)
+	}
+	want := []string{"app.js", "app.js", "app.js.gz"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpected requests: want %q, got %q", want, keys)
+	}
+}
+
+func TestAcceptedEncodings(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"gzip", []string{"gzip"}},
+		{"gzip, br", []string{"br", "gzip"}},
+		{"br;q=0.1, gzip", []string{"gzip", "br"}},
+		{"*", []string{"br", "gzip"}},
+		{"*, br;q=0", []string{"gzip"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, enc := range acceptedEncodings(tt.in) {
+			got = append(got, enc.encoding)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("acceptedEncodings(%q): want %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package s3protocol
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// RestorePolicy is the policy for restoring archived objects on read.
+type RestorePolicy struct {
+	// Days is the lifetime of the restored copy in days.
+	// It is ignored for the objects in the archive access tiers of S3 Intelligent-Tiering.
+	// If Days is zero, 1 is used.
+	Days int64
+
+	// Tier is the retrieval tier: Expedited, Standard or Bulk.
+	// If Tier is empty, Standard is used.
+	Tier string
+}
+
+func (p *RestorePolicy) days() int64 {
+	if p.Days > 0 {
+		return p.Days
+	}
+	return 1
+}
+
+func (p *RestorePolicy) tier() string {
+	if p.Tier != "" {
+		return p.Tier
+	}
+	return s3.TierStandard
+}
+
+// isArchived reports whether the error is caused by reading an archived object.
+func isArchived(err error) bool {
+	for err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+		if aerr.Code() == "InvalidObjectState" {
+			return true
+		}
+		err = aerr.OrigErr()
+	}
+	return false
+}
+
+// restoreEstimate returns the estimated time to restore the object from the storage class with the tier.
+func restoreEstimate(storageClass, tier string) time.Duration {
+	switch storageClass {
+	case s3.StorageClassDeepArchive, s3.ArchiveStatusDeepArchiveAccess:
+		if tier == s3.TierBulk {
+			return 48 * time.Hour
+		}
+		return 12 * time.Hour
+	default:
+		switch tier {
+		case s3.TierExpedited:
+			return 5 * time.Minute
+		case s3.TierBulk:
+			return 12 * time.Hour
+		}
+		return 5 * time.Hour
+	}
+}
+
+// archivedObject makes the response for the GET request of the archived object.
+// It responds 409 Conflict with the RestoreInProgress error code and Retry-After if the object is being restored,
+// otherwise 409 Conflict with the InvalidObjectState error code.
+// The status is not 5xx, so the retries and the limits don't treat it as a failure of S3.
+func (t *Transport) archivedObject(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput, err error) (*http.Response, error) {
+	head, herr := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               in.Bucket,
+		Key:                  in.Key,
+		VersionId:            in.VersionId,
+		SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		SSECustomerKey:       in.SSECustomerKey,
+		SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		RequestPayer:         in.RequestPayer,
+		ExpectedBucketOwner:  in.ExpectedBucketOwner,
+	})
+	if herr != nil {
+		return handleError(nil, err)
+	}
+
+	header := make(http.Header)
+	storageClass := aws.StringValue(head.StorageClass)
+	if storageClass != "" {
+		header.Set("X-Amz-Storage-Class", storageClass)
+	}
+	if head.ArchiveStatus != nil {
+		header.Set("X-Amz-Archive-Status", aws.StringValue(head.ArchiveStatus))
+		storageClass = aws.StringValue(head.ArchiveStatus)
+	}
+	if head.Restore != nil {
+		header.Set("X-Amz-Restore", aws.StringValue(head.Restore))
+	}
+
+	restoring := strings.Contains(aws.StringValue(head.Restore), `ongoing-request="true"`)
+	var tier string
+	if !restoring && t.AutoRestore != nil {
+		tier = t.AutoRestore.tier()
+		rr := &s3.RestoreRequest{
+			GlacierJobParameters: &s3.GlacierJobParameters{
+				Tier: aws.String(tier),
+			},
+		}
+		if head.ArchiveStatus == nil {
+			rr.Days = aws.Int64(t.AutoRestore.days())
+		}
+		_, err := svc.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+			Bucket:              in.Bucket,
+			Key:                 in.Key,
+			VersionId:           in.VersionId,
+			RequestPayer:        in.RequestPayer,
+			ExpectedBucketOwner: in.ExpectedBucketOwner,
+			RestoreRequest:      rr,
+		})
+		if aerr, ok := err.(awserr.Error); err == nil || (ok && aerr.Code() == "RestoreAlreadyInProgress") {
+			restoring = true
+			header.Set("X-Amz-Restore", `ongoing-request="true"`)
+			t.invalidate(aws.StringValue(in.Bucket), aws.StringValue(in.Key))
+		}
+	}
+
+	if restoring {
+		d := restoreEstimate(storageClass, tier)
+		header.Set("Retry-After", strconv.FormatInt(int64(d/time.Second), 10))
+		header.Set(ErrorCodeHeader, "RestoreInProgress")
+		return textResponse(http.StatusConflict, header,
+			fmt.Sprintf("The object is archived in %s and is being restored.\n", storageClass)), nil
+	}
+	header.Set(ErrorCodeHeader, "InvalidObjectState")
+	return textResponse(http.StatusConflict, header,
+		fmt.Sprintf("The object is archived in %s. Restore it with POST ?restore before reading.\n", storageClass)), nil
+}
+
+// restoreRequest is the XML body of POST ?restore.
+type restoreRequest struct {
+	XMLName xml.Name `xml:"RestoreRequest"`
+	Days    int64    `xml:"Days"`
+	Tier    string   `xml:"GlacierJobParameters>Tier"`
+}
+
+// parseRestoreRequest parses the restore request from the "days" and "tier" query parameters, or the XML body.
+func parseRestoreRequest(req *http.Request) (*s3.RestoreRequest, error) {
+	var rr restoreRequest
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := ioutil.ReadAll(io.LimitReader(req.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(string(data))) > 0 {
+			if err := xml.Unmarshal(data, &rr); err != nil {
+				return nil, fmt.Errorf("invalid restore request: %w", err)
+			}
+		}
+	}
+
+	query := req.URL.Query()
+	if v := query.Get("days"); v != "" {
+		days, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid days: %q", v)
+		}
+		rr.Days = days
+	}
+	if v := query.Get("tier"); v != "" {
+		rr.Tier = v
+	}
+
+	ret := &s3.RestoreRequest{}
+	if rr.Days > 0 {
+		ret.Days = aws.Int64(rr.Days)
+	}
+	if rr.Tier != "" {
+		ret.GlacierJobParameters = &s3.GlacierJobParameters{
+			Tier: aws.String(rr.Tier),
+		}
+	}
+	return ret, nil
+}
+
+func (t *Transport) restoreObject(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	rr, err := parseRestoreRequest(req)
+	if err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newRestoreObjectInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	in.RestoreRequest = rr
+
+	// S3 responds 202 Accepted for a new restore, and 200 OK for extending the restored copy.
+	code := http.StatusAccepted
+	out, err := svc.RestoreObjectWithContext(ctx, in, func(r *request.Request) {
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.HTTPResponse != nil && r.HTTPResponse.StatusCode/100 == 2 {
+				code = r.HTTPResponse.StatusCode
+			}
+		})
+	})
+	header := makeHeaderFromRestoreObjectOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
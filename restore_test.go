@@ -0,0 +1,204 @@
+package s3protocol
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type archivedTestObject struct {
+	restore  *string
+	restores []*s3.RestoreObjectInput
+}
+
+func (obj *archivedTestObject) mock() *s3mock {
+	return &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			aerr := awserr.New("InvalidObjectState", "The operation is not valid for the object's storage class", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				StorageClass: aws.String(s3.StorageClassGlacier),
+				Restore:      obj.restore,
+			}, nil
+		},
+		restoreObjectWithContext: func(ctx context.Context, in *s3.RestoreObjectInput, _ ...request.Option) (*s3.RestoreObjectOutput, error) {
+			obj.restores = append(obj.restores, in)
+			obj.restore = aws.String(`ongoing-request="true"`)
+			return &s3.RestoreObjectOutput{}, nil
+		},
+	}
+}
+
+func TestRoundTrip_Archived(t *testing.T) {
+	obj := &archivedTestObject{}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Amz-Storage-Class"); got != "GLACIER" {
+		t.Errorf("unexpected storage class: want %q, got %q", "GLACIER", got)
+	}
+	if len(obj.restores) != 0 {
+		t.Error("the restore must not be started")
+	}
+
+	// restore the object
+	req, err = http.NewRequest(http.MethodPost, "s3://bucket-name/object-key?restore&days=3&tier=Bulk", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+	if len(obj.restores) != 1 {
+		t.Fatalf("unexpected restores: want %d, got %d", 1, len(obj.restores))
+	}
+	rr := obj.restores[0].RestoreRequest
+	if aws.Int64Value(rr.Days) != 3 || aws.StringValue(rr.GlacierJobParameters.Tier) != "Bulk" {
+		t.Errorf("unexpected restore request: %v", rr)
+	}
+
+	// the object is being restored
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorCodeHeader); got != "RestoreInProgress" {
+		t.Errorf("unexpected error code: want %q, got %q", "RestoreInProgress", got)
+	}
+	if got := resp.Header.Get("X-Amz-Restore"); got != `ongoing-request="true"` {
+		t.Errorf("unexpected x-amz-restore: %q", got)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "18000" {
+		t.Errorf("unexpected Retry-After: want %q, got %q", "18000", got)
+	}
+}
+
+func TestRoundTrip_AutoRestore(t *testing.T) {
+	obj := &archivedTestObject{}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+	s3.AutoRestore = &RestorePolicy{Tier: "Expedited"}
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorCodeHeader); got != "RestoreInProgress" {
+		t.Errorf("unexpected error code: want %q, got %q", "RestoreInProgress", got)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "300" {
+		t.Errorf("unexpected Retry-After: want %q, got %q", "300", got)
+	}
+	if len(obj.restores) != 1 {
+		t.Fatalf("unexpected restores: want %d, got %d", 1, len(obj.restores))
+	}
+	rr := obj.restores[0].RestoreRequest
+	if aws.Int64Value(rr.Days) != 1 || aws.StringValue(rr.GlacierJobParameters.Tier) != "Expedited" {
+		t.Errorf("unexpected restore request: %v", rr)
+	}
+}
+
+func TestParseRestoreRequest(t *testing.T) {
+	body := `<RestoreRequest><Days>2</Days><GlacierJobParameters><Tier>Standard</Tier></GlacierJobParameters></RestoreRequest>`
+	req, err := http.NewRequest(http.MethodPost, "s3://bucket-name/object-key?restore", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := parseRestoreRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.Int64Value(rr.Days) != 2 || aws.StringValue(rr.GlacierJobParameters.Tier) != "Standard" {
+		t.Errorf("unexpected restore request: %v", rr)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, "s3://bucket-name/object-key?restore&days=foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseRestoreRequest(req); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestRoundTrip_ArchivedRetryAndLimit(t *testing.T) {
+	obj := &archivedTestObject{restore: aws.String(`ongoing-request="true"`)}
+	mock := obj.mock()
+	var count int
+	get := mock.getObjectWithContext
+	mock.getObjectWithContext = func(ctx context.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+		count++
+		return get(ctx, in, opts...)
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MinBackoff: time.Millisecond, BudgetRatio: 10}
+	s3.Limits = []Limit{{MaxConcurrency: 8, RequestsPerSecond: 1000}}
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorCodeHeader); got != "RestoreInProgress" {
+		t.Errorf("unexpected error code: want %q, got %q", "RestoreInProgress", got)
+	}
+
+	// the object being restored is neither retried nor treated as SlowDown.
+	if count != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, count)
+	}
+	l := s3.limiters[0]
+	l.mu.Lock()
+	window, rate := l.window, l.rate
+	l.mu.Unlock()
+	if window != 8 || rate != 1000 {
+		t.Errorf("the limits must not be decreased: window %v, rate %v", window, rate)
+	}
+}
@@ -0,0 +1,336 @@
+package s3protocol
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AttemptsHeader is the response header that reports how many attempts were made for the request.
+const AttemptsHeader = "X-S3protocol-Attempts"
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 5 * time.Second
+	defaultRetryBudgetRatio = 0.1
+
+	// the maximum number of the retries that can be made in a burst.
+	retryMaxBurst = 10
+)
+
+// RetryPolicy is the policy for retrying failed requests.
+// It applies to GET and HEAD requests, and to the lookups of the bucket regions.
+// If the response body of a GET request fails while reading, the rest of the body is requested
+// by a ranged GET request pinned to the ETag of the response with If-Match.
+// The zero value is a valid policy with the default configuration.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// If MaxAttempts is zero, 3 is used.
+	MaxAttempts int
+
+	// MinBackoff is the backoff before the first retry.
+	// The backoff doubles on each retry, and the actual wait is chosen randomly between zero and the backoff.
+	// If MinBackoff is zero, 100 milliseconds is used.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum backoff.
+	// If MaxBackoff is zero, five seconds is used.
+	MaxBackoff time.Duration
+
+	// Retryable reports whether the request should be retried.
+	// Exactly one of resp and err is non-nil.
+	// If Retryable is nil, timeouts, network errors, 429 Too Many Requests and 5xx responses are retried.
+	Retryable func(resp *http.Response, err error) bool
+
+	// Idempotent enables retrying PUT and DELETE requests.
+	// They are idempotent but not safe, so they are retried only if this is set,
+	// and the body of PUT requests must be replayable by req.GetBody.
+	Idempotent bool
+
+	// BudgetRatio is the maximum ratio of the retries to the requests.
+	// It prevents the retries from amplifying the load when S3 is overloaded.
+	// If BudgetRatio is zero, 0.1 is used.
+	BudgetRatio float64
+
+	mu     sync.Mutex
+	budget float64 // the number of retries that can be made
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return defaultRetryMaxAttempts
+}
+
+func (p *RetryPolicy) minBackoff() time.Duration {
+	if p.MinBackoff > 0 {
+		return p.MinBackoff
+	}
+	return defaultRetryMinBackoff
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+	return defaultRetryMaxBackoff
+}
+
+func (p *RetryPolicy) budgetRatio() float64 {
+	if p.BudgetRatio > 0 {
+		return p.BudgetRatio
+	}
+	return defaultRetryBudgetRatio
+}
+
+// start records a new request.
+func (p *RetryPolicy) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.budget = math.Min(retryMaxBurst, p.budget+p.budgetRatio())
+}
+
+// allow consumes the budget for a retry.
+func (p *RetryPolicy) allow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.budget < 1 {
+		return false
+	}
+	p.budget--
+	return true
+}
+
+func (p *RetryPolicy) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		// the caller gave up.
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	if err != nil {
+		if err == ErrFirstByteTimeout {
+			return true
+		}
+		if rerr, ok := awsRequestFailure(err); ok {
+			return isRetryableStatus(rerr.StatusCode())
+		}
+		_, ok := err.(net.Error)
+		return ok
+	}
+	return isRetryableStatus(resp.StatusCode)
+}
+
+// retryableRead reports whether the read of the response body should be resumed after err.
+func (p *RetryPolicy) retryableRead(ctx context.Context, err error) bool {
+	if err == errBodyClosed {
+		return false
+	}
+	if err == io.ErrUnexpectedEOF && ctx.Err() == nil && p.Retryable == nil {
+		// the connection is closed before the end of the body.
+		return true
+	}
+	return p.retryable(ctx, nil, err)
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff waits before the n-th retry.
+func (p *RetryPolicy) backoff(ctx context.Context, n int) error {
+	d := p.minBackoff() << uint(n-1)
+	if max := p.maxBackoff(); d > max || d <= 0 {
+		d = max
+	}
+	d = time.Duration(rand.Int63n(int64(d) + 1))
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do calls fn until it succeeds or the policy gives up.
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) error {
+	p.start()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.maxAttempts() || !p.retryable(ctx, nil, err) || !p.allow() {
+			return err
+		}
+		if err := p.backoff(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// isReplayable reports whether the request can be sent again under the policy.
+func (p *RetryPolicy) isReplayable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPut, http.MethodDelete:
+		return p.Idempotent && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	}
+	return false
+}
+
+// retry applies the Retry policy to fn.
+func (t *Transport) retry(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		p := t.Retry
+		ctx := req.Context()
+		p.start()
+		for attempt := 1; ; attempt++ {
+			r := req
+			if attempt > 1 && req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r = req.Clone(ctx)
+				r.Body = body
+			}
+
+			resp, err := fn(r)
+			if attempt < p.maxAttempts() && p.retryable(ctx, resp, err) && p.allow() {
+				if err == nil {
+					resp.Body.Close()
+				}
+				if err := p.backoff(ctx, attempt); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			resp.Header.Set(AttemptsHeader, strconv.Itoa(attempt))
+			if etag := resp.Header.Get("ETag"); req.Method == http.MethodGet && resp.StatusCode/100 == 2 &&
+				etag != "" && resp.Body != nil && resp.Body != http.NoBody {
+				resp.Body = &retryBody{
+					p:       p,
+					fn:      fn,
+					req:     req,
+					etag:    etag,
+					body:    resp.Body,
+					attempt: attempt,
+				}
+			}
+			return resp, nil
+		}
+	}
+}
+
+// retryBody resumes the response body of GET requests after a read failure.
+// The rest of the body is requested by a ranged GET request pinned to the ETag with If-Match.
+// The resumed requests count toward MaxAttempts together with the attempts for the response headers.
+type retryBody struct {
+	p       *RetryPolicy
+	fn      func(req *http.Request) (*http.Response, error)
+	req     *http.Request
+	etag    string
+	off     int64 // the number of bytes delivered
+	attempt int
+
+	// mu protects body and closed, so Close can be called while resuming.
+	mu     sync.Mutex
+	body   io.ReadCloser
+	closed bool
+}
+
+// Read implements io.Reader.
+func (b *retryBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.off += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if rerr := b.resume(err); rerr != nil {
+			return n, rerr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume replaces the failed body with the rest of the body.
+// It returns the original error if the body can't be resumed.
+func (b *retryBody) resume(err error) error {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return err
+	}
+
+	ctx := b.req.Context()
+	rangeHeader, ok := resumeRange(b.req.Header.Get("Range"), b.off)
+	if !ok {
+		return err
+	}
+	b.body.Close()
+	for b.attempt < b.p.maxAttempts() && b.p.retryableRead(ctx, err) && b.p.allow() {
+		if berr := b.p.backoff(ctx, b.attempt); berr != nil {
+			return err
+		}
+		b.attempt++
+
+		req := b.req.Clone(ctx)
+		req.Header.Set("Range", rangeHeader)
+		req.Header.Set("If-Match", b.etag)
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		req.Header.Del("If-Unmodified-Since")
+		req.Header.Del("If-Range")
+		resp, rerr := b.fn(req)
+		if rerr == nil && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusPreconditionFailed || !b.p.retryable(ctx, resp, nil) {
+				// the object is modified, or the failure is permanent.
+				return err
+			}
+			continue
+		}
+		if rerr != nil {
+			if !b.p.retryable(ctx, nil, rerr) {
+				return err
+			}
+			continue
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.closed {
+			resp.Body.Close()
+			return errBodyClosed
+		}
+		b.body = resp.Body
+		return nil
+	}
+	return err
+}
+
+// Close implements io.Closer.
+func (b *retryBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.body.Close()
+}
@@ -0,0 +1,290 @@
+package s3protocol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRetry(t *testing.T) {
+	var count int
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			count++
+			if count < 3 {
+				aerr := awserr.New("InternalError", "We encountered an internal error. Please try again.", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusInternalServerError, "request-id")
+			}
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MinBackoff: time.Millisecond, BudgetRatio: 10}
+
+	req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got := resp.Header.Get(AttemptsHeader); got != "3" {
+		t.Errorf("unexpected attempts: want %q, got %q", "3", got)
+	}
+}
+
+func TestRetry_NotRetryable(t *testing.T) {
+	var count int
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			count++
+			aerr := awserr.New("NotFound", "not found", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusNotFound, "request-id")
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MinBackoff: time.Millisecond}
+
+	req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if count != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, count)
+	}
+	if got := resp.Header.Get(AttemptsHeader); got != "1" {
+		t.Errorf("unexpected attempts: want %q, got %q", "1", got)
+	}
+}
+
+func TestRetry_Budget(t *testing.T) {
+	var count int
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			count++
+			aerr := awserr.New("SlowDown", "Please reduce your request rate.", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusServiceUnavailable, "request-id")
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MaxAttempts: 10, MinBackoff: time.Millisecond, BudgetRatio: 0.5}
+
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s3.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// 4 requests earn the budget for 2 retries.
+	if count != 6 {
+		t.Errorf("unexpected request count: want %d, got %d", 6, count)
+	}
+}
+
+func TestRetry_PUT(t *testing.T) {
+	var bodies []string
+	mock := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			data, err := ioutil.ReadAll(in.Body)
+			if err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, string(data))
+			if len(bodies) == 1 {
+				aerr := awserr.New("InternalError", "We encountered an internal error. Please try again.", nil)
+				return nil, awserr.NewRequestFailure(aerr, http.StatusInternalServerError, "request-id")
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MinBackoff: time.Millisecond, BudgetRatio: 10, Idempotent: true}
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(bodies) != 2 || bodies[0] != "Hello S3!" || bodies[1] != "Hello S3!" {
+		t.Errorf("unexpected bodies: %q", bodies)
+	}
+	if got := resp.Header.Get(AttemptsHeader); got != "2" {
+		t.Errorf("unexpected attempts: want %q, got %q", "2", got)
+	}
+}
+
+func TestIsReplayable(t *testing.T) {
+	idempotent := &RetryPolicy{Idempotent: true}
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", ioutil.NopCloser(strings.NewReader("Hello S3!")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idempotent.isReplayable(req) {
+		t.Error("the request without GetBody must not be replayable")
+	}
+
+	req, err = http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idempotent.isReplayable(req) {
+		t.Error("the request with GetBody must be replayable")
+	}
+	if (&RetryPolicy{}).isReplayable(req) {
+		t.Error("PUT must not be replayable unless Idempotent is set")
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(&RetryPolicy{}).isReplayable(req) {
+		t.Error("GET must be replayable")
+	}
+}
+
+// failingReader returns err after reading data.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestRetry_ResumeBody(t *testing.T) {
+	var requests []*s3.GetObjectInput
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			requests = append(requests, in)
+			if len(requests) == 1 {
+				return &s3.GetObjectOutput{
+					ETag:          aws.String(`"etag"`),
+					ContentLength: aws.Int64(9),
+					Body:          ioutil.NopCloser(&failingReader{data: []byte("Hello "), err: io.ErrUnexpectedEOF}),
+				}, nil
+			}
+			return &s3.GetObjectOutput{
+				ETag:          aws.String(`"etag"`),
+				ContentLength: aws.Int64(3),
+				ContentRange:  aws.String("bytes 6-8/9"),
+				Body:          ioutil.NopCloser(strings.NewReader("S3!")),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MinBackoff: time.Millisecond, BudgetRatio: 10}
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello S3!" {
+		t.Errorf("want %q, got %q", "Hello S3!", got)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("unexpected request count: want %d, got %d", 2, len(requests))
+	}
+	if in := requests[1]; aws.StringValue(in.Range) != "bytes=6-" || aws.StringValue(in.IfMatch) != `"etag"` {
+		t.Errorf("unexpected resumed request: range %q, if-match %q", aws.StringValue(in.Range), aws.StringValue(in.IfMatch))
+	}
+}
+
+func TestRetry_PUTNotIdempotent(t *testing.T) {
+	var count int
+	mock := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			count++
+			aerr := awserr.New("InternalError", "We encountered an internal error. Please try again.", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusInternalServerError, "request-id")
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.Retry = &RetryPolicy{MinBackoff: time.Millisecond, BudgetRatio: 10}
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if count != 1 {
+		t.Errorf("unexpected request count: want %d, got %d", 1, count)
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	var count int
+	p := &RetryPolicy{MinBackoff: time.Millisecond, BudgetRatio: 10}
+	err := p.do(context.Background(), func() error {
+		count++
+		aerr := awserr.New("InternalError", "We encountered an internal error. Please try again.", nil)
+		return awserr.NewRequestFailure(aerr, http.StatusInternalServerError, "request-id")
+	})
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+	if count != 3 {
+		t.Errorf("unexpected attempts: want %d, got %d", 3, count)
+	}
+
+	count = 0
+	err = p.do(context.Background(), func() error {
+		count++
+		return errors.New("not retryable")
+	})
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+	if count != 1 {
+		t.Errorf("unexpected attempts: want %d, got %d", 1, count)
+	}
+}
@@ -0,0 +1,645 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ErrChecksumMismatch is returned by Copy when the streamed object doesn't match the checksum of the source or the destination.
+var ErrChecksumMismatch = errors.New("s3protocol: checksum mismatch")
+
+// CopyResult is the result of Copy.
+type CopyResult struct {
+	// ETag is the entity tag of the copied object.
+	ETag string
+
+	// VersionID is the version id of the copied object.
+	VersionID string
+
+	// Streamed reports whether the object was streamed through the process
+	// instead of being copied on the server side.
+	Streamed bool
+}
+
+// Copy copies the object of srcURL read by src to dstURL written by t.
+// The urls are in the form of s3://[BUCKET_NAME]/[OBJECT_NAME]?versionId=[VERSION_ID],
+// and the version id of dstURL is ignored.
+// If src is nil, t is also used for reading the source.
+//
+// Copy tries the server-side copy first if src and t have the same endpoint.
+// If the server-side copy is impossible, e.g. the endpoints are different or
+// the credentials of t can't read the source, the object is streamed through the process:
+// it is downloaded with parallel ranged GetObject requests pinned to the ETag of the source,
+// and uploaded with parallel UploadPart requests.
+// The metadata, the content headers, the tags and the checksum algorithm are preserved,
+// and the integrity is verified against the checksums of the source and the destination.
+// If the tags can't be read, Copy fails unless CopySkipUnreadableTags is set.
+// The storage class and the server-side encryption settings of the source are not carried over by streaming;
+// the object is stored with the defaults of the destination bucket.
+func (t *Transport) Copy(ctx context.Context, dstURL string, src *Transport, srcURL string) (*CopyResult, error) {
+	if src == nil {
+		src = t
+	}
+	dst, err := parseObjectURL(dstURL)
+	if err != nil {
+		return nil, err
+	}
+	source, err := parseObjectURL(srcURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if src == t || src.endpoint() == t.endpoint() {
+		result, err := t.serverSideCopy(ctx, dst, source)
+		if !canStreamCopy(err) {
+			return result, err
+		}
+	}
+	return t.streamCopy(ctx, dst, src, source)
+}
+
+// parseObjectURL parses the url in the form of s3://[BUCKET_NAME]/[OBJECT_NAME]?versionId=[VERSION_ID].
+func parseObjectURL(rawurl string) (objectRef, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return objectRef{}, err
+	}
+	if u.Scheme != "s3" {
+		return objectRef{}, fmt.Errorf("s3protocol: unsupported protocol scheme %q", u.Scheme)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return objectRef{}, fmt.Errorf("s3protocol: invalid object url %q", rawurl)
+	}
+	return objectRef{
+		bucket:    u.Host,
+		key:       key,
+		versionID: u.Query().Get("versionId"),
+	}, nil
+}
+
+// endpoint returns the custom endpoint of the transport.
+// It is empty for the AWS endpoints.
+func (t *Transport) endpoint() string {
+	if t.config == nil {
+		return ""
+	}
+	cfg := t.config.ClientConfig(s3.EndpointsID)
+	if cfg.Config == nil {
+		return ""
+	}
+	return aws.StringValue(cfg.Config.Endpoint)
+}
+
+// canStreamCopy reports whether the failed server-side copy may succeed by streaming.
+func canStreamCopy(err error) bool {
+	rerr, ok := awsRequestFailure(err)
+	if !ok {
+		return false
+	}
+	switch rerr.StatusCode() {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// serverSideCopy copies the object in the same way as the PUT request with the x-amz-copy-source header.
+func (t *Transport) serverSideCopy(ctx context.Context, dst, src objectRef) (*CopyResult, error) {
+	u := &url.URL{Scheme: "s3", Host: dst.bucket, Path: "/" + dst.key}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Copy-Source", src.String())
+	resp, err := t.copyObject(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		code := resp.Header.Get(ErrorCodeHeader)
+		if code == "" {
+			code = http.StatusText(resp.StatusCode)
+		}
+		aerr := awserr.New(code, "the server-side copy failed", nil)
+		return nil, awserr.NewRequestFailure(aerr, resp.StatusCode, resp.Header.Get("X-Amz-Request-Id"))
+	}
+	var result copyObjectResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &CopyResult{
+		ETag:      result.ETag,
+		VersionID: resp.Header.Get("X-Amz-Version-Id"),
+	}, nil
+}
+
+// headChecksum returns the checksum algorithm and the checksum of the object.
+// The checksum of the object uploaded by the multipart upload has the "-N" suffix,
+// because it is the checksum of the checksums of the parts.
+func headChecksum(head *s3.HeadObjectOutput) (string, string) {
+	switch {
+	case head.ChecksumCRC32 != nil:
+		return s3.ChecksumAlgorithmCrc32, *head.ChecksumCRC32
+	case head.ChecksumCRC32C != nil:
+		return s3.ChecksumAlgorithmCrc32c, *head.ChecksumCRC32C
+	case head.ChecksumSHA1 != nil:
+		return s3.ChecksumAlgorithmSha1, *head.ChecksumSHA1
+	case head.ChecksumSHA256 != nil:
+		return s3.ChecksumAlgorithmSha256, *head.ChecksumSHA256
+	}
+	return "", ""
+}
+
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case s3.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE()
+	case s3.ChecksumAlgorithmCrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case s3.ChecksumAlgorithmSha1:
+		return sha1.New()
+	case s3.ChecksumAlgorithmSha256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// checksumFields returns the checksum members of the requests, such as PutObjectInput.ChecksumCRC32.
+func checksumFields(algorithm, checksum string) (crc32Sum, crc32cSum, sha1Sum, sha256Sum *string) {
+	if checksum == "" {
+		return
+	}
+	switch algorithm {
+	case s3.ChecksumAlgorithmCrc32:
+		crc32Sum = aws.String(checksum)
+	case s3.ChecksumAlgorithmCrc32c:
+		crc32cSum = aws.String(checksum)
+	case s3.ChecksumAlgorithmSha1:
+		sha1Sum = aws.String(checksum)
+	case s3.ChecksumAlgorithmSha256:
+		sha256Sum = aws.String(checksum)
+	}
+	return
+}
+
+// isMD5ETag reports whether the ETag of the object is the MD5 digest of the content.
+// It isn't for the multipart uploads and the objects encrypted with SSE-KMS or SSE-C.
+func isMD5ETag(head *s3.HeadObjectOutput) bool {
+	etag := strings.Trim(aws.StringValue(head.ETag), `"`)
+	if len(etag) != md5.Size*2 || strings.Contains(etag, "-") {
+		return false
+	}
+	if head.SSECustomerAlgorithm != nil {
+		return false
+	}
+	sse := aws.StringValue(head.ServerSideEncryption)
+	return sse == "" || sse == s3.ServerSideEncryptionAes256
+}
+
+// streamPart is a part of the streamed object.
+type streamPart struct {
+	data     []byte
+	md5      []byte
+	checksum []byte
+}
+
+// streamCopier streams the object from the source to the destination.
+type streamCopier struct {
+	t        *Transport
+	svc      s3iface.S3API
+	srcSvc   s3iface.S3API
+	dst      objectRef
+	src      objectRef
+	head     *s3.HeadObjectOutput
+	tagging  *string
+	size     int64
+	partSize int64
+
+	// the checksum of the source.
+	algorithm string
+	checksum  string
+
+	// the hashes of the whole object, written in the order of the parts.
+	md5Hash      hash.Hash
+	checksumHash hash.Hash
+}
+
+func (t *Transport) streamCopy(ctx context.Context, dst objectRef, src *Transport, source objectRef) (*CopyResult, error) {
+	srcSvc, err := src.getBucketClient(ctx, source.bucket)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := t.getBucketClient(ctx, dst.bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := srcSvc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(source.bucket),
+		Key:          aws.String(source.key),
+		VersionId:    nilIfEmpty(source.versionID),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if head.VersionId != nil {
+		source.versionID = aws.StringValue(head.VersionId)
+	}
+	tags, err := srcSvc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket:    aws.String(source.bucket),
+		Key:       aws.String(source.key),
+		VersionId: nilIfEmpty(source.versionID),
+	})
+	if err != nil {
+		// some providers don't support tagging,
+		// and GetObjectTagging needs the s3:GetObjectTagging permission besides s3:GetObject.
+		code := errorCode(err)
+		if !t.CopySkipUnreadableTags || (code != "NotImplemented" && code != "AccessDenied") {
+			return nil, err
+		}
+		tags = nil
+	}
+
+	c := &streamCopier{
+		t:       t,
+		svc:     svc,
+		srcSvc:  srcSvc,
+		dst:     dst,
+		src:     source,
+		head:    head,
+		size:    aws.Int64Value(head.ContentLength),
+		md5Hash: md5.New(),
+	}
+	if tags != nil && len(tags.TagSet) > 0 {
+		values := make(url.Values, len(tags.TagSet))
+		for _, tag := range tags.TagSet {
+			values.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+		}
+		c.tagging = aws.String(values.Encode())
+	}
+	c.algorithm, c.checksum = headChecksum(head)
+	if c.algorithm != "" {
+		c.checksumHash = newChecksumHash(c.algorithm)
+	}
+	c.partSize = t.partSize()
+	if c.partSize < s3manager.MinUploadPartSize {
+		c.partSize = s3manager.MinUploadPartSize
+	}
+	if min := (c.size + maxUploadParts - 1) / maxUploadParts; c.partSize < min {
+		c.partSize = min
+	}
+
+	var result *CopyResult
+	var expected string
+	if c.size <= c.partSize {
+		result, expected, err = c.putObject(ctx)
+	} else {
+		result, expected, err = c.multipartUpload(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verify(ctx, result, expected); err != nil {
+		return nil, err
+	}
+	result.Streamed = true
+	return result, nil
+}
+
+// download downloads the i-th part of the source.
+func (c *streamCopier) download(ctx context.Context, i int64) (*streamPart, error) {
+	start := i * c.partSize
+	end := start + c.partSize
+	if end > c.size {
+		end = c.size
+	}
+	data := make([]byte, end-start)
+	if len(data) > 0 {
+		out, err := c.srcSvc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:    aws.String(c.src.bucket),
+			Key:       aws.String(c.src.key),
+			VersionId: nilIfEmpty(c.src.versionID),
+			IfMatch:   c.head.ETag,
+			Range:     aws.String(fmt.Sprintf("bytes=%d-%d", start, end-1)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(out.Body, data)
+		out.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	part := &streamPart{data: data}
+	sum := md5.Sum(data)
+	part.md5 = sum[:]
+	if c.algorithm != "" {
+		h := newChecksumHash(c.algorithm)
+		h.Write(data)
+		part.checksum = h.Sum(nil)
+	}
+	return part, nil
+}
+
+// hash writes the part to the hashes of the whole object.
+// It must be called in the order of the parts.
+func (c *streamCopier) hash(part *streamPart) {
+	c.md5Hash.Write(part.data)
+	if c.checksumHash != nil {
+		c.checksumHash.Write(part.data)
+	}
+}
+
+// verifySource verifies the hashes of the whole object against the ETag and the checksum of the source.
+func (c *streamCopier) verifySource() error {
+	if c.checksumHash != nil && !strings.Contains(c.checksum, "-") {
+		if got := base64.StdEncoding.EncodeToString(c.checksumHash.Sum(nil)); got != c.checksum {
+			return fmt.Errorf("%w: the %s checksum of the source is %s, but got %s", ErrChecksumMismatch, c.algorithm, c.checksum, got)
+		}
+	}
+	if isMD5ETag(c.head) {
+		want := strings.Trim(aws.StringValue(c.head.ETag), `"`)
+		if got := hex.EncodeToString(c.md5Hash.Sum(nil)); got != want {
+			return fmt.Errorf("%w: the MD5 of the source is %s, but got %s", ErrChecksumMismatch, want, got)
+		}
+	}
+	return nil
+}
+
+func (c *streamCopier) putObject(ctx context.Context) (*CopyResult, string, error) {
+	part, err := c.download(ctx, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	c.hash(part)
+	if err := c.verifySource(); err != nil {
+		return nil, "", err
+	}
+
+	var expected string
+	if part.checksum != nil {
+		expected = base64.StdEncoding.EncodeToString(part.checksum)
+	}
+	in := &s3.PutObjectInput{
+		Bucket:                  aws.String(c.dst.bucket),
+		Key:                     aws.String(c.dst.key),
+		Body:                    bytes.NewReader(part.data),
+		ContentLength:           aws.Int64(int64(len(part.data))),
+		ContentMD5:              aws.String(base64.StdEncoding.EncodeToString(part.md5)),
+		CacheControl:            c.head.CacheControl,
+		ContentDisposition:      c.head.ContentDisposition,
+		ContentEncoding:         c.head.ContentEncoding,
+		ContentLanguage:         c.head.ContentLanguage,
+		ContentType:             c.head.ContentType,
+		Expires:                 parseExpires(c.head.Expires),
+		Metadata:                c.head.Metadata,
+		Tagging:                 c.tagging,
+		WebsiteRedirectLocation: c.head.WebsiteRedirectLocation,
+	}
+	in.ChecksumCRC32, in.ChecksumCRC32C, in.ChecksumSHA1, in.ChecksumSHA256 = checksumFields(c.algorithm, expected)
+	out, err := c.svc.PutObjectWithContext(ctx, in)
+	if err != nil {
+		return nil, "", err
+	}
+	c.t.invalidate(c.dst.bucket, c.dst.key)
+	return &CopyResult{
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionId),
+	}, expected, nil
+}
+
+func (c *streamCopier) multipartUpload(ctx context.Context) (*CopyResult, string, error) {
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:                  aws.String(c.dst.bucket),
+		Key:                     aws.String(c.dst.key),
+		CacheControl:            c.head.CacheControl,
+		ContentDisposition:      c.head.ContentDisposition,
+		ContentEncoding:         c.head.ContentEncoding,
+		ContentLanguage:         c.head.ContentLanguage,
+		ContentType:             c.head.ContentType,
+		Expires:                 parseExpires(c.head.Expires),
+		Metadata:                c.head.Metadata,
+		Tagging:                 c.tagging,
+		WebsiteRedirectLocation: c.head.WebsiteRedirectLocation,
+	}
+	if c.algorithm != "" {
+		create.ChecksumAlgorithm = aws.String(c.algorithm)
+	}
+	upload, err := c.svc.CreateMultipartUploadWithContext(ctx, create)
+	if err != nil {
+		return nil, "", err
+	}
+
+	parts, err := c.uploadParts(ctx, upload.UploadId)
+	if err == nil {
+		err = c.verifySource()
+	}
+	if err == nil {
+		var out *s3.CompleteMultipartUploadOutput
+		out, err = c.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(c.dst.bucket),
+			Key:             aws.String(c.dst.key),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		if err == nil {
+			c.t.invalidate(c.dst.bucket, c.dst.key)
+			return &CopyResult{
+				ETag:      aws.StringValue(out.ETag),
+				VersionID: aws.StringValue(out.VersionId),
+			}, c.compositeChecksum(parts), nil
+		}
+	}
+
+	// the context may be canceled, so abort the upload with another context.
+	abortCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	c.svc.AbortMultipartUploadWithContext(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(c.dst.bucket),
+		Key:      aws.String(c.dst.key),
+		UploadId: upload.UploadId,
+	})
+	return nil, "", err
+}
+
+// uploadParts downloads and uploads the parts in parallel.
+// The downloaded parts are written to the hashes of the whole object in order.
+func (c *streamCopier) uploadParts(ctx context.Context, uploadID *string) ([]*s3.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parts := make([]*s3.CompletedPart, (c.size+c.partSize-1)/c.partSize)
+
+	// turns[i] is closed when the i-th part can be written to the hashes.
+	turns := make([]chan struct{}, len(parts)+1)
+	for i := range turns {
+		turns[i] = make(chan struct{})
+	}
+	close(turns[0])
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	indexes := make(chan int)
+	for i := 0; i < c.t.multipartCopyConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				part, err := c.uploadPart(ctx, uploadID, i, turns)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					parts[i] = part
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+LOOP:
+	for i := range parts {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+func (c *streamCopier) uploadPart(ctx context.Context, uploadID *string, i int, turns []chan struct{}) (*s3.CompletedPart, error) {
+	part, err := c.download(ctx, int64(i))
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-turns[i]:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.hash(part)
+	close(turns[i+1])
+
+	var checksum string
+	if part.checksum != nil {
+		checksum = base64.StdEncoding.EncodeToString(part.checksum)
+	}
+	in := &s3.UploadPartInput{
+		Bucket:        aws.String(c.dst.bucket),
+		Key:           aws.String(c.dst.key),
+		UploadId:      uploadID,
+		PartNumber:    aws.Int64(int64(i + 1)),
+		Body:          bytes.NewReader(part.data),
+		ContentLength: aws.Int64(int64(len(part.data))),
+		ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(part.md5)),
+	}
+	in.ChecksumCRC32, in.ChecksumCRC32C, in.ChecksumSHA1, in.ChecksumSHA256 = checksumFields(c.algorithm, checksum)
+	out, err := c.svc.UploadPartWithContext(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	completed := &s3.CompletedPart{
+		ETag:       out.ETag,
+		PartNumber: aws.Int64(int64(i + 1)),
+	}
+	completed.ChecksumCRC32, completed.ChecksumCRC32C, completed.ChecksumSHA1, completed.ChecksumSHA256 = checksumFields(c.algorithm, checksum)
+	return completed, nil
+}
+
+// compositeChecksum returns the checksum of the multipart upload,
+// which is the checksum of the concatenated checksums of the parts with the "-N" suffix.
+func (c *streamCopier) compositeChecksum(parts []*s3.CompletedPart) string {
+	if c.algorithm == "" {
+		return ""
+	}
+	h := newChecksumHash(c.algorithm)
+	for _, part := range parts {
+		for _, v := range []*string{part.ChecksumCRC32, part.ChecksumCRC32C, part.ChecksumSHA1, part.ChecksumSHA256} {
+			if v == nil {
+				continue
+			}
+			sum, _ := base64.StdEncoding.DecodeString(*v)
+			h.Write(sum)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)) + "-" + strconv.Itoa(len(parts))
+}
+
+// verify verifies the size and the checksum of the destination.
+func (c *streamCopier) verify(ctx context.Context, result *CopyResult, expected string) error {
+	head, err := c.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(c.dst.bucket),
+		Key:          aws.String(c.dst.key),
+		VersionId:    nilIfEmpty(result.VersionID),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return err
+	}
+	if size := aws.Int64Value(head.ContentLength); size != c.size {
+		return fmt.Errorf("%w: the size of the source is %d, but the destination is %d", ErrChecksumMismatch, c.size, size)
+	}
+	if expected == "" {
+		return nil
+	}
+	if algorithm, checksum := headChecksum(head); algorithm == c.algorithm && checksum != expected {
+		return fmt.Errorf("%w: the %s checksum of the destination is %s, but want %s", ErrChecksumMismatch, algorithm, checksum, expected)
+	}
+	return nil
+}
+
+// parseExpires parses the Expires header of the object.
+// The invalid value is ignored.
+func parseExpires(s *string) *time.Time {
+	if s == nil {
+		return nil
+	}
+	expires, err := http.ParseTime(*s)
+	if err != nil {
+		return nil
+	}
+	return aws.Time(expires)
+}
@@ -0,0 +1,341 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// newTestSourceMock returns the mock serving data with ranged GetObject requests.
+func newTestSourceMock(t *testing.T, data []byte, head *s3.HeadObjectOutput) *s3mock {
+	return &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			if aws.StringValue(in.ChecksumMode) != s3.ChecksumModeEnabled {
+				t.Errorf("unexpected checksum mode: %q", aws.StringValue(in.ChecksumMode))
+			}
+			return head, nil
+		},
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			if aws.StringValue(in.IfMatch) != aws.StringValue(head.ETag) {
+				t.Errorf("unexpected If-Match: want %q, got %q", aws.StringValue(head.ETag), aws.StringValue(in.IfMatch))
+			}
+			var start, end int
+			if _, err := fmt.Sscanf(aws.StringValue(in.Range), "bytes=%d-%d", &start, &end); err != nil {
+				t.Errorf("unexpected range: %q", aws.StringValue(in.Range))
+			}
+			return &s3.GetObjectOutput{
+				Body: ioutil.NopCloser(bytes.NewReader(data[start : end+1])),
+			}, nil
+		},
+		getObjectTaggingWithContext: func(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []*s3.Tag{{Key: aws.String("a"), Value: aws.String("1")}},
+			}, nil
+		},
+	}
+}
+
+func TestCopy_ServerSide(t *testing.T) {
+	var copied *s3.CopyObjectInput
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(9)}, nil
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			copied = in
+			return &s3.CopyObjectOutput{
+				CopyObjectResult: &s3.CopyObjectResult{ETag: aws.String(`"0123456789abcdef"`)},
+				VersionId:        aws.String("v2"),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	result, err := s3.Copy(context.Background(), "s3://bucket-name/copied-key", nil, "s3://bucket-name/object-key?versionId=v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Streamed {
+		t.Error("want server-side copy, but streamed")
+	}
+	if result.ETag != `"0123456789abcdef"` || result.VersionID != "v2" {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if aws.StringValue(copied.CopySource) != "bucket-name/object-key?versionId=v1" || aws.StringValue(copied.Key) != "copied-key" {
+		t.Errorf("unexpected input: %v", copied)
+	}
+
+	if _, err := s3.Copy(context.Background(), "https://bucket-name/copied-key", nil, "s3://bucket-name/object-key"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestCopy_Stream(t *testing.T) {
+	data := []byte("hello world!")
+	md5sum := md5.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sha256sum[:])
+	src := newTestSourceMock(t, data, &s3.HeadObjectOutput{
+		ContentLength:  aws.Int64(int64(len(data))),
+		ETag:           aws.String(`"` + hex.EncodeToString(md5sum[:]) + `"`),
+		VersionId:      aws.String("v1"),
+		ContentType:    aws.String("text/plain"),
+		CacheControl:   aws.String("max-age=60"),
+		Expires:        aws.String("Wed, 21 Oct 2015 07:28:00 GMT"),
+		Metadata:       map[string]*string{"Foo": aws.String("bar")},
+		ChecksumSHA256: aws.String(checksum),
+	})
+	srcTransport := newTestTransport(src, "source-bucket")
+
+	var put *s3.PutObjectInput
+	var body []byte
+	dst := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			put = in
+			var err error
+			body, err = ioutil.ReadAll(in.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &s3.PutObjectOutput{ETag: aws.String(`"etag"`), VersionId: aws.String("v2")}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentLength:  aws.Int64(int64(len(body))),
+				ChecksumSHA256: put.ChecksumSHA256,
+			}, nil
+		},
+		copyObjectWithContext: func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+			t.Error("CopyObject must not be called")
+			return &s3.CopyObjectOutput{}, nil
+		},
+	}
+	dstTransport := newTestTransport(dst, "destination-bucket")
+	dstTransport.config = session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String("http://localhost:9000"),
+	}))
+
+	result, err := dstTransport.Copy(context.Background(), "s3://destination-bucket/copied-key", srcTransport, "s3://source-bucket/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Streamed || result.ETag != `"etag"` || result.VersionID != "v2" {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if string(body) != string(data) {
+		t.Errorf("unexpected body: want %q, got %q", data, body)
+	}
+	if aws.StringValue(put.Bucket) != "destination-bucket" || aws.StringValue(put.Key) != "copied-key" {
+		t.Errorf("unexpected destination: %s/%s", aws.StringValue(put.Bucket), aws.StringValue(put.Key))
+	}
+	if aws.StringValue(put.ContentType) != "text/plain" || aws.StringValue(put.CacheControl) != "max-age=60" || put.Expires == nil {
+		t.Errorf("unexpected content headers: %v", put)
+	}
+	if aws.StringValue(put.Metadata["Foo"]) != "bar" || aws.StringValue(put.Tagging) != "a=1" {
+		t.Errorf("unexpected metadata or tags: %v, %q", put.Metadata, aws.StringValue(put.Tagging))
+	}
+	if aws.StringValue(put.ChecksumSHA256) != checksum {
+		t.Errorf("unexpected checksum: want %q, got %q", checksum, aws.StringValue(put.ChecksumSHA256))
+	}
+	if want := base64.StdEncoding.EncodeToString(md5sum[:]); aws.StringValue(put.ContentMD5) != want {
+		t.Errorf("unexpected Content-MD5: want %q, got %q", want, aws.StringValue(put.ContentMD5))
+	}
+
+	// the same endpoint, but the destination can't read the source.
+	dstTransport.config = nil
+	dstTransport.s3.Store("source-bucket", &s3api{svc: &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			aerr := awserr.New("AccessDenied", "Access Denied", nil)
+			return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+		},
+	}})
+	body = nil
+	result, err = dstTransport.Copy(context.Background(), "s3://destination-bucket/copied-key", srcTransport, "s3://source-bucket/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Streamed || string(body) != string(data) {
+		t.Errorf("unexpected result: %#v, %q", result, body)
+	}
+}
+
+func TestCopy_StreamTaggingDenied(t *testing.T) {
+	data := []byte("hello world!")
+	md5sum := md5.Sum(data)
+	src := newTestSourceMock(t, data, &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(`"` + hex.EncodeToString(md5sum[:]) + `"`),
+	})
+	src.getObjectTaggingWithContext = func(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+		aerr := awserr.New("AccessDenied", "Access Denied", nil)
+		return nil, awserr.NewRequestFailure(aerr, http.StatusForbidden, "request-id")
+	}
+	srcTransport := newTestTransport(src, "source-bucket")
+
+	var put *s3.PutObjectInput
+	dst := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			put = in
+			if _, err := ioutil.ReadAll(in.Body); err != nil {
+				t.Fatal(err)
+			}
+			return &s3.PutObjectOutput{ETag: aws.String(`"etag"`)}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data)))}, nil
+		},
+	}
+	dstTransport := newTestTransport(dst, "destination-bucket")
+	dstTransport.config = session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String("http://localhost:9000"),
+	}))
+
+	// the tags are required by default.
+	_, err := dstTransport.Copy(context.Background(), "s3://destination-bucket/copied-key", srcTransport, "s3://source-bucket/object-key")
+	if errorCode(err) != "AccessDenied" {
+		t.Errorf("want AccessDenied, got %v", err)
+	}
+	if put != nil {
+		t.Error("PutObject must not be called")
+	}
+
+	// the tags are skipped.
+	dstTransport.CopySkipUnreadableTags = true
+	result, err := dstTransport.Copy(context.Background(), "s3://destination-bucket/copied-key", srcTransport, "s3://source-bucket/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Streamed {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if put.Tagging != nil {
+		t.Errorf("unexpected tags: %q", aws.StringValue(put.Tagging))
+	}
+}
+
+func TestCopy_StreamMultipart(t *testing.T) {
+	const partSize = 5 * 1024 * 1024
+	data := make([]byte, 2*partSize+1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	srcTransport := newTestTransport(newTestSourceMock(t, data, &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(`"0123456789abcdef-2"`),
+		ContentType:   aws.String("application/octet-stream"),
+		ChecksumCRC32: aws.String("AAAAAA==-2"),
+	}), "source-bucket")
+
+	var mu sync.Mutex
+	var create *s3.CreateMultipartUploadInput
+	var complete *s3.CompleteMultipartUploadInput
+	uploaded := make(map[int64][]byte)
+	dst := &s3mock{
+		createMultipartUploadWithContext: func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+			create = in
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+		},
+		uploadPartWithContext: func(ctx context.Context, in *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+			body, err := ioutil.ReadAll(in.Body)
+			if err != nil {
+				return nil, err
+			}
+			sum := crc32.ChecksumIEEE(body)
+			want := base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+			if aws.StringValue(in.ChecksumCRC32) != want {
+				t.Errorf("part %d: unexpected checksum: want %q, got %q", aws.Int64Value(in.PartNumber), want, aws.StringValue(in.ChecksumCRC32))
+			}
+			mu.Lock()
+			uploaded[aws.Int64Value(in.PartNumber)] = body
+			mu.Unlock()
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf(`"part-%d"`, aws.Int64Value(in.PartNumber)))}, nil
+		},
+		completeMultipartUploadWithContext: func(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+			complete = in
+			return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"etag-3"`)}, nil
+		},
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			h := crc32.NewIEEE()
+			for _, part := range complete.MultipartUpload.Parts {
+				sum, _ := base64.StdEncoding.DecodeString(aws.StringValue(part.ChecksumCRC32))
+				h.Write(sum)
+			}
+			return &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(int64(len(data))),
+				ChecksumCRC32: aws.String(base64.StdEncoding.EncodeToString(h.Sum(nil)) + "-3"),
+			}, nil
+		},
+	}
+	dstTransport := newTestTransport(dst, "destination-bucket")
+	dstTransport.config = session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String("http://localhost:9000"),
+	}))
+	dstTransport.PartSize = partSize
+	dstTransport.Concurrency = 3
+
+	result, err := dstTransport.Copy(context.Background(), "s3://destination-bucket/copied-key", srcTransport, "s3://source-bucket/object-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Streamed || result.ETag != `"etag-3"` {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if aws.StringValue(create.ChecksumAlgorithm) != s3.ChecksumAlgorithmCrc32 || aws.StringValue(create.Tagging) != "a=1" {
+		t.Errorf("unexpected input: %v", create)
+	}
+	if len(complete.MultipartUpload.Parts) != 3 {
+		t.Fatalf("unexpected parts: %v", complete.MultipartUpload.Parts)
+	}
+	var got []byte
+	for i, part := range complete.MultipartUpload.Parts {
+		if aws.Int64Value(part.PartNumber) != int64(i+1) || aws.StringValue(part.ETag) != fmt.Sprintf(`"part-%d"`, i+1) {
+			t.Errorf("unexpected part: %v", part)
+		}
+		got = append(got, uploaded[int64(i+1)]...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the uploaded data doesn't match the source")
+	}
+}
+
+func TestCopy_StreamChecksumMismatch(t *testing.T) {
+	data := []byte("hello world!")
+	srcTransport := newTestTransport(newTestSourceMock(t, data, &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(`"00000000000000000000000000000000"`),
+	}), "source-bucket")
+	dst := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			t.Error("PutObject must not be called")
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+	dstTransport := newTestTransport(dst, "destination-bucket")
+	dstTransport.config = session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String("http://localhost:9000"),
+	}))
+
+	_, err := dstTransport.Copy(context.Background(), "s3://destination-bucket/copied-key", srcTransport, "s3://source-bucket/object-key")
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("want ErrChecksumMismatch, got %v", err)
+	}
+}
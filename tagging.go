@@ -0,0 +1,149 @@
+package s3protocol
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// tagging is the tag set of the object exchanged in JSON or XML.
+//
+// JSON:
+//
+//	{"TagSet": [{"Key": "key", "Value": "value"}]}
+//
+// XML:
+//
+//	<Tagging><TagSet><Tag><Key>key</Key><Value>value</Value></Tag></TagSet></Tagging>
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging" json:"-"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty" json:"-"`
+	TagSet  []tag    `xml:"TagSet>Tag" json:"TagSet"`
+}
+
+type tag struct {
+	Key   string `xml:"Key" json:"Key"`
+	Value string `xml:"Value" json:"Value"`
+}
+
+func (t *Transport) getObjectTagging(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newGetObjectTaggingInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	out, err := svc.GetObjectTaggingWithContext(ctx, in)
+	header := makeHeaderFromGetObjectTaggingOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	body := tagging{
+		Xmlns:  s3Namespace,
+		TagSet: make([]tag, 0, len(out.TagSet)),
+	}
+	for _, v := range out.TagSet {
+		body.TagSet = append(body.TagSet, tag{
+			Key:   aws.StringValue(v.Key),
+			Value: aws.StringValue(v.Value),
+		})
+	}
+	return encodeResponse(req, http.StatusOK, header, &body)
+}
+
+func (t *Transport) putObjectTagging(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	var body tagging
+	if err := decodeRequest(req, &body); err != nil {
+		return textResponse(http.StatusBadRequest, nil, err.Error()+"\n"), nil
+	}
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newPutObjectTaggingInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	in.Tagging = &s3.Tagging{
+		TagSet: make([]*s3.Tag, 0, len(body.TagSet)),
+	}
+	for _, v := range body.TagSet {
+		in.Tagging.TagSet = append(in.Tagging.TagSet, &s3.Tag{
+			Key:   aws.String(v.Key),
+			Value: aws.String(v.Value),
+		})
+	}
+	out, err := svc.PutObjectTaggingWithContext(ctx, in)
+	header := makeHeaderFromPutObjectTaggingOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
+
+func (t *Transport) deleteObjectTagging(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newDeleteObjectTaggingInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	out, err := svc.DeleteObjectTaggingWithContext(ctx, in)
+	header := makeHeaderFromDeleteObjectTaggingOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+	t.invalidate(host, path)
+
+	return &http.Response{
+		Status:     "204 No Content",
+		StatusCode: http.StatusNoContent,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
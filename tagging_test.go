@@ -0,0 +1,214 @@
+package s3protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type taggingTestObject struct {
+	tags      []*s3.Tag
+	versionID string
+}
+
+func (obj *taggingTestObject) mock() *s3mock {
+	return &s3mock{
+		getObjectTaggingWithContext: func(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+			obj.versionID = aws.StringValue(in.VersionId)
+			return &s3.GetObjectTaggingOutput{
+				TagSet:    obj.tags,
+				VersionId: in.VersionId,
+			}, nil
+		},
+		putObjectTaggingWithContext: func(ctx context.Context, in *s3.PutObjectTaggingInput, _ ...request.Option) (*s3.PutObjectTaggingOutput, error) {
+			obj.versionID = aws.StringValue(in.VersionId)
+			obj.tags = in.Tagging.TagSet
+			return &s3.PutObjectTaggingOutput{}, nil
+		},
+		deleteObjectTaggingWithContext: func(ctx context.Context, in *s3.DeleteObjectTaggingInput, _ ...request.Option) (*s3.DeleteObjectTaggingOutput, error) {
+			obj.versionID = aws.StringValue(in.VersionId)
+			obj.tags = nil
+			return &s3.DeleteObjectTaggingOutput{}, nil
+		},
+	}
+}
+
+func TestRoundTrip_Tagging(t *testing.T) {
+	obj := &taggingTestObject{}
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", newTestTransport(obj.mock(), "bucket-name"))
+	c := &http.Client{Transport: tr}
+
+	// put tags in JSON
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?tagging&versionId=foobar", strings.NewReader(`{"TagSet":[{"Key":"project","Value":"s3protocol"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if len(obj.tags) != 1 || aws.StringValue(obj.tags[0].Key) != "project" || aws.StringValue(obj.tags[0].Value) != "s3protocol" {
+		t.Errorf("unexpected tags: %v", obj.tags)
+	}
+	if obj.versionID != "foobar" {
+		t.Errorf("unexpected version id: want %q, got %q", "foobar", obj.versionID)
+	}
+
+	// get tags in XML
+	resp, err = c.Get("s3://bucket-name/object-key?tagging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<Tagging xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><TagSet><Tag><Key>project</Key><Value>s3protocol</Value></Tag></TagSet></Tagging>`
+	if string(body) != want {
+		t.Errorf("want %s, got %s", want, body)
+	}
+
+	// get tags in JSON
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key?tagging", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"TagSet":[{"Key":"project","Value":"s3protocol"}]}`; string(body) != want {
+		t.Errorf("want %s, got %s", want, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("unexpected Content-Type: %q", got)
+	}
+
+	// delete tags
+	req, err = http.NewRequest(http.MethodDelete, "s3://bucket-name/object-key?tagging", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if obj.tags != nil {
+		t.Errorf("unexpected tags: %v", obj.tags)
+	}
+}
+
+func TestRoundTrip_TaggingXML(t *testing.T) {
+	obj := &taggingTestObject{}
+	s3 := newTestTransport(obj.mock(), "bucket-name")
+
+	body := `<Tagging xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><TagSet><Tag><Key>a</Key><Value>1</Value></Tag><Tag><Key>b</Key><Value>2</Value></Tag></TagSet></Tagging>`
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?tagging", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(obj.tags) != 2 || aws.StringValue(obj.tags[1].Key) != "b" {
+		t.Errorf("unexpected tags: %v", obj.tags)
+	}
+
+	// invalid body
+	req, err = http.NewRequest(http.MethodPut, "s3://bucket-name/object-key?tagging", strings.NewReader("<Tagging>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// HEAD is not supported
+	req, err = http.NewRequest(http.MethodHead, "s3://bucket-name/object-key?tagging", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestRoundTrip_PUTWithTagging(t *testing.T) {
+	var tagging string
+	mock := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			tagging = aws.StringValue(in.Tagging)
+			return &s3.PutObjectOutput{}, nil
+		},
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				TagCount: aws.Int64(2),
+				Body:     ioutil.NopCloser(strings.NewReader("Hello S3!")),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Tagging", "a=1&b=2")
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if tagging != "a=1&b=2" {
+		t.Errorf("unexpected tagging: want %q, got %q", "a=1&b=2", tagging)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Amz-Tagging-Count"); got != "2" {
+		t.Errorf("unexpected x-amz-tagging-count: want %q, got %q", "2", got)
+	}
+}
@@ -0,0 +1,280 @@
+package s3protocol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMinThroughputInterval = 10 * time.Second
+
+// the states of the first byte timeout.
+const (
+	firstBytePending int32 = iota
+	firstByteArrived
+	firstByteTimedOut
+)
+
+// timeoutError is the error for the timeouts of the Transport.
+// It implements net.Error, and its Timeout method reports true.
+type timeoutError struct {
+	msg string
+}
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+var (
+	// ErrFirstByteTimeout is returned by RoundTrip when the response doesn't arrive within FirstByteTimeout.
+	ErrFirstByteTimeout error = &timeoutError{"s3protocol: timeout awaiting response headers"}
+
+	// ErrBodyStalled is returned by the response body when no data arrives within ReadTimeout,
+	// or the throughput drops below MinThroughput.
+	ErrBodyStalled error = &timeoutError{"s3protocol: response body stalled"}
+)
+
+func (t *Transport) minThroughputInterval() time.Duration {
+	if t.MinThroughputInterval > 0 {
+		return t.MinThroughputInterval
+	}
+	return defaultMinThroughputInterval
+}
+
+// timeout applies FirstByteTimeout, ReadTimeout and MinThroughput to fn.
+func (t *Transport) timeout(fn func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		resp, cancel, err := t.firstByte(req, fn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Body == nil || resp.Body == http.NoBody {
+			cancel()
+			return resp, nil
+		}
+		if t.ReadTimeout <= 0 && t.MinThroughput <= 0 {
+			// the body is read with the context of the request, so it must not be canceled until the body is closed.
+			resp.Body = &cancelBody{
+				ReadCloser: resp.Body,
+				cancel:     cancel,
+			}
+			return resp, nil
+		}
+
+		b := &timeoutBody{
+			t:      t,
+			fn:     fn,
+			req:    req,
+			etag:   resp.Header.Get("ETag"),
+			body:   resp.Body,
+			cancel: cancel,
+		}
+		if resp.StatusCode/100 != 2 {
+			// the error responses are not resumable.
+			b.etag = ""
+		}
+		resp.Body = b
+		return resp, nil
+	}
+}
+
+// firstByte calls fn with FirstByteTimeout.
+// The returned cancel function must be called after the response body is closed.
+func (t *Transport) firstByte(req *http.Request, fn func(req *http.Request) (*http.Response, error)) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	if t.FirstByteTimeout <= 0 {
+		resp, err := fn(req.WithContext(ctx))
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		return resp, cancel, nil
+	}
+
+	// state is firstBytePending until either the response arrives or the timer fires.
+	// the timer cancels the request only if it wins, so the response that arrives just in time is kept.
+	var state int32
+	timer := time.AfterFunc(t.FirstByteTimeout, func() {
+		if atomic.CompareAndSwapInt32(&state, firstBytePending, firstByteTimedOut) {
+			cancel()
+		}
+	})
+	resp, err := fn(req.WithContext(ctx))
+	timer.Stop()
+	if !atomic.CompareAndSwapInt32(&state, firstBytePending, firstByteArrived) {
+		// the timer has fired, so the response is the error caused by the cancellation.
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, nil, ErrFirstByteTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
+
+// timeoutBody is the response body with ReadTimeout and MinThroughput.
+type timeoutBody struct {
+	t    *Transport
+	fn   func(req *http.Request) (*http.Response, error)
+	req  *http.Request
+	etag string
+
+	// cmu protects cancel and closed, so Close can abort a blocked Read.
+	cmu    sync.Mutex
+	cancel context.CancelFunc
+	closed bool
+
+	mu      sync.Mutex
+	body    io.ReadCloser
+	off     int64 // the number of bytes read
+	resumed bool
+	resume  int64 // the offset where the last resume started
+	err     error
+
+	// for MinThroughput
+	busy  time.Duration // the time spent in Read since the last check
+	bytes int64         // the number of bytes read since the last check
+}
+
+// Read implements io.Reader.
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		start := time.Now()
+		var timer *time.Timer
+		if b.t.ReadTimeout > 0 {
+			timer = time.AfterFunc(b.t.ReadTimeout, b.abort)
+		}
+		n, err := b.body.Read(p)
+		stalled := timer != nil && !timer.Stop()
+		b.off += int64(n)
+
+		if b.t.MinThroughput > 0 && !stalled {
+			b.busy += time.Since(start)
+			b.bytes += int64(n)
+			if interval := b.t.minThroughputInterval(); b.busy >= interval {
+				if float64(b.bytes)/b.busy.Seconds() < float64(b.t.MinThroughput) {
+					stalled = true
+				}
+				b.busy, b.bytes = 0, 0
+			}
+		}
+
+		if stalled && err != io.EOF {
+			b.err = b.resumeLocked()
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			b.err = err
+		}
+		return n, err
+	}
+}
+
+// resumeLocked aborts the current body, and makes a new request for the rest of the body.
+// It returns ErrBodyStalled if the body can't be resumed.
+func (b *timeoutBody) resumeLocked() error {
+	b.abort()
+	b.body.Close()
+
+	// give up if the last resume made no progress.
+	if !b.t.ResumeOnStall || b.etag == "" || (b.resumed && b.resume == b.off) {
+		return ErrBodyStalled
+	}
+	rangeHeader, ok := resumeRange(b.req.Header.Get("Range"), b.off)
+	if !ok {
+		return ErrBodyStalled
+	}
+	b.resumed = true
+	b.resume = b.off
+
+	req := b.req.Clone(b.req.Context())
+	req.Header.Set("Range", rangeHeader)
+	req.Header.Set("If-Match", b.etag)
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Del("If-Unmodified-Since")
+	resp, cancel, err := b.t.firstByte(req, b.fn)
+	if err != nil {
+		return ErrBodyStalled
+	}
+	if resp.StatusCode/100 != 2 || resp.Header.Get("ETag") != b.etag {
+		resp.Body.Close()
+		cancel()
+		return ErrBodyStalled
+	}
+
+	b.cmu.Lock()
+	if b.closed {
+		b.cmu.Unlock()
+		resp.Body.Close()
+		cancel()
+		return errBodyClosed
+	}
+	b.cancel = cancel
+	b.cmu.Unlock()
+	b.body = resp.Body
+	return nil
+}
+
+// abort cancels the current request.
+func (b *timeoutBody) abort() {
+	b.cmu.Lock()
+	cancel := b.cancel
+	b.cmu.Unlock()
+	cancel()
+}
+
+// resumeRange returns the Range header for the rest of the body after off bytes are read.
+func resumeRange(rangeHeader string, off int64) (string, bool) {
+	if rangeHeader == "" {
+		return fmt.Sprintf("bytes=%d-", off), true
+	}
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return "", false
+	}
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	idx := strings.IndexByte(spec, '-')
+	if idx <= 0 || strings.Contains(spec, ",") {
+		// suffix ranges and multiple ranges are not supported.
+		return "", false
+	}
+	start, err := strconv.ParseInt(spec[:idx], 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("bytes=%d-%s", start+off, spec[idx+1:]), true
+}
+
+// Close implements io.Closer.
+func (b *timeoutBody) Close() error {
+	b.cmu.Lock()
+	b.closed = true
+	b.cmu.Unlock()
+	b.abort()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = errBodyClosed
+	}
+	return b.body.Close()
+}
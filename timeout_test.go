@@ -0,0 +1,198 @@
+package s3protocol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// stallReader returns data, and then blocks until ctx is canceled.
+type stallReader struct {
+	ctx  context.Context
+	data string
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if r.data != "" {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+func TestFirstByteTimeout(t *testing.T) {
+	mock := &s3mock{
+		headObjectWithContext: func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.FirstByteTimeout = 10 * time.Millisecond
+
+	req, err := http.NewRequest(http.MethodHead, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3.RoundTrip(req); err != ErrFirstByteTimeout {
+		t.Errorf("want ErrFirstByteTimeout, got %v", err)
+	}
+}
+
+func TestFirstByteTimeout_Body(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket-name/object-key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(ts.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+	}))
+	tr := &Transport{FirstByteTimeout: time.Second}
+	tr.s3.Store("bucket-name", &s3api{svc: s3.New(sess)})
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the body is still readable after the response arrives.
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("unexpected body: want %d bytes, got %d bytes", len(data), len(got))
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				ETag: aws.String(`"etag"`),
+				Body: ioutil.NopCloser(&stallReader{ctx: ctx, data: "Hello"}),
+			}, nil
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.ReadTimeout = 10 * time.Millisecond
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != ErrBodyStalled {
+		t.Errorf("want ErrBodyStalled, got %v", err)
+	}
+	if string(got) != "Hello" {
+		t.Errorf("want %q, got %q", "Hello", got)
+	}
+}
+
+func TestReadTimeout_Resume(t *testing.T) {
+	const data = "Hello S3!"
+	var count int32
+	mock := &s3mock{
+		getObjectWithContext: func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			switch atomic.AddInt32(&count, 1) {
+			case 1:
+				return &s3.GetObjectOutput{
+					ETag: aws.String(`"etag"`),
+					Body: ioutil.NopCloser(&stallReader{ctx: ctx, data: data[:5]}),
+				}, nil
+			default:
+				if got := aws.StringValue(in.Range); got != "bytes=5-" {
+					t.Errorf("unexpected range: want %q, got %q", "bytes=5-", got)
+				}
+				if got := aws.StringValue(in.IfMatch); got != `"etag"` {
+					t.Errorf("unexpected If-Match: want %q, got %q", `"etag"`, got)
+				}
+				return &s3.GetObjectOutput{
+					ETag: aws.String(`"etag"`),
+					Body: ioutil.NopCloser(strings.NewReader(data[5:])),
+				}, nil
+			}
+		},
+	}
+	s3 := newTestTransport(mock, "bucket-name")
+	s3.ReadTimeout = 10 * time.Millisecond
+	s3.ResumeOnStall = true
+
+	req, err := http.NewRequest(http.MethodGet, "s3://bucket-name/object-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s3.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("want %q, got %q", data, got)
+	}
+	if got := atomic.LoadInt32(&count); got != 2 {
+		t.Errorf("unexpected request count: want %d, got %d", 2, got)
+	}
+}
+
+func TestResumeRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		off  int64
+		want string
+		ok   bool
+	}{
+		{"", 10, "bytes=10-", true},
+		{"bytes=100-", 10, "bytes=110-", true},
+		{"bytes=100-199", 10, "bytes=110-199", true},
+		{"bytes=-100", 10, "", false},
+		{"bytes=0-9,20-29", 10, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := resumeRange(tt.in, tt.off)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("resumeRange(%q, %d): want %q, %t, got %q, %t", tt.in, tt.off, tt.want, tt.ok, got, ok)
+		}
+	}
+}
@@ -2,14 +2,21 @@ package s3protocol
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -50,6 +57,145 @@ func (c *s3api) get(ctx context.Context, t *Transport, bucket string) (s3iface.S
 
 // Transport serving the S3 objects.
 type Transport struct {
+	// Concurrency is the number of goroutines used for downloading a large object.
+	// If Concurrency is less than 2, objects are downloaded with a single GetObject request.
+	Concurrency int
+
+	// PartSize is the size of each ranged GetObject request in the parallel download.
+	// If PartSize is zero, s3manager.DefaultDownloadPartSize is used.
+	PartSize int64
+
+	// ParallelThreshold is the object size up to which objects are streamed
+	// with a single request even if Concurrency is set.
+	// If ParallelThreshold is zero, PartSize is used.
+	ParallelThreshold int64
+
+	// MultipartCopyThreshold is the object size above which objects are copied
+	// by a multipart upload with parallel UploadPartCopy requests instead of a single CopyObject request.
+	// The parts are copied by Concurrency goroutines, or by s3manager.DefaultUploadConcurrency goroutines if Concurrency is less than 2.
+	// If MultipartCopyThreshold is zero, 5 GiB, the maximum size of CopyObject, is used.
+	MultipartCopyThreshold int64
+
+	// MultipartCopyPartSize is the size of each part of the multipart copy.
+	// It is raised if the object would have more than 10,000 parts.
+	// If MultipartCopyPartSize is zero, 512 MiB is used.
+	MultipartCopyPartSize int64
+
+	// CopySkipUnreadableTags makes Copy skip the tags of the source if GetObjectTagging is denied or not implemented
+	// while streaming the object, so the copy has no tags.
+	// By default, Copy fails in that case, because the tags would be lost silently.
+	CopySkipUnreadableTags bool
+
+	// BlockCache is the cache for the random access reads of the objects opened by Open,
+	// and for the GET requests with the Range header.
+	// A ranged GET request is pinned to the object by a HeadObject request, and served from the cached blocks.
+	// If BlockCache is nil, every read makes a ranged GetObject request.
+	BlockCache *BlockCache
+
+	// Cache is the cache for the responses of GET requests.
+	// If Cache is nil, the responses are not cached.
+	Cache *ResponseCache
+
+	// HeadCache is the cache for the responses of HEAD requests.
+	// If HeadCache is nil, the responses are not cached.
+	HeadCache *HeadCache
+
+	// CoalesceRequests enables sharing one upstream call among concurrent identical GET and HEAD requests.
+	// Requests are identical if they have the same bucket, key, query and the headers that affect the response,
+	// such as Range, the conditional headers and the SSE-C headers.
+	CoalesceRequests bool
+
+	// CoalesceBufferSize is the size of the buffer for fanning out the shared response body.
+	// The shared body is read as fast as the slowest reader once the buffer is full.
+	// If CoalesceBufferSize is zero, 1 MiB is used.
+	CoalesceBufferSize int
+
+	// Limits are the concurrency and rate limits of the requests.
+	// All limits that match the bucket and the key of a request are applied.
+	// The limits are fixed at the first request; changing them after that has no effect.
+	Limits []Limit
+
+	// Hedge is the policy for hedged GET and HEAD requests.
+	// If Hedge is nil, requests are not hedged.
+	Hedge *HedgePolicy
+
+	// FirstByteTimeout is the maximum time to wait for the response of GET and HEAD requests.
+	// If the response doesn't arrive in time, RoundTrip returns ErrFirstByteTimeout.
+	// If FirstByteTimeout is zero, there is no timeout.
+	FirstByteTimeout time.Duration
+
+	// ReadTimeout is the maximum time that a Read of the response body of GET requests waits for data.
+	// If no data arrives in time, the underlying request is aborted and the body returns ErrBodyStalled.
+	// If ReadTimeout is zero, there is no timeout.
+	ReadTimeout time.Duration
+
+	// MinThroughput is the minimum throughput of the response body of GET requests in bytes per second.
+	// The throughput is measured over the time spent in Read, so slow readers don't trip it.
+	// A slower body is treated as stalled.
+	// If MinThroughput is zero, the throughput is not checked.
+	MinThroughput int64
+
+	// MinThroughputInterval is the interval of measuring MinThroughput.
+	// If MinThroughputInterval is zero, ten seconds is used.
+	MinThroughputInterval time.Duration
+
+	// ResumeOnStall enables resuming the stalled response body with a ranged GetObject request
+	// for the rest of the body, instead of returning ErrBodyStalled.
+	// The ranged request is pinned to the ETag of the original response.
+	ResumeOnStall bool
+
+	// Retry is the policy for retrying failed requests.
+	// The number of attempts is reported in the AttemptsHeader header of the response.
+	// If Retry is nil, only the retryer of the AWS SDK retries the requests.
+	Retry *RetryPolicy
+
+	// Decompress enables decompressing the response body of GET requests with Content-Encoding,
+	// unless the request has the Accept-Encoding or Range header.
+	// The Content-Encoding and Content-Length headers are removed from the decompressed response,
+	// and Uncompressed is set to true, as net/http does for gzip.
+	// gzip and deflate are supported by default; other encodings, including zstd and br, need Decoders.
+	// The bodies in the encodings without decoders are returned as is, with the Content-Encoding header.
+	Decompress bool
+
+	// DecompressBySuffix enables decompressing the objects without Content-Encoding
+	// by the suffix of the key: .gz for gzip, .zst for zstd and .br for br.
+	// If there is no decoder for the encoding, the Content-Encoding header is set to the response instead,
+	// and the body is returned as is.
+	// It has no effect unless Decompress is set.
+	DecompressBySuffix bool
+
+	// Decoders are the decoders for Decompress keyed by the content coding, such as "zstd" and "br".
+	// zstd and br are not decoded unless their decoders are set here,
+	// for example with github.com/klauspost/compress/zstd and github.com/andybalholm/brotli.
+	// They take precedence over the default decoders.
+	Decoders map[string]func(r io.Reader) (io.ReadCloser, error)
+
+	// Precompressed enables serving the precompressed sibling objects, key.br and key.gz,
+	// to GET requests that accept the encodings in the Accept-Encoding header.
+	// The sibling is returned with the Content-Encoding header,
+	// and the plain object is returned if no sibling exists.
+	// Both responses have the Vary: Accept-Encoding header.
+	// The requests with Range, versionId or partNumber always get the plain object.
+	Precompressed bool
+
+	// PrecompressedTTL is how long the missing sibling objects are remembered.
+	// If PrecompressedTTL is zero, one minute is used.
+	PrecompressedTTL time.Duration
+
+	// DetectContentType enables detecting the type of the objects whose Content-Type is missing or generic,
+	// such as binary/octet-stream.
+	// The type is detected from the extension of the key by mime.TypeByExtension,
+	// or from the first 512 bytes of the body by http.DetectContentType.
+	// The sniffed bytes are still returned to the caller.
+	DetectContentType bool
+
+	// AutoRestore is the policy for restoring archived objects on GET requests.
+	// GET requests of archived objects get 409 Conflict with the InvalidObjectState error code in ErrorCodeHeader,
+	// or with the RestoreInProgress error code and Retry-After if the object is being restored.
+	// If AutoRestore is set, the restore is started on the first GET request.
+	// If AutoRestore is nil, archived objects are restored only by POST ?restore requests.
+	AutoRestore *RestorePolicy
+
 	config client.ConfigProvider
 
 	// s3 api client for getting the region
@@ -57,6 +203,17 @@ type Transport struct {
 
 	// regional s3 api clients
 	s3 sync.Map
+
+	// in-flight upstream calls for CoalesceRequests
+	flightsMu sync.Mutex
+	flights   map[[sha256.Size]byte]*flight
+
+	// the states of Limits
+	limitersOnce sync.Once
+	limiters     []*limiter
+
+	// the missing sibling objects for Precompressed
+	missing missingCache
 }
 
 // NewTransport returns a new Transport.
@@ -81,22 +238,57 @@ func NewTransport(c client.ConfigProvider) *Transport {
 
 // RoundTrip implements http.RoundTripper.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	switch req.Method {
-	case http.MethodGet:
-		return t.getObject(req)
-	case http.MethodHead:
-		return t.headObject(req)
+	fn, subresource := t.subresourceHandler(req)
+	if !subresource {
+		switch req.Method {
+		case http.MethodGet:
+			fn = t.getObject
+		case http.MethodHead:
+			fn = t.headObject
+		case http.MethodPut:
+			if req.Header.Get("X-Amz-Copy-Source") != "" {
+				fn = t.copyObject
+			} else {
+				fn = t.putObject
+			}
+		case MethodCopy:
+			fn = t.copyObject
+		case http.MethodPatch:
+			fn = t.patchObject
+		case http.MethodDelete:
+			fn = t.deleteObject
+		}
 	}
-	return &http.Response{
-		Status:     "405 Method Not Allowed",
-		StatusCode: http.StatusMethodNotAllowed,
-		Proto:      "HTTP/1.0",
-		ProtoMajor: 1,
-		ProtoMinor: 0,
-		Header:     make(http.Header),
-		Body:       http.NoBody,
-		Close:      true,
-	}, nil
+	if fn == nil {
+		return methodNotAllowed(), nil
+	}
+
+	if len(t.Limits) > 0 {
+		fn = t.limit(fn)
+	}
+	if (t.FirstByteTimeout > 0 || t.ReadTimeout > 0 || t.MinThroughput > 0) &&
+		(req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		fn = t.timeout(fn)
+	}
+	if t.Hedge != nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		fn = t.hedge(fn)
+	}
+	if t.Retry != nil && t.Retry.isReplayable(req) {
+		fn = t.retry(fn)
+	}
+	if t.CoalesceRequests && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		fn = t.coalesce(fn)
+	}
+	if t.Precompressed && req.Method == http.MethodGet && !subresource {
+		fn = t.precompressed(fn)
+	}
+	if t.Decompress && req.Method == http.MethodGet && !subresource {
+		fn = t.decompress(fn)
+	}
+	if t.DetectContentType && (req.Method == http.MethodGet || req.Method == http.MethodHead) && !subresource {
+		fn = t.detectContentType(fn)
+	}
+	return fn(req)
 }
 
 func (t *Transport) getObject(req *http.Request) (*http.Response, error) {
@@ -115,15 +307,45 @@ func (t *Transport) getObject(req *http.Request) (*http.Response, error) {
 	in := newGetObjectInput(req)
 	in.Bucket = &host
 	in.Key = &path
+	if ifRange := req.Header.Get("If-Range"); ifRange != "" && in.Range != nil {
+		return t.getObjectIfRange(ctx, svc, in, ifRange)
+	}
+	if t.Cache != nil && isCacheable(in) {
+		return t.Cache.getObject(in, func(in *s3.GetObjectInput) (*http.Response, error) {
+			return t.doGetObject(ctx, svc, in)
+		})
+	}
+	return t.doGetObject(ctx, svc, in)
+}
+
+func (t *Transport) doGetObject(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput) (*http.Response, error) {
+	if t.Concurrency > 1 && in.Range == nil && in.PartNumber == nil {
+		return t.getObjectParallel(ctx, svc, in)
+	}
+	if t.BlockCache != nil && isBlockCacheable(in) {
+		return t.getObjectBlocks(ctx, svc, in)
+	}
+	return t.getObjectUncached(ctx, svc, in)
+}
+
+// getObjectUncached gets the object with a single GetObject request.
+func (t *Transport) getObjectUncached(ctx context.Context, svc s3iface.S3API, in *s3.GetObjectInput) (*http.Response, error) {
 	out, err := svc.GetObjectWithContext(ctx, in)
 	header := makeHeaderFromGetObjectOutput(out)
 	if err != nil {
+		if isArchived(err) {
+			return t.archivedObject(ctx, svc, in, err)
+		}
 		return handleError(header, err)
 	}
 
+	code := http.StatusOK
+	if out.ContentRange != nil {
+		code = http.StatusPartialContent
+	}
 	return &http.Response{
-		Status:        "200 OK",
-		StatusCode:    http.StatusOK,
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
 		Proto:         "HTTP/1.0",
 		ProtoMajor:    1,
 		ProtoMinor:    0,
@@ -150,6 +372,15 @@ func (t *Transport) headObject(req *http.Request) (*http.Response, error) {
 	in := newHeadObjectInput(req)
 	in.Bucket = &host
 	in.Key = &path
+	if t.HeadCache != nil && isHeadCacheable(in) {
+		return t.HeadCache.headObject(in, func(in *s3.HeadObjectInput) (*http.Response, error) {
+			return t.doHeadObject(ctx, svc, in)
+		})
+	}
+	return t.doHeadObject(ctx, svc, in)
+}
+
+func (t *Transport) doHeadObject(ctx context.Context, svc s3iface.S3API, in *s3.HeadObjectInput) (*http.Response, error) {
 	out, err := svc.HeadObjectWithContext(ctx, in)
 	header := makeHeaderFromHeadObjectOutput(out)
 	if err != nil {
@@ -168,11 +399,243 @@ func (t *Transport) headObject(req *http.Request) (*http.Response, error) {
 	}, nil
 }
 
+func (t *Transport) putObject(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newPutObjectInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	var opts []request.Option
+	if req.ContentLength > 0 {
+		in.ContentLength = aws.Int64(req.ContentLength)
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		in.Body = strings.NewReader("")
+		in.ContentLength = aws.Int64(0)
+	} else if body, ok := req.Body.(io.ReadSeeker); ok {
+		in.Body = body
+	} else {
+		// the body can't be rewound for signing and retrying.
+		in.Body = aws.ReadSeekCloser(req.Body)
+		opts = append(opts, withUnsignedPayload)
+	}
+	out, err := svc.PutObjectWithContext(ctx, in, opts...)
+	t.invalidate(host, path)
+	header := makeHeaderFromPutObjectOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
+
+func (t *Transport) deleteObject(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	ctx := req.Context()
+	svc, err := t.getBucketClient(ctx, host)
+	if err != nil {
+		return handleError(nil, err)
+	}
+
+	in := newDeleteObjectInput(req)
+	in.Bucket = &host
+	in.Key = &path
+	out, err := svc.DeleteObjectWithContext(ctx, in)
+	t.invalidate(host, path)
+	header := makeHeaderFromDeleteObjectOutput(out)
+	if err != nil {
+		return handleError(header, err)
+	}
+
+	return &http.Response{
+		Status:     "204 No Content",
+		StatusCode: http.StatusNoContent,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Close:      true,
+	}, nil
+}
+
+// withUnsignedPayload signs the request without the hash of the payload.
+// It is for the request bodies that are not seekable.
+func withUnsignedPayload(r *request.Request) {
+	r.Handlers.Sign.Remove(v4.SignRequestHandler)
+	r.Handlers.Sign.PushFrontNamed(v4.BuildNamedHandler("v4.CustomSignerHandler", v4.WithUnsignedPayload))
+	r.Retryer = client.NoOpRetryer{}
+}
+
+// invalidate removes the object from the caches after it is modified.
+func (t *Transport) invalidate(bucket, key string) {
+	if t.Cache != nil {
+		t.Cache.Purge(bucket, key)
+	}
+	if t.HeadCache != nil {
+		t.HeadCache.Purge(bucket, key)
+	}
+	t.missing.remove(bucket + "/" + key)
+}
+
+// subresourceHandler returns the handler for the subresource of the object, such as ?tagging.
+// The requests without the object key are handled as the subresources of the bucket if bucketHandler knows them.
+// It reports false if the request is not for a subresource.
+// The handler is nil if the subresource doesn't support the method.
+func (t *Transport) subresourceHandler(req *http.Request) (func(req *http.Request) (*http.Response, error), bool) {
+	if strings.TrimPrefix(req.URL.Path, "/") == "" {
+		// the request without the object key is for the bucket.
+		if h, ok := t.bucketHandler(req); ok {
+			return h, true
+		}
+	}
+	query := req.URL.Query()
+	if _, ok := query["restore"]; ok {
+		if req.Method == http.MethodPost {
+			return t.restoreObject, true
+		}
+		return nil, true
+	}
+	if _, ok := query["tagging"]; ok {
+		switch req.Method {
+		case http.MethodGet:
+			return t.getObjectTagging, true
+		case http.MethodPut:
+			return t.putObjectTagging, true
+		case http.MethodDelete:
+			return t.deleteObjectTagging, true
+		}
+		return nil, true
+	}
+	if _, ok := query["retention"]; ok {
+		switch req.Method {
+		case http.MethodGet:
+			return t.getObjectRetention, true
+		case http.MethodPut:
+			return t.putObjectRetention, true
+		}
+		return nil, true
+	}
+	if _, ok := query["legal-hold"]; ok {
+		switch req.Method {
+		case http.MethodGet:
+			return t.getObjectLegalHold, true
+		case http.MethodPut:
+			return t.putObjectLegalHold, true
+		}
+		return nil, true
+	}
+	if _, ok := query["acl"]; ok {
+		return t.aclHandler(req), true
+	}
+	if _, ok := query["attributes"]; ok {
+		if req.Method == http.MethodGet {
+			return t.getObjectAttributes, true
+		}
+		return nil, true
+	}
+	if _, ok := query["compose"]; ok {
+		if req.Method == http.MethodPost {
+			return t.composeObject, true
+		}
+		return nil, true
+	}
+	return nil, false
+}
+
+func methodNotAllowed() *http.Response {
+	return &http.Response{
+		Status:     "405 Method Not Allowed",
+		StatusCode: http.StatusMethodNotAllowed,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Close:      true,
+	}
+}
+
+// textResponse returns the response with the plain text body.
+func textResponse(code int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Close:         true,
+	}
+}
+
+// ErrorCodeHeader is the response header that reports the error code returned by S3, such as NoSuchKey.
+//
+// The requests denied by Object Lock are reported as ObjectLocked rather than AccessDenied.
+// S3 has no distinct error code for them: it responds 403 AccessDenied with a message such as
+// "Access Denied because object protected by object lock.".
+// So ObjectLocked is a heuristic based on the message containing "object lock", case-insensitively,
+// and it may miss the denials if S3 changes the wording.
+// The status code stays 403 Forbidden.
+const ErrorCodeHeader = "X-S3protocol-Error-Code"
+
+// errorCodeObjectLocked is the error code for the requests denied by Object Lock.
+const errorCodeObjectLocked = "ObjectLocked"
+
+// errorCode returns the error code of err.
+// S3 denies the requests to the locked objects with a generic AccessDenied,
+// so they are distinguished by the message; see ErrorCodeHeader.
+func errorCode(err error) string {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return ""
+	}
+	code := aerr.Code()
+	if code == "AccessDenied" && strings.Contains(strings.ToLower(aerr.Message()), "object lock") {
+		return errorCodeObjectLocked
+	}
+	return code
+}
+
 func handleError(header http.Header, err error) (*http.Response, error) {
 	if header == nil {
 		header = make(http.Header)
 	}
 	if err, ok := awsRequestFailure(err); ok {
+		if code := errorCode(err); code != "" {
+			header.Set(ErrorCodeHeader, code)
+		}
 		code := err.StatusCode()
 		return &http.Response{
 			Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
@@ -207,7 +670,16 @@ func (t *Transport) getBucketClient(ctx context.Context, bucket string) (s3iface
 }
 
 func (t *Transport) getBucketRegion(ctx context.Context, bucket string) (string, error) {
-	region, err := s3manager.GetBucketRegionWithClient(ctx, t.svc, bucket)
+	if t.Retry == nil {
+		return s3manager.GetBucketRegionWithClient(ctx, t.svc, bucket)
+	}
+
+	var region string
+	err := t.Retry.do(ctx, func() error {
+		var err error
+		region, err = s3manager.GetBucketRegionWithClient(ctx, t.svc, bucket)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -219,9 +691,11 @@ func awsRequestFailure(err error) (awserr.RequestFailure, bool) {
 		if err, ok := err.(awserr.RequestFailure); ok {
 			return err, true
 		}
-		if aerr, ok := err.(awserr.Error); ok {
-			err = aerr.OrigErr()
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			break
 		}
+		err = aerr.OrigErr()
 	}
 	return nil, false
 }
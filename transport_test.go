@@ -18,8 +18,44 @@ import (
 
 type s3mock struct {
 	s3iface.S3API
-	getObjectWithContext  func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error)
-	headObjectWithContext func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error)
+	getObjectWithContext    func(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error)
+	headObjectWithContext   func(ctx context.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error)
+	putObjectWithContext    func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error)
+	deleteObjectWithContext func(ctx context.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error)
+
+	restoreObjectWithContext func(ctx context.Context, in *s3.RestoreObjectInput, _ ...request.Option) (*s3.RestoreObjectOutput, error)
+
+	getObjectTaggingWithContext                func(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error)
+	putObjectTaggingWithContext                func(ctx context.Context, in *s3.PutObjectTaggingInput, _ ...request.Option) (*s3.PutObjectTaggingOutput, error)
+	deleteObjectTaggingWithContext             func(ctx context.Context, in *s3.DeleteObjectTaggingInput, _ ...request.Option) (*s3.DeleteObjectTaggingOutput, error)
+	getObjectAttributesWithContext             func(ctx context.Context, in *s3.GetObjectAttributesInput, _ ...request.Option) (*s3.GetObjectAttributesOutput, error)
+	getObjectRetentionWithContext              func(ctx context.Context, in *s3.GetObjectRetentionInput, _ ...request.Option) (*s3.GetObjectRetentionOutput, error)
+	putObjectRetentionWithContext              func(ctx context.Context, in *s3.PutObjectRetentionInput, _ ...request.Option) (*s3.PutObjectRetentionOutput, error)
+	getObjectLegalHoldWithContext              func(ctx context.Context, in *s3.GetObjectLegalHoldInput, _ ...request.Option) (*s3.GetObjectLegalHoldOutput, error)
+	putObjectLegalHoldWithContext              func(ctx context.Context, in *s3.PutObjectLegalHoldInput, _ ...request.Option) (*s3.PutObjectLegalHoldOutput, error)
+	getObjectAclWithContext                    func(ctx context.Context, in *s3.GetObjectAclInput, _ ...request.Option) (*s3.GetObjectAclOutput, error)
+	putObjectAclWithContext                    func(ctx context.Context, in *s3.PutObjectAclInput, _ ...request.Option) (*s3.PutObjectAclOutput, error)
+	getBucketAclWithContext                    func(ctx context.Context, in *s3.GetBucketAclInput, _ ...request.Option) (*s3.GetBucketAclOutput, error)
+	putBucketAclWithContext                    func(ctx context.Context, in *s3.PutBucketAclInput, _ ...request.Option) (*s3.PutBucketAclOutput, error)
+	headBucketWithContext                      func(ctx context.Context, in *s3.HeadBucketInput, _ ...request.Option) (*s3.HeadBucketOutput, error)
+	getBucketLocationWithContext               func(ctx context.Context, in *s3.GetBucketLocationInput, _ ...request.Option) (*s3.GetBucketLocationOutput, error)
+	getBucketVersioningWithContext             func(ctx context.Context, in *s3.GetBucketVersioningInput, _ ...request.Option) (*s3.GetBucketVersioningOutput, error)
+	getBucketPolicyWithContext                 func(ctx context.Context, in *s3.GetBucketPolicyInput, _ ...request.Option) (*s3.GetBucketPolicyOutput, error)
+	getBucketLifecycleConfigurationWithContext func(ctx context.Context, in *s3.GetBucketLifecycleConfigurationInput, _ ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	getBucketCorsWithContext                   func(ctx context.Context, in *s3.GetBucketCorsInput, _ ...request.Option) (*s3.GetBucketCorsOutput, error)
+	getBucketEncryptionWithContext             func(ctx context.Context, in *s3.GetBucketEncryptionInput, _ ...request.Option) (*s3.GetBucketEncryptionOutput, error)
+	getBucketTaggingWithContext                func(ctx context.Context, in *s3.GetBucketTaggingInput, _ ...request.Option) (*s3.GetBucketTaggingOutput, error)
+	getBucketOwnershipControlsWithContext      func(ctx context.Context, in *s3.GetBucketOwnershipControlsInput, _ ...request.Option) (*s3.GetBucketOwnershipControlsOutput, error)
+	getPublicAccessBlockWithContext            func(ctx context.Context, in *s3.GetPublicAccessBlockInput, _ ...request.Option) (*s3.GetPublicAccessBlockOutput, error)
+	copyObjectWithContext                      func(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error)
+	createMultipartUploadWithContext           func(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error)
+	uploadPartCopyWithContext                  func(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error)
+	uploadPartWithContext                      func(ctx context.Context, in *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error)
+	completeMultipartUploadWithContext         func(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error)
+	abortMultipartUploadWithContext            func(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...request.Option) (*s3.AbortMultipartUploadOutput, error)
+	deleteObjectsWithContext                   func(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error)
+	listObjectsV2PagesWithContext              func(ctx context.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error
+	listObjectVersionsPagesWithContext         func(ctx context.Context, in *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool, _ ...request.Option) error
 }
 
 func (mock *s3mock) GetObjectWithContext(ctx context.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
@@ -30,6 +66,142 @@ func (mock *s3mock) HeadObjectWithContext(ctx context.Context, in *s3.HeadObject
 	return mock.headObjectWithContext(ctx, in)
 }
 
+func (mock *s3mock) PutObjectWithContext(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	return mock.putObjectWithContext(ctx, in)
+}
+
+func (mock *s3mock) DeleteObjectWithContext(ctx context.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	return mock.deleteObjectWithContext(ctx, in)
+}
+
+func (mock *s3mock) RestoreObjectWithContext(ctx context.Context, in *s3.RestoreObjectInput, _ ...request.Option) (*s3.RestoreObjectOutput, error) {
+	return mock.restoreObjectWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetObjectTaggingWithContext(ctx context.Context, in *s3.GetObjectTaggingInput, _ ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	return mock.getObjectTaggingWithContext(ctx, in)
+}
+
+func (mock *s3mock) PutObjectTaggingWithContext(ctx context.Context, in *s3.PutObjectTaggingInput, _ ...request.Option) (*s3.PutObjectTaggingOutput, error) {
+	return mock.putObjectTaggingWithContext(ctx, in)
+}
+
+func (mock *s3mock) DeleteObjectTaggingWithContext(ctx context.Context, in *s3.DeleteObjectTaggingInput, _ ...request.Option) (*s3.DeleteObjectTaggingOutput, error) {
+	return mock.deleteObjectTaggingWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetObjectAttributesWithContext(ctx context.Context, in *s3.GetObjectAttributesInput, _ ...request.Option) (*s3.GetObjectAttributesOutput, error) {
+	return mock.getObjectAttributesWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetObjectRetentionWithContext(ctx context.Context, in *s3.GetObjectRetentionInput, _ ...request.Option) (*s3.GetObjectRetentionOutput, error) {
+	return mock.getObjectRetentionWithContext(ctx, in)
+}
+
+func (mock *s3mock) PutObjectRetentionWithContext(ctx context.Context, in *s3.PutObjectRetentionInput, _ ...request.Option) (*s3.PutObjectRetentionOutput, error) {
+	return mock.putObjectRetentionWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetObjectLegalHoldWithContext(ctx context.Context, in *s3.GetObjectLegalHoldInput, _ ...request.Option) (*s3.GetObjectLegalHoldOutput, error) {
+	return mock.getObjectLegalHoldWithContext(ctx, in)
+}
+
+func (mock *s3mock) PutObjectLegalHoldWithContext(ctx context.Context, in *s3.PutObjectLegalHoldInput, _ ...request.Option) (*s3.PutObjectLegalHoldOutput, error) {
+	return mock.putObjectLegalHoldWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetObjectAclWithContext(ctx context.Context, in *s3.GetObjectAclInput, _ ...request.Option) (*s3.GetObjectAclOutput, error) {
+	return mock.getObjectAclWithContext(ctx, in)
+}
+
+func (mock *s3mock) PutObjectAclWithContext(ctx context.Context, in *s3.PutObjectAclInput, _ ...request.Option) (*s3.PutObjectAclOutput, error) {
+	return mock.putObjectAclWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketAclWithContext(ctx context.Context, in *s3.GetBucketAclInput, _ ...request.Option) (*s3.GetBucketAclOutput, error) {
+	return mock.getBucketAclWithContext(ctx, in)
+}
+
+func (mock *s3mock) PutBucketAclWithContext(ctx context.Context, in *s3.PutBucketAclInput, _ ...request.Option) (*s3.PutBucketAclOutput, error) {
+	return mock.putBucketAclWithContext(ctx, in)
+}
+
+func (mock *s3mock) HeadBucketWithContext(ctx context.Context, in *s3.HeadBucketInput, _ ...request.Option) (*s3.HeadBucketOutput, error) {
+	return mock.headBucketWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketLocationWithContext(ctx context.Context, in *s3.GetBucketLocationInput, _ ...request.Option) (*s3.GetBucketLocationOutput, error) {
+	return mock.getBucketLocationWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketVersioningWithContext(ctx context.Context, in *s3.GetBucketVersioningInput, _ ...request.Option) (*s3.GetBucketVersioningOutput, error) {
+	return mock.getBucketVersioningWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketPolicyWithContext(ctx context.Context, in *s3.GetBucketPolicyInput, _ ...request.Option) (*s3.GetBucketPolicyOutput, error) {
+	return mock.getBucketPolicyWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketLifecycleConfigurationWithContext(ctx context.Context, in *s3.GetBucketLifecycleConfigurationInput, _ ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	return mock.getBucketLifecycleConfigurationWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketCorsWithContext(ctx context.Context, in *s3.GetBucketCorsInput, _ ...request.Option) (*s3.GetBucketCorsOutput, error) {
+	return mock.getBucketCorsWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketEncryptionWithContext(ctx context.Context, in *s3.GetBucketEncryptionInput, _ ...request.Option) (*s3.GetBucketEncryptionOutput, error) {
+	return mock.getBucketEncryptionWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketTaggingWithContext(ctx context.Context, in *s3.GetBucketTaggingInput, _ ...request.Option) (*s3.GetBucketTaggingOutput, error) {
+	return mock.getBucketTaggingWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetBucketOwnershipControlsWithContext(ctx context.Context, in *s3.GetBucketOwnershipControlsInput, _ ...request.Option) (*s3.GetBucketOwnershipControlsOutput, error) {
+	return mock.getBucketOwnershipControlsWithContext(ctx, in)
+}
+
+func (mock *s3mock) GetPublicAccessBlockWithContext(ctx context.Context, in *s3.GetPublicAccessBlockInput, _ ...request.Option) (*s3.GetPublicAccessBlockOutput, error) {
+	return mock.getPublicAccessBlockWithContext(ctx, in)
+}
+
+func (mock *s3mock) CopyObjectWithContext(ctx context.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+	return mock.copyObjectWithContext(ctx, in)
+}
+
+func (mock *s3mock) CreateMultipartUploadWithContext(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	return mock.createMultipartUploadWithContext(ctx, in)
+}
+
+func (mock *s3mock) UploadPartCopyWithContext(ctx context.Context, in *s3.UploadPartCopyInput, _ ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	return mock.uploadPartCopyWithContext(ctx, in)
+}
+
+func (mock *s3mock) UploadPartWithContext(ctx context.Context, in *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+	return mock.uploadPartWithContext(ctx, in)
+}
+
+func (mock *s3mock) CompleteMultipartUploadWithContext(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	return mock.completeMultipartUploadWithContext(ctx, in)
+}
+
+func (mock *s3mock) AbortMultipartUploadWithContext(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	return mock.abortMultipartUploadWithContext(ctx, in)
+}
+
+func (mock *s3mock) DeleteObjectsWithContext(ctx context.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	return mock.deleteObjectsWithContext(ctx, in)
+}
+
+func (mock *s3mock) ListObjectsV2PagesWithContext(ctx context.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	return mock.listObjectsV2PagesWithContext(ctx, in, fn)
+}
+
+func (mock *s3mock) ListObjectVersionsPagesWithContext(ctx context.Context, in *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool, _ ...request.Option) error {
+	return mock.listObjectVersionsPagesWithContext(ctx, in, fn)
+}
+
 func newTestTransport(mock *s3mock, bucket string) *Transport {
 	t := &Transport{}
 	c := &s3api{svc: mock}
@@ -242,3 +414,110 @@ func TestRoundTrip_NotModified(t *testing.T) {
 		t.Errorf("unexpected ETag: want %q, got %q", `"9ec04a75687e781a17618f774658e4a3"`, resp.Header.Get("ETag"))
 	}
 }
+
+func TestRoundTrip_PUT(t *testing.T) {
+	mock := &s3mock{
+		putObjectWithContext: func(ctx context.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			if aws.StringValue(in.Key) != "object-key" {
+				t.Errorf("unexpected key: want %q, got %q", "object-key", aws.StringValue(in.Key))
+			}
+			if aws.StringValue(in.ContentType) != "plain/text" {
+				t.Errorf("unexpected content type: want %q, got %q", "plain/text", aws.StringValue(in.ContentType))
+			}
+			if aws.StringValue(in.Metadata["Foo"]) != "bar" {
+				t.Errorf("unexpected metadata: want %q, got %q", "bar", aws.StringValue(in.Metadata["Foo"]))
+			}
+			if aws.Int64Value(in.ContentLength) != 9 {
+				t.Errorf("unexpected content length: want %d, got %d", 9, aws.Int64Value(in.ContentLength))
+			}
+			body, err := ioutil.ReadAll(in.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != "Hello S3!" {
+				t.Errorf("want %q, got %q", "Hello S3!", string(body))
+			}
+			return &s3.PutObjectOutput{
+				ETag:      aws.String(`"9ec04a75687e781a17618f774658e4a3"`),
+				VersionId: aws.String("version"),
+			}, nil
+		},
+	}
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", newTestTransport(mock, "bucket-name"))
+	c := &http.Client{Transport: tr}
+	req, err := http.NewRequest(http.MethodPut, "s3://bucket-name/object-key", strings.NewReader("Hello S3!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "plain/text")
+	req.Header.Set("X-Amz-Meta-Foo", "bar")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") != `"9ec04a75687e781a17618f774658e4a3"` {
+		t.Errorf("unexpected ETag: want %q, got %q", `"9ec04a75687e781a17618f774658e4a3"`, resp.Header.Get("ETag"))
+	}
+	if resp.Header.Get("X-Amz-Version-Id") != "version" {
+		t.Errorf("unexpected version id: want %q, got %q", "version", resp.Header.Get("X-Amz-Version-Id"))
+	}
+}
+
+func TestRoundTrip_DELETE(t *testing.T) {
+	mock := &s3mock{
+		deleteObjectWithContext: func(ctx context.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+			if aws.StringValue(in.VersionId) != "foobar" {
+				t.Errorf("unexpected version id: want %q, got %q", "foobar", aws.StringValue(in.VersionId))
+			}
+			return &s3.DeleteObjectOutput{
+				DeleteMarker: aws.Bool(true),
+			}, nil
+		},
+	}
+	tr := &http.Transport{}
+	tr.RegisterProtocol("s3", newTestTransport(mock, "bucket-name"))
+	c := &http.Client{Transport: tr}
+	req, err := http.NewRequest(http.MethodDelete, "s3://bucket-name/object-key?versionId=foobar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if resp.Header.Get("X-Amz-Delete-Marker") != "true" {
+		t.Errorf("want %s, got %s", "true", resp.Header.Get("X-Amz-Delete-Marker"))
+	}
+}
+
+func TestAWSRequestFailure(t *testing.T) {
+	rerr := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "request-id")
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("plain error"), false},
+		{awserr.New("RequestError", "send request failed", errors.New("connection reset")), false},
+		{rerr, true},
+		{awserr.New("SerializationError", "failed to decode", rerr), true},
+	}
+	for _, tt := range tests {
+		// it must return even if the chain ends with a non-awserr error.
+		_, got := awsRequestFailure(tt.err)
+		if got != tt.want {
+			t.Errorf("%v: want %t, got %t", tt.err, tt.want, got)
+		}
+	}
+}